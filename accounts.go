@@ -0,0 +1,152 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// Account is a wallet that expenses are recorded against, e.g. "Personal"
+// or "Business". Exactly one account is the default and receives expenses
+// created without an account_id.
+type Account struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	IsDefault bool      `json:"is_default"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Postgres error codes the handlers translate into client errors.
+const (
+	pgForeignKeyViolation = "23503"
+	pgUniqueViolation     = "23505"
+)
+
+// isPgError reports whether err is a Postgres error with the given SQLSTATE
+// code.
+func isPgError(err error, code string) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr) && pgErr.Code == code
+}
+
+func (app *App) getAccounts(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DBClient.Query(r.Context(),
+		"SELECT id, name, is_default, created_at FROM accounts ORDER BY id")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	accounts := []Account{}
+	for rows.Next() {
+		var a Account
+		if err := rows.Scan(&a.ID, &a.Name, &a.IsDefault, &a.CreatedAt); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		accounts = append(accounts, a)
+	}
+
+	writeJSON(w, http.StatusOK, accounts)
+}
+
+func (app *App) createAccount(w http.ResponseWriter, r *http.Request) {
+	var account Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid account: name is required")
+		return
+	}
+
+	err := app.DBClient.QueryRow(r.Context(),
+		"INSERT INTO accounts (name) VALUES ($1) RETURNING id, is_default, created_at",
+		account.Name).Scan(&account.ID, &account.IsDefault, &account.CreatedAt)
+	if isPgError(err, pgUniqueViolation) {
+		writeJSONError(w, http.StatusConflict, "an account with that name already exists")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, account)
+}
+
+func (app *App) updateAccount(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var account Account
+	if err := json.NewDecoder(r.Body).Decode(&account); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	account.Name = strings.TrimSpace(account.Name)
+	if account.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid account: name is required")
+		return
+	}
+
+	err := app.DBClient.QueryRow(r.Context(),
+		"UPDATE accounts SET name=$1 WHERE id=$2 RETURNING id, is_default, created_at",
+		account.Name, id).Scan(&account.ID, &account.IsDefault, &account.CreatedAt)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "account not found")
+		return
+	}
+	if isPgError(err, pgUniqueViolation) {
+		writeJSONError(w, http.StatusConflict, "an account with that name already exists")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, account)
+}
+
+func (app *App) deleteAccount(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var isDefault bool
+	err := app.DBClient.QueryRow(r.Context(),
+		"SELECT is_default FROM accounts WHERE id=$1", id).Scan(&isDefault)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "account not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if isDefault {
+		writeJSONError(w, http.StatusConflict, "the default account cannot be deleted")
+		return
+	}
+
+	_, err = app.DBClient.Exec(r.Context(), "DELETE FROM accounts WHERE id=$1", id)
+	if isPgError(err, pgForeignKeyViolation) {
+		writeJSONError(w, http.StatusConflict, "account still has expenses or transfers")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateAccountAndDefaultAssignment(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Create a named account
+	body, _ := json.Marshal(Account{Name: fmt.Sprintf("Business %d", time.Now().UnixNano())})
+	req, _ := http.NewRequest("POST", "/api/accounts", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should return 201 Created")
+
+	var account Account
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &account))
+	assert.NotZero(t, account.ID)
+	assert.False(t, account.IsDefault)
+
+	// An expense without account_id lands in the default account
+	expenseJSON, _ := json.Marshal(Expense{
+		Description: "Unassigned",
+		Amount:      1200,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	})
+	req, _ = http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(expenseJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var created Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+
+	var defaultID int
+	err := app.DBClient.QueryRow(req.Context(), "SELECT default_account_id()").Scan(&defaultID)
+	assert.NoError(t, err)
+	assert.Equal(t, defaultID, created.AccountID, "Should use the default account")
+
+	// An unknown account is rejected
+	expenseJSON, _ = json.Marshal(Expense{
+		Description: "Nowhere",
+		Amount:      1200,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+		AccountID:   999999,
+	})
+	req, _ = http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(expenseJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject an unknown account")
+}
+
+func TestFilterByAccount(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	cash := createTestAccount(t, app)
+	card := createTestAccount(t, app)
+	for _, e := range []struct {
+		account int
+		amount  Cents
+	}{
+		{cash, 450},
+		{cash, 1000},
+		{card, 9999},
+	} {
+		_, err := app.DBClient.Exec(context.Background(),
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Shopping", e.amount, "Food", time.Now().Add(-time.Hour), e.account)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Listing only returns the account's own expenses
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses?account_id=%d", cash), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	assert.Len(t, expenses, 2)
+	for _, e := range expenses {
+		assert.Equal(t, cash, e.AccountID)
+	}
+
+	// And so does the summary
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/expenses/summary?account_id=%d", card), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var summary ExpenseSummary
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &summary))
+	if assert.Len(t, summary.Totals, 1) {
+		assert.Equal(t, Cents(9999), summary.Totals[0].Total)
+		assert.Equal(t, 1, summary.Totals[0].Count)
+	}
+}
+
+func TestDeleteAccountInUse(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	var expenseID int
+	err := app.DBClient.QueryRow(context.Background(),
+		"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		"Fuel", Cents(4000), "Transport", time.Now(), accountID).Scan(&expenseID)
+	assert.NoError(t, err, "Should insert test expense")
+
+	remove := func() int {
+		req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/accounts/%d", accountID), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+
+	// Deleting while an expense uses it is blocked
+	assert.Equal(t, http.StatusConflict, remove(), "Should return 409 while in use")
+
+	// Once nothing references it the account can go
+	_, err = app.DBClient.Exec(context.Background(), "DELETE FROM expenses WHERE id=$1", expenseID)
+	assert.NoError(t, err)
+	assert.Equal(t, http.StatusNoContent, remove(), "Should delete an unused account")
+
+	// The default account can never be deleted
+	var defaultID int
+	err = app.DBClient.QueryRow(context.Background(), "SELECT default_account_id()").Scan(&defaultID)
+	assert.NoError(t, err)
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/accounts/%d", defaultID), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Should protect the default account")
+}
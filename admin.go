@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+)
+
+// DBStats is a snapshot of the connection pool, for debugging connection
+// exhaustion.
+type DBStats struct {
+	AcquiredConns           int32   `json:"acquired_conns"`
+	IdleConns               int32   `json:"idle_conns"`
+	ConstructingConns       int32   `json:"constructing_conns"`
+	TotalConns              int32   `json:"total_conns"`
+	MaxConns                int32   `json:"max_conns"`
+	AcquireCount            int64   `json:"acquire_count"`
+	AcquireDurationMs       float64 `json:"acquire_duration_ms"`
+	EmptyAcquireCount       int64   `json:"empty_acquire_count"`
+	CanceledAcquireCount    int64   `json:"canceled_acquire_count"`
+	NewConnsCount           int64   `json:"new_conns_count"`
+	MaxLifetimeDestroyCount int64   `json:"max_lifetime_destroy_count"`
+	MaxIdleDestroyCount     int64   `json:"max_idle_destroy_count"`
+}
+
+// getDBStats returns the pool's current statistics. There are no user roles
+// yet, so it is not restricted; it belongs behind an admin check once they
+// exist.
+func (app *App) getDBStats(w http.ResponseWriter, r *http.Request) {
+	s := app.DBClient.Stat()
+
+	writeJSON(w, http.StatusOK, DBStats{
+		AcquiredConns:           s.AcquiredConns(),
+		IdleConns:               s.IdleConns(),
+		ConstructingConns:       s.ConstructingConns(),
+		TotalConns:              s.TotalConns(),
+		MaxConns:                s.MaxConns(),
+		AcquireCount:            s.AcquireCount(),
+		AcquireDurationMs:       float64(s.AcquireDuration().Microseconds()) / 1000,
+		EmptyAcquireCount:       s.EmptyAcquireCount(),
+		CanceledAcquireCount:    s.CanceledAcquireCount(),
+		NewConnsCount:           s.NewConnsCount(),
+		MaxLifetimeDestroyCount: s.MaxLifetimeDestroyCount(),
+		MaxIdleDestroyCount:     s.MaxIdleDestroyCount(),
+	})
+}
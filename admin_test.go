@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetDBStats(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Create request
+	req, _ := http.NewRequest("GET", "/api/admin/db-stats", nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+	var stats map[string]any
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &stats))
+	for _, field := range []string{"acquired_conns", "idle_conns", "total_conns", "max_conns", "acquire_count"} {
+		_, ok := stats[field].(float64)
+		assert.True(t, ok, "Should include numeric field %s", field)
+	}
+	assert.Equal(t, float64(5), stats["max_conns"], "Should report the test pool size")
+}
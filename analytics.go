@@ -0,0 +1,283 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// CategorySpend is one slice of the by-category breakdown. Percentage is
+// the category's share of all spending in the window.
+type CategorySpend struct {
+	Category   string  `json:"category"`
+	Total      Cents   `json:"total"`
+	Count      int     `json:"count"`
+	Percentage float64 `json:"percentage"`
+}
+
+// getSpendingByCategory returns spending per category for the filtered
+// window (typically ?from=&to=), largest first. It is the same aggregation
+// as the top-categories leaderboard without the limit.
+func (app *App) getSpendingByCategory(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	totals, err := app.categoryTotals(r.Context(), filter, app.now(), 0)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	spend := make([]CategorySpend, len(totals))
+	for i, ct := range totals {
+		spend[i] = CategorySpend{Category: ct.Category, Total: ct.Total, Count: ct.Count, Percentage: ct.Share}
+	}
+
+	writeJSON(w, http.StatusOK, spend)
+}
+
+// trendGranularities are the bucket sizes accepted by the trend endpoint.
+var trendGranularities = map[string]bool{"day": true, "week": true, "month": true}
+
+// maxTrendBuckets caps the length of a trend series.
+const maxTrendBuckets = 1000
+
+// TrendPoint is the spending in one bucket of a trend series. Period is the
+// first day of the bucket; weeks start on Monday.
+type TrendPoint struct {
+	Period string `json:"period"`
+	Total  Cents  `json:"total"`
+}
+
+// trendBuckets estimates how many buckets of granularity fit in
+// [start, end), rounding up.
+func trendBuckets(granularity string, start, end time.Time) int {
+	switch granularity {
+	case "day":
+		return int(end.Sub(start).Hours()/24) + 1
+	case "week":
+		return int(end.Sub(start).Hours()/(24*7)) + 2
+	default:
+		return (end.Year()-start.Year())*12 + int(end.Month()-start.Month()) + 1
+	}
+}
+
+// getSpendingTrend returns spending bucketed by ?granularity= (day, week or
+// month; default month) over the filtered window, oldest first. Every
+// bucket in the window is present, with a zero total where nothing was
+// spent. The window needs a start (from or period); its end defaults to
+// today.
+func (app *App) getSpendingTrend(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	granularity := r.URL.Query().Get("granularity")
+	if granularity == "" {
+		granularity = "month"
+	}
+	if !trendGranularities[granularity] {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid granularity %q: must be day, week or month", granularity))
+		return
+	}
+
+	now := app.now()
+	start, end := filter.bounds(now)
+	if start.IsZero() {
+		writeJSONError(w, http.StatusBadRequest, "from or period is required")
+		return
+	}
+	if end.IsZero() {
+		y, m, d := now.Date()
+		end = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+	if trendBuckets(granularity, start, end) > maxTrendBuckets {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("range too long: at most %d %ss", maxTrendBuckets, granularity))
+		return
+	}
+
+	// The series is built from the bucket list so empty buckets still
+	// appear, then the spend per bucket is joined on.
+	where, args := filter.spending().where(now)
+	args = append(args, granularity, start, end)
+	g, from, to := len(args)-2, len(args)-1, len(args)
+	series := []TrendPoint{}
+	err = app.queryWithTimeout(r.Context(), "spending trend", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx, fmt.Sprintf(`
+			WITH buckets AS (
+				SELECT generate_series(date_trunc($%[1]d, $%[2]d::timestamp), $%[3]d::timestamp, ('1 ' || $%[1]d)::interval) AS period
+			), spend AS (
+				SELECT date_trunc($%[1]d, date) AS period, SUM(%[4]s)::bigint AS total
+				FROM expenses%[5]s
+				GROUP BY 1
+			)
+			SELECT b.period, COALESCE(s.total, 0)
+			FROM buckets b LEFT JOIN spend s ON s.period = b.period
+			WHERE b.period < $%[3]d::timestamp
+			ORDER BY b.period`, g, from, to, netAmount, where), args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var period time.Time
+			var p TrendPoint
+			if err := rows.Scan(&period, &p.Total); err != nil {
+				return err
+			}
+			p.Period = period.Format(dateLayout)
+			series = append(series, p)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, series)
+}
+
+// Limits for the largest-expenses list.
+const (
+	defaultTopExpenses = 5
+	maxTopExpenses     = 100
+)
+
+// getTopExpenses returns the largest individual expenses in the filtered
+// window (typically ?from=&to=), biggest first, up to ?limit=. Refunds and
+// income are not spending and are left out. Amounts in different
+// currencies are compared as they are, so filter by currency to rank like
+// with like.
+func (app *App) getTopExpenses(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := defaultTopExpenses
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTopExpenses {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("invalid limit %q: must be between 1 and %d", v, maxTopExpenses))
+			return
+		}
+	}
+
+	where, args := filter.spending().where(app.now())
+	args = append(args, limit)
+	expenses := []Expense{}
+	err = app.queryWithTimeout(r.Context(), "top expenses", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx,
+			"SELECT "+expenseColumns+" FROM expenses"+where+
+				fmt.Sprintf(" AND refund_of IS NULL ORDER BY amount DESC, date DESC, id DESC LIMIT $%d", len(args)),
+			args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e Expense
+			if err := scanExpense(rows, &e); err != nil {
+				return err
+			}
+			expenses = append(expenses, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expenses)
+}
+
+// SpendingAverages is the average spend over a window. From and To are
+// its first and last days. A partly covered week counts as a whole one,
+// so Weeks is never zero.
+type SpendingAverages struct {
+	From    string `json:"from"`
+	To      string `json:"to"`
+	Days    int    `json:"days"`
+	Weeks   int    `json:"weeks"`
+	Total   Cents  `json:"total"`
+	PerDay  Cents  `json:"per_day"`
+	PerWeek Cents  `json:"per_week"`
+}
+
+// daysBetween counts the calendar days in [start, end), ignoring the time
+// of day so daylight saving changes don't shorten or stretch the count.
+func daysBetween(start, end time.Time) int {
+	y, m, d := start.Date()
+	from := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	y, m, d = end.Date()
+	to := time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+	return int(to.Sub(from).Hours() / 24)
+}
+
+// averageOf divides total into n parts, rounding to the nearest cent.
+func averageOf(total Cents, n int) Cents {
+	return Cents(math.Round(float64(total) / float64(n)))
+}
+
+// getSpendingAverages returns the average spend per day and per week over
+// the filtered window. Like the trend, the window needs a start (from or
+// period) and its end defaults to today.
+func (app *App) getSpendingAverages(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	now := app.now()
+	start, end := filter.bounds(now)
+	if start.IsZero() {
+		writeJSONError(w, http.StatusBadRequest, "from or period is required")
+		return
+	}
+	if end.IsZero() {
+		y, m, d := now.Date()
+		end = time.Date(y, m, d+1, 0, 0, 0, 0, now.Location())
+	}
+	days := daysBetween(start, end)
+	if days < 1 {
+		writeJSONError(w, http.StatusBadRequest, "from must not be after today")
+		return
+	}
+
+	avg := SpendingAverages{
+		From:  start.Format(dateLayout),
+		To:    end.AddDate(0, 0, -1).Format(dateLayout),
+		Days:  days,
+		Weeks: (days + 6) / 7,
+	}
+	where, args := filter.spending().where(now)
+	err = app.queryWithTimeout(r.Context(), "spending averages", func(ctx context.Context) error {
+		return app.DBClient.QueryRow(ctx,
+			"SELECT COALESCE(SUM("+netAmount+"), 0)::bigint FROM expenses"+where, args...).Scan(&avg.Total)
+	})
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+	avg.PerDay = averageOf(avg.Total, avg.Days)
+	avg.PerWeek = averageOf(avg.Total, avg.Weeks)
+
+	writeJSON(w, http.StatusOK, avg)
+}
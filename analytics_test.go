@@ -0,0 +1,229 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSpendingByCategory(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+	day := time.Date(2023, 4, 12, 12, 0, 0, 0, time.Local)
+	for _, e := range []struct {
+		category string
+		amount   Cents
+	}{
+		{"Food", 1000},
+		{"Food", 2333},
+		{"Transport", 3333},
+		{"Health", 3334},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Analytics", e.amount, e.category, day, accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET",
+		fmt.Sprintf("/api/analytics/by-category?account_id=%d&from=2023-04-01&to=2023-04-30", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var spend []CategorySpend
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spend))
+	if assert.Len(t, spend, 3) {
+		assert.Equal(t, CategorySpend{Category: "Health", Total: 3334, Count: 1, Percentage: 33.34}, spend[0])
+		assert.Equal(t, CategorySpend{Category: "Food", Total: 3333, Count: 2, Percentage: 33.33}, spend[1])
+		assert.Equal(t, CategorySpend{Category: "Transport", Total: 3333, Count: 1, Percentage: 33.33}, spend[2])
+	}
+
+	var sum float64
+	for _, s := range spend {
+		sum += s.Percentage
+	}
+	assert.InDelta(t, 100, sum, 0.05, "Percentages should add up to about 100")
+}
+
+func TestSpendingTrendFillsGaps(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+
+	// Spending in January and March 2023, none in February
+	for _, e := range []struct {
+		amount Cents
+		date   time.Time
+	}{
+		{1250, time.Date(2023, 1, 5, 10, 0, 0, 0, time.Local)},
+		{750, time.Date(2023, 1, 28, 10, 0, 0, 0, time.Local)},
+		{4000, time.Date(2023, 3, 15, 10, 0, 0, 0, time.Local)},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Trend", e.amount, "Food", e.date, accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET",
+		fmt.Sprintf("/api/analytics/trend?account_id=%d&granularity=month&from=2023-01-01&to=2023-04-30", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var series []TrendPoint
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &series))
+	assert.Equal(t, []TrendPoint{
+		{Period: "2023-01-01", Total: 2000},
+		{Period: "2023-02-01", Total: 0},
+		{Period: "2023-03-01", Total: 4000},
+		{Period: "2023-04-01", Total: 0},
+	}, series, "Every month in the range should appear, empty ones at zero")
+}
+
+func TestSpendingTrendValidation(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	for _, query := range []string{
+		"granularity=year&from=2023-01-01",
+		"granularity=month",
+		"granularity=day&from=2000-01-01&to=2020-01-01",
+	} {
+		req, _ := http.NewRequest("GET", "/api/analytics/trend?"+query, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, query)
+	}
+}
+
+func TestTopExpenses(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+
+	insert := func(description string, amount Cents, date time.Time) int {
+		var id int
+		err := app.DBClient.QueryRow(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+			description, amount, "Shopping", date, accountID).Scan(&id)
+		assert.NoError(t, err, "Should insert test expense")
+		return id
+	}
+	inWindow := time.Date(2023, 6, 10, 12, 0, 0, 0, time.Local)
+	insert("Shoes", 8000, inWindow)
+	insert("Coffee", 350, inWindow)
+	laptop := insert("Laptop", 120000, inWindow)
+	insert("Lunch", 1500, inWindow)
+	insert("Car", 900000, time.Date(2023, 8, 1, 12, 0, 0, 0, time.Local))
+
+	// A refund is not an expense in its own right
+	refund := insert("Laptop refund", 50000, inWindow)
+	_, err := app.DBClient.Exec(ctx, "UPDATE expenses SET refund_of = $1 WHERE id = $2", laptop, refund)
+	assert.NoError(t, err)
+
+	// Create request
+	req, _ := http.NewRequest("GET",
+		fmt.Sprintf("/api/analytics/top?account_id=%d&from=2023-06-01&to=2023-06-30&limit=3", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var top []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &top))
+	var names []string
+	for _, e := range top {
+		names = append(names, e.Description)
+	}
+	assert.Equal(t, []string{"Laptop", "Shoes", "Lunch"}, names, "Should list the largest in the window, biggest first")
+
+	for _, limit := range []string{"0", "101", "abc"} {
+		req, _ := http.NewRequest("GET", "/api/analytics/top?limit="+limit, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, limit)
+	}
+}
+
+func TestDaysBetween(t *testing.T) {
+	day := func(m time.Month, d int) time.Time { return time.Date(2024, m, d, 0, 0, 0, 0, time.Local) }
+	assert.Equal(t, 1, daysBetween(day(3, 5), day(3, 6)))
+	assert.Equal(t, 10, daysBetween(day(3, 1), day(3, 11)))
+	assert.Equal(t, 29, daysBetween(day(2, 1), day(3, 1)), "Leap year February")
+	assert.Equal(t, 0, daysBetween(day(3, 5), day(3, 5)))
+}
+
+func TestSpendingAverages(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+	for _, e := range []struct {
+		amount Cents
+		date   time.Time
+	}{
+		{5000, time.Date(2023, 3, 2, 10, 0, 0, 0, time.Local)},
+		{2500, time.Date(2023, 3, 5, 10, 0, 0, 0, time.Local)},
+		{9900, time.Date(2023, 4, 1, 10, 0, 0, 0, time.Local)},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Average", e.amount, "Food", e.date, accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	get := func(query string) SpendingAverages {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/analytics/averages?account_id=%d&%s", accountID, query), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, query)
+
+		var avg SpendingAverages
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &avg))
+		return avg
+	}
+
+	// 75.00 over ten days, which touch two weeks
+	assert.Equal(t, SpendingAverages{
+		From: "2023-03-01", To: "2023-03-10", Days: 10, Weeks: 2,
+		Total: 7500, PerDay: 750, PerWeek: 3750,
+	}, get("from=2023-03-01&to=2023-03-10"))
+
+	// A single day is one day and one week, never zero
+	assert.Equal(t, SpendingAverages{
+		From: "2023-03-05", To: "2023-03-05", Days: 1, Weeks: 1,
+		Total: 2500, PerDay: 2500, PerWeek: 2500,
+	}, get("from=2023-03-05&to=2023-03-05"))
+
+	// Rounded to the nearest cent
+	avg := get("from=2023-03-01&to=2023-03-03")
+	assert.Equal(t, Cents(1667), avg.PerDay, "50.00 over three days")
+
+	req, _ := http.NewRequest("GET", "/api/analytics/averages?to=2023-03-10", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should require a start")
+}
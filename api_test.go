@@ -6,9 +6,13 @@ import (
 	"encoding/json"
 	"fmt"
 	"log"
+	"log/slog"
+	"net"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
 	"os"
+	"strings"
 	"testing"
 	"time"
 
@@ -40,18 +44,19 @@ func TestMain(m *testing.M) {
 	}
 	defer db.Close()
 
-	// Create the expenses table if it doesn't exist
+	// Bring the schema up to date
+	if err := (&App{DBClient: db}).initDB(ctx); err != nil {
+		log.Fatalf("Failed to migrate test database: %v", err)
+	}
+
+	// Categories used by the tests below, on top of the seeded defaults
 	_, err = db.Exec(ctx, `
-        CREATE TABLE IF NOT EXISTS expenses (
-            id SERIAL PRIMARY KEY,
-            description TEXT NOT NULL,
-            amount DECIMAL(10,2) NOT NULL,
-            category TEXT NOT NULL,
-            date TIMESTAMP NOT NULL
-        )
+        INSERT INTO categories (name)
+        VALUES ('Testing'), ('Test'), ('Updated Category'), ('Transportation')
+        ON CONFLICT (lower(name)) DO NOTHING
     `)
 	if err != nil {
-		log.Fatalf("Failed to create expenses table: %v", err)
+		log.Fatalf("Failed to seed test categories: %v", err)
 	}
 
 	// Clean up any test data
@@ -59,6 +64,10 @@ func TestMain(m *testing.M) {
 	if err != nil {
 		log.Fatalf("Failed to clean test database: %v", err)
 	}
+	_, err = db.Exec(ctx, "DELETE FROM expense_audit")
+	if err != nil {
+		log.Fatalf("Failed to clean test database: %v", err)
+	}
 
 	// Run tests
 	exitCode := m.Run()
@@ -84,13 +93,7 @@ func setupTestApp() (*App, *mux.Router) {
 	app := &App{DBClient: db}
 	app.initDB(ctx)
 
-	r := mux.NewRouter()
-	r.HandleFunc("/api/expenses", app.getExpenses).Methods("GET")
-	r.HandleFunc("/api/expenses", app.createExpense).Methods("POST")
-	r.HandleFunc("/api/expenses/{id}", app.updateExpense).Methods("PUT")
-	r.HandleFunc("/api/expenses/{id}", app.deleteExpense).Methods("DELETE")
-
-	return app, r
+	return app, app.routes()
 }
 
 func TestCreateExpense(t *testing.T) {
@@ -100,7 +103,7 @@ func TestCreateExpense(t *testing.T) {
 	// Test data
 	expense := Expense{
 		Description: "Test Expense",
-		Amount:      123.45,
+		Amount:      12345,
 		Category:    "Testing",
 		Date:        time.Now().Round(time.Second),
 	}
@@ -141,13 +144,13 @@ func TestGetExpenses(t *testing.T) {
 	testExpenses := []Expense{
 		{
 			Description: "Groceries",
-			Amount:      67.89,
+			Amount:      6789,
 			Category:    "Food",
 			Date:        time.Now().Add(-24 * time.Hour).Round(time.Second),
 		},
 		{
 			Description: "Gas",
-			Amount:      45.67,
+			Amount:      4567,
 			Category:    "Transportation",
 			Date:        time.Now().Round(time.Second),
 		},
@@ -194,7 +197,7 @@ func TestUpdateExpense(t *testing.T) {
 	// Add test data
 	testExpense := Expense{
 		Description: "Initial Expense",
-		Amount:      50.00,
+		Amount:      5000,
 		Category:    "Test",
 		Date:        time.Now().Round(time.Second),
 	}
@@ -210,7 +213,7 @@ func TestUpdateExpense(t *testing.T) {
 	updatedExpense := Expense{
 		ID:          expenseID,
 		Description: "Updated Expense",
-		Amount:      75.50,
+		Amount:      7550,
 		Category:    "Updated Category",
 		Date:        time.Now().Add(1 * time.Hour).Round(time.Second),
 	}
@@ -242,6 +245,49 @@ func TestUpdateExpense(t *testing.T) {
 	fmt.Printf("Updated expense with ID: %d\n", expenseID)
 }
 
+func TestExpenseTimestamps(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	date := time.Now().Add(-time.Hour).Round(time.Second)
+	id := insertTestExpense(t, app, Expense{Description: "Stamped", Amount: 1000, Category: "Food", Date: date})
+	untouched := insertTestExpense(t, app, Expense{Description: "Untouched", Amount: 1000, Category: "Food", Date: date})
+
+	var createdAt, updatedAt time.Time
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT created_at, updated_at FROM expenses WHERE id = $1", id).Scan(&createdAt, &updatedAt)
+	assert.NoError(t, err, "Should find the expense in DB")
+
+	// Update it
+	body, _ := json.Marshal(Expense{Description: "Stamped again", Amount: 1200, Category: "Food", Date: date})
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/expenses/%d", id), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var updated Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &updated))
+	assert.True(t, updated.UpdatedAt.After(updatedAt), "updated_at should advance")
+	assert.True(t, updated.CreatedAt.Equal(createdAt), "created_at should not change")
+
+	// Only the updated expense has changed since
+	since := url.QueryEscape(updated.UpdatedAt.Format(time.RFC3339Nano))
+	req, _ = http.NewRequest("GET", "/api/expenses?since="+since, nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	var ids []int
+	for _, e := range expenses {
+		ids = append(ids, e.ID)
+	}
+	assert.Contains(t, ids, id)
+	assert.NotContains(t, ids, untouched)
+}
+
 func TestDeleteExpense(t *testing.T) {
 	app, router := setupTestApp()
 	defer app.DBClient.Close()
@@ -249,7 +295,7 @@ func TestDeleteExpense(t *testing.T) {
 	// Add test data
 	testExpense := Expense{
 		Description: "Expense to Delete",
-		Amount:      99.99,
+		Amount:      9999,
 		Category:    "Test",
 		Date:        time.Now().Round(time.Second),
 	}
@@ -271,12 +317,12 @@ func TestDeleteExpense(t *testing.T) {
 	// Check response
 	assert.Equal(t, http.StatusNoContent, rr.Code, "Should return 204 No Content")
 
-	// Verify the expense was deleted from the database
-	var count int
+	// Verify the expense was soft-deleted in the database
+	var deleted bool
 	err = app.DBClient.QueryRow(ctx,
-		"SELECT COUNT(*) FROM expenses WHERE id = $1", expenseID).Scan(&count)
+		"SELECT deleted_at IS NOT NULL FROM expenses WHERE id = $1", expenseID).Scan(&deleted)
 	assert.NoError(t, err, "Should query the DB")
-	assert.Equal(t, 0, count, "Expense should be deleted from DB")
+	assert.True(t, deleted, "Expense should be marked deleted in DB")
 
 	fmt.Printf("Deleted expense with ID: %d\n", expenseID)
 }
@@ -291,7 +337,7 @@ func TestExpenseNotFound(t *testing.T) {
 	// Test update for non-existent expense
 	updatedExpense := Expense{
 		Description: "Non-existent Expense",
-		Amount:      100.00,
+		Amount:      10000,
 		Category:    "Test",
 		Date:        time.Now(),
 	}
@@ -341,3 +387,530 @@ func TestInvalidInput(t *testing.T) {
 
 	fmt.Println("Properly handled invalid JSON input")
 }
+
+func TestValidateExpense(t *testing.T) {
+	valid := Expense{
+		Description: "Coffee",
+		Amount:      350,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	}
+
+	tests := []struct {
+		name    string
+		mutate  func(e *Expense)
+		wantErr string
+	}{
+		{"valid baseline", func(e *Expense) {}, ""},
+		{"empty description", func(e *Expense) { e.Description = "  " }, "description is required"},
+		{"zero amount", func(e *Expense) { e.Amount = 0 }, "amount must be greater than zero"},
+		{"negative amount", func(e *Expense) { e.Amount = -1000 }, "amount must be greater than zero"},
+		{"amount too large", func(e *Expense) { e.Amount = 10000000000 }, "must not exceed"},
+		{"empty category", func(e *Expense) { e.Category = "" }, "category is required"},
+		{"zero date", func(e *Expense) { e.Date = time.Time{} }, "date is required"},
+		{"valid currency", func(e *Expense) { e.Currency = "EUR" }, ""},
+		{"unknown currency", func(e *Expense) { e.Currency = "XYZ" }, `currency "XYZ" is not a supported ISO 4217 code`},
+		{"lowercase currency", func(e *Expense) { e.Currency = "eur" }, "is not a supported ISO 4217 code"},
+		{"income", func(e *Expense) { e.Type = "income" }, ""},
+		{"unknown type", func(e *Expense) { e.Type = "transfer" }, `type "transfer" must be expense or income`},
+		{"notes", func(e *Expense) { n := "Split with Sam"; e.Notes = &n }, ""},
+		{"notes at the cap", func(e *Expense) { n := strings.Repeat("é", maxNotesLength); e.Notes = &n }, ""},
+		{"notes too long", func(e *Expense) { n := strings.Repeat("a", maxNotesLength+1); e.Notes = &n }, "notes must be at most 2000 characters"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			e := valid
+			tt.mutate(&e)
+			errs := e.Validate()
+			if tt.wantErr == "" {
+				assert.Empty(t, errs)
+				return
+			}
+			if assert.Len(t, errs, 1) {
+				assert.Contains(t, errs[0].Message, tt.wantErr)
+			}
+		})
+	}
+
+	// Every failing field should be reported at once
+	errs := Expense{}.Validate()
+	assert.Equal(t, []string{"description", "amount", "category", "date"}, fieldNames(errs))
+}
+
+func TestExpenseNotes(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	date := time.Now().Add(-time.Hour).Round(time.Second)
+	notes := "Paid in cash; reimbursable"
+
+	create := func(e Expense) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(e)
+		req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Set on create and returned on read
+	rr := create(Expense{Description: "Client lunch", Amount: 4200, Category: "Food", Date: date, Notes: &notes})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var created Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	if assert.NotNil(t, created.Notes) {
+		assert.Equal(t, notes, *created.Notes)
+	}
+
+	req, _ := http.NewRequest("GET", "/api/expenses/search?q=Client+lunch", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	found := false
+	for _, e := range expenses {
+		if e.ID == created.ID && assert.NotNil(t, e.Notes) {
+			found = true
+			assert.Equal(t, notes, *e.Notes)
+		}
+	}
+	assert.True(t, found, "search should return the expense with its notes")
+
+	// Omitted notes are left out of the response
+	rr = create(Expense{Description: "Bus fare", Amount: 250, Category: "Transport", Date: date})
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.NotContains(t, rr.Body.String(), `"notes"`)
+
+	// An update without notes keeps them; an empty string removes them
+	update := func(e Expense) Expense {
+		body, _ := json.Marshal(e)
+		req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/expenses/%d", created.ID), bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+		var updated Expense
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &updated))
+		return updated
+	}
+	updated := update(Expense{Description: "Client lunch", Amount: 4500, Category: "Food", Date: date})
+	if assert.NotNil(t, updated.Notes) {
+		assert.Equal(t, notes, *updated.Notes)
+	}
+	empty := ""
+	updated = update(Expense{Description: "Client lunch", Amount: 4500, Category: "Food", Date: date, Notes: &empty})
+	assert.Nil(t, updated.Notes)
+
+	// Too long
+	long := strings.Repeat("a", maxNotesLength+1)
+	rr = create(Expense{Description: "Conference", Amount: 30000, Category: "Travel", Date: date, Notes: &long})
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "notes must be at most")
+}
+
+func TestValidateExpenseFutureDates(t *testing.T) {
+	now := time.Date(2024, 6, 1, 12, 0, 0, 0, time.UTC)
+	e := Expense{Description: "Concert tickets", Amount: 8000, Category: "Entertainment"}
+
+	// Off by default: planned purchases are allowed
+	app := &App{Clock: fixedClock(now)}
+	e.Date = now.AddDate(0, 0, 7)
+	assert.Empty(t, app.validateExpense(e))
+
+	app.RejectFutureDates = true
+	errs := app.validateExpense(e)
+	assert.Equal(t, []FieldError{{"date", "date must not be in the future"}}, errs)
+
+	// A client clock running slightly ahead is tolerated
+	e.Date = now.Add(time.Minute)
+	assert.Empty(t, app.validateExpense(e))
+	e.Date = now.AddDate(0, 0, -1)
+	assert.Empty(t, app.validateExpense(e))
+}
+
+func TestCreateExpenseRejectsFutureDates(t *testing.T) {
+	// Validation happens before the database is touched
+	router := (&App{RejectFutureDates: true}).routes()
+
+	date := time.Now().AddDate(0, 1, 0).UTC().Format(time.RFC3339)
+	body := fmt.Sprintf(`{"description": "Flight", "amount": "350.00", "category": "Travel", "date": %q}`, date)
+	req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "date must not be in the future")
+}
+
+func fieldNames(errs []FieldError) []string {
+	var names []string
+	for _, fe := range errs {
+		names = append(names, fe.Field)
+	}
+	return names
+}
+
+func TestCreateExpenseReportsEveryInvalidField(t *testing.T) {
+	// Validation happens before the database is touched
+	router := (&App{}).routes()
+
+	body := []byte(`{"description": "", "amount": -5, "category": "Food", "date": "2024-01-02T15:04:05Z", "currency": "XYZ"}`)
+	req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+
+	var resp errorResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, []FieldError{
+		{"description", "description is required"},
+		{"amount", "amount must be greater than zero"},
+		{"currency", `currency "XYZ" is not a supported ISO 4217 code`},
+	}, resp.Errors)
+	assert.Equal(t, http.StatusUnprocessableEntity, resp.Error.Code)
+}
+
+func TestCreateExpenseValidation(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Negative amount and blank category
+	invalidJSON := []byte(`{"description": "Bad", "amount": -5, "category": "", "date": "2024-01-02T15:04:05Z"}`)
+
+	req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(invalidJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should return 422 Unprocessable Entity for invalid fields")
+	assert.Contains(t, rr.Body.String(), "amount must be greater than zero")
+	assert.Contains(t, rr.Body.String(), "category is required")
+
+	fmt.Println("Properly rejected invalid expense fields")
+}
+
+func TestGetExpensesIncludeFuture(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Add a planned purchase dated next week
+	ctx := context.Background()
+	var futureID int
+	err := app.DBClient.QueryRow(ctx,
+		"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4) RETURNING id",
+		"Planned Purchase", Cents(25000), "Shopping", time.Now().Add(7*24*time.Hour).Round(time.Second)).Scan(&futureID)
+	assert.NoError(t, err, "Should insert future expense")
+
+	containsID := func(expenses []Expense, id int) bool {
+		for _, e := range expenses {
+			if e.ID == id {
+				return true
+			}
+		}
+		return false
+	}
+
+	// Future-dated expenses are listed by default
+	req, _ := http.NewRequest("GET", "/api/expenses", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	assert.True(t, containsID(expenses, futureID), "Future expense should be listed by default")
+
+	// include_future=false hides them
+	req, _ = http.NewRequest("GET", "/api/expenses?include_future=false", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+	expenses = nil
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	assert.False(t, containsID(expenses, futureID), "Future expense should be excluded")
+
+	// Invalid flag values are rejected
+	req, _ = http.NewRequest("GET", "/api/expenses?include_future=maybe", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should return 400 for an invalid flag")
+
+	fmt.Printf("Future expense %d filtered correctly\n", futureID)
+}
+
+func TestJSONErrorResponses(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	assertErrorBody := func(rr *httptest.ResponseRecorder, status int) {
+		assert.Equal(t, status, rr.Code)
+		assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+		var body struct {
+			Error struct {
+				Code    int    `json:"code"`
+				Message string `json:"message"`
+			} `json:"error"`
+		}
+		err := json.Unmarshal(rr.Body.Bytes(), &body)
+		assert.NoError(t, err, "Should decode error JSON")
+		assert.Equal(t, status, body.Error.Code)
+		assert.NotEmpty(t, body.Error.Message)
+	}
+
+	// 404 when deleting an expense that does not exist
+	req, _ := http.NewRequest("DELETE", "/api/expenses/999999", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assertErrorBody(rr, http.StatusNotFound)
+
+	// 400 for a malformed body
+	req, _ = http.NewRequest("POST", "/api/expenses", bytes.NewBufferString("{not json"))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assertErrorBody(rr, http.StatusBadRequest)
+
+	fmt.Println("Error responses use the JSON envelope")
+}
+
+func TestSoftDeleteAndRestoreExpense(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Add test data
+	ctx := context.Background()
+	var expenseID int
+	err := app.DBClient.QueryRow(ctx,
+		"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4) RETURNING id",
+		"Restorable", Cents(4200), "Test", time.Now().Add(-time.Hour).Round(time.Second)).Scan(&expenseID)
+	assert.NoError(t, err, "Should insert test expense")
+
+	listed := func() bool {
+		req, _ := http.NewRequest("GET", "/api/expenses", nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var expenses []Expense
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+		for _, e := range expenses {
+			if e.ID == expenseID {
+				return true
+			}
+		}
+		return false
+	}
+	assert.True(t, listed(), "Expense should be listed before delete")
+
+	// Delete hides it from the list
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/expenses/%d", expenseID), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code, "Should return 204 No Content")
+	assert.False(t, listed(), "Deleted expense should not be listed")
+
+	// Deleting twice is a 404
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/expenses/%d", expenseID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Should return 404 for an already deleted expense")
+
+	// Restore brings it back
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/expenses/%d/restore", expenseID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+	var restored Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &restored))
+	assert.Equal(t, expenseID, restored.ID)
+	assert.True(t, listed(), "Restored expense should be listed again")
+
+	// Restoring a live expense is a 404
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/expenses/%d/restore", expenseID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Should return 404 when nothing to restore")
+
+	fmt.Printf("Soft-deleted and restored expense with ID: %d\n", expenseID)
+}
+
+func TestGetExpensesSort(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	for _, amount := range []Cents{3000, 1000, 2000} {
+		_, err := app.DBClient.Exec(context.Background(),
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Sorted", amount, "Food", time.Now().Round(time.Second), accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses?account_id=%d&sort=amount", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	var amounts []Cents
+	for _, e := range expenses {
+		amounts = append(amounts, e.Amount)
+	}
+	assert.Equal(t, []Cents{1000, 2000, 3000}, amounts, "Should order by ascending amount")
+
+	req, _ = http.NewRequest("GET", "/api/expenses?sort=description", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject an unknown sort key")
+}
+
+func TestGetExpensesMultiSort(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	today := time.Now().Add(-time.Hour).Round(time.Second)
+	for _, e := range []struct {
+		amount Cents
+		date   time.Time
+	}{
+		{3000, today},
+		{2000, today.AddDate(0, 0, -1)},
+		{1000, today},
+	} {
+		_, err := app.DBClient.Exec(context.Background(),
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Sorted", e.amount, "Food", e.date, accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Newest first, cheapest first within a day
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses?account_id=%d&sort=-date,amount", accountID), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	var amounts []Cents
+	for _, e := range expenses {
+		amounts = append(amounts, e.Amount)
+	}
+	assert.Equal(t, []Cents{1000, 3000, 2000}, amounts)
+
+	// Paging through the same order one row at a time agrees
+	var paged []Cents
+	cursor := ""
+	for range 4 {
+		target := fmt.Sprintf("/api/expenses?account_id=%d&sort=-date,amount&paginated=true&limit=1", accountID)
+		if cursor != "" {
+			target += "&cursor=" + cursor
+		}
+		req, _ := http.NewRequest("GET", target, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code)
+
+		var page expensePage
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+		for _, e := range page.Data {
+			paged = append(paged, e.Amount)
+		}
+		if page.Pagination.NextCursor == nil {
+			break
+		}
+		cursor = *page.Pagination.NextCursor
+	}
+	assert.Equal(t, amounts, paged)
+
+	req, _ = http.NewRequest("GET", "/api/expenses?sort=-date,amount;DROP%20TABLE%20expenses", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject an injected sort key")
+}
+
+func TestGetExpensesAmountRange(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	for _, amount := range []Cents{500, 1000, 2500, 5000} {
+		_, err := app.DBClient.Exec(context.Background(),
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Ranged", amount, "Food", time.Now().Round(time.Second), accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses?account_id=%d&min_amount=10&max_amount=25.00&sort=amount", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	var amounts []Cents
+	for _, e := range expenses {
+		amounts = append(amounts, e.Amount)
+	}
+	assert.Equal(t, []Cents{1000, 2500}, amounts, "Should include both bounds")
+
+	req, _ = http.NewRequest("GET", "/api/expenses?min_amount=50&max_amount=10", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject an inverted range")
+}
+
+func TestNewPgRetriesUnreachableDatabase(t *testing.T) {
+	// Grab a free port and close it again so connections are refused
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.NoError(t, err)
+	port := l.Addr().(*net.TCPAddr).Port
+	l.Close()
+
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	defer slog.SetDefault(prev)
+
+	cfg := &DBConfig{
+		Host:              "127.0.0.1",
+		Port:              port,
+		UserName:          "nobody",
+		Password:          "nothing",
+		DBName:            "missing",
+		MaxConns:          1,
+		MaxConnLifeTime:   time.Minute,
+		MaxConnIdleTime:   time.Minute,
+		HealthCheckPeriod: time.Minute,
+		ConnectAttempts:   3,
+		ConnectRetryDelay: time.Millisecond,
+	}
+	_, err = NewPg(context.Background(), cfg)
+	assert.Error(t, err, "Should fail once every attempt has")
+	assert.Equal(t, 3, strings.Count(logs.String(), "Database ping failed"), "Should try the configured number of times")
+
+	// A cancelled context stops the retries instead of waiting them out
+	cfg.ConnectAttempts = 10
+	cfg.ConnectRetryDelay = time.Minute
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	start := time.Now()
+	_, err = NewPg(ctx, cfg)
+	assert.Error(t, err)
+	assert.Less(t, time.Since(start), 10*time.Second, "Should give up when the context ends")
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// ExpenseChange is one entry in an expense's history. Old and New are the
+// stored row before and after, with amounts in cents; Old is null for a
+// create and New for a hard delete. Changes lists the fields that differ.
+type ExpenseChange struct {
+	ID        int                    `json:"id"`
+	Action    string                 `json:"action"`
+	Old       map[string]any         `json:"old"`
+	New       map[string]any         `json:"new"`
+	Changes   map[string]FieldChange `json:"changes,omitempty"`
+	ChangedAt time.Time              `json:"changed_at"`
+}
+
+// FieldChange is a single field's value before and after a change.
+type FieldChange struct {
+	Old any `json:"old"`
+	New any `json:"new"`
+}
+
+// diffValues returns the fields whose values differ between before and
+// after. It is nil for creates and hard deletes, where one side is missing.
+func diffValues(before, after map[string]any) map[string]FieldChange {
+	if before == nil || after == nil {
+		return nil
+	}
+	changes := map[string]FieldChange{}
+	for field, o := range before {
+		if n := after[field]; !reflect.DeepEqual(o, n) {
+			changes[field] = FieldChange{Old: o, New: n}
+		}
+	}
+	for field, n := range after {
+		if _, ok := before[field]; !ok {
+			changes[field] = FieldChange{Old: nil, New: n}
+		}
+	}
+	return changes
+}
+
+// getExpenseHistory lists every recorded change to an expense, oldest
+// first. History is kept for deleted expenses too.
+func (app *App) getExpenseHistory(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	rows, err := app.DBClient.Query(r.Context(),
+		`SELECT id, action, old_values, new_values, changed_at
+		 FROM expense_audit WHERE expense_id=$1 ORDER BY id`, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	history := []ExpenseChange{}
+	for rows.Next() {
+		var c ExpenseChange
+		if err := rows.Scan(&c.ID, &c.Action, &c.Old, &c.New, &c.ChangedAt); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		c.Changes = diffValues(c.Old, c.New)
+		history = append(history, c)
+	}
+	if err := rows.Err(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Expenses from before auditing began have no history yet.
+	if len(history) == 0 {
+		var exists bool
+		err := app.DBClient.QueryRow(r.Context(),
+			"SELECT EXISTS (SELECT 1 FROM expenses WHERE id=$1)", id).Scan(&exists)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if !exists {
+			writeJSONError(w, http.StatusNotFound, "expense not found")
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, history)
+}
@@ -0,0 +1,90 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDiffValues(t *testing.T) {
+	before := map[string]any{"description": "Lunch", "amount": 12.5, "category": "Food"}
+	after := map[string]any{"description": "Lunch", "amount": 20.0, "category": "Food", "type": "expense"}
+
+	assert.Equal(t, map[string]FieldChange{
+		"amount": {Old: 12.5, New: 20.0},
+		"type":   {Old: nil, New: "expense"},
+	}, diffValues(before, after))
+
+	// Creates and hard deletes have nothing to compare
+	assert.Nil(t, diffValues(nil, after))
+	assert.Nil(t, diffValues(before, nil))
+}
+
+func historyRequest(router http.Handler, id int) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/%d/history", id), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestExpenseHistory(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	id := insertTestExpense(t, app, Expense{
+		Description: "Lunch",
+		Amount:      1250,
+		Category:    "Food",
+		Date:        time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC),
+	})
+
+	// Two separate edits
+	rr := patchRequest(router, id, `{"amount": 20}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	rr = patchRequest(router, id, `{"description": "Team lunch"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	rr = historyRequest(router, id)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var history []ExpenseChange
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+
+	var updates []ExpenseChange
+	for _, c := range history {
+		if c.Action == "update" {
+			updates = append(updates, c)
+		}
+	}
+	if assert.Len(t, updates, 2, "Each edit should be recorded once") {
+		assert.Equal(t, map[string]FieldChange{"amount": {Old: 1250.0, New: 2000.0}}, updates[0].Changes)
+		assert.Equal(t, map[string]FieldChange{"description": {Old: "Lunch", New: "Team lunch"}}, updates[1].Changes)
+	}
+	if assert.NotEmpty(t, history) {
+		assert.Equal(t, "create", history[0].Action, "History should start with the insert")
+		assert.Nil(t, history[0].Old)
+	}
+
+	// Deleting and restoring are recorded as such
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/expenses/%d", id), nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+	req, _ = http.NewRequest("POST", fmt.Sprintf("/api/expenses/%d/restore", id), nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	rr = historyRequest(router, id)
+	history = nil
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &history))
+	if assert.Len(t, history, 5) {
+		assert.Equal(t, "delete", history[3].Action)
+		assert.Equal(t, "restore", history[4].Action)
+	}
+
+	// Unknown expense
+	rr = historyRequest(router, 999999999)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+
+	"github.com/gorilla/mux"
+)
+
+const (
+	// defaultMaxBodyBytes caps request bodies unless MAX_BODY_BYTES says
+	// otherwise.
+	defaultMaxBodyBytes = 1 << 20
+
+	// maxBulkBodyBytes is the larger cap for the bulk import, which takes
+	// up to maxBulkExpenses expenses at once.
+	maxBulkBodyBytes = 10 << 20
+)
+
+// bodyLimitOverrides are per-route body caps, keyed by route template, for
+// endpoints that legitimately take more than the default.
+var bodyLimitOverrides = map[string]int64{
+	"/api/expenses/bulk":         maxBulkBodyBytes,
+	"/api/expenses/{id}/receipt": maxReceiptBodyBytes,
+}
+
+// maxBodyBytes returns the body cap for the given route template.
+func (app *App) maxBodyBytes(route string) int64 {
+	if limit, ok := bodyLimitOverrides[route]; ok {
+		return limit
+	}
+	if app.MaxBodyBytes > 0 {
+		return app.MaxBodyBytes
+	}
+	return defaultMaxBodyBytes
+}
+
+// bodyLimitMiddleware caps how much of a request body handlers can read.
+// A declared Content-Length over the cap is refused up front; a body that
+// turns out larger fails the handler's read, which writeDecodeError turns
+// into a 413.
+func (app *App) bodyLimitMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := ""
+		if current := mux.CurrentRoute(r); current != nil {
+			route, _ = current.GetPathTemplate()
+		}
+		limit := app.maxBodyBytes(route)
+
+		if r.ContentLength > limit {
+			writeJSONError(w, http.StatusRequestEntityTooLarge, bodyTooLargeMessage(limit))
+			return
+		}
+		r.Body = http.MaxBytesReader(w, r.Body, limit)
+		next.ServeHTTP(w, r)
+	})
+}
+
+func bodyTooLargeMessage(limit int64) string {
+	return fmt.Sprintf("request body must not exceed %d bytes", limit)
+}
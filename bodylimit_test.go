@@ -0,0 +1,47 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBodyLimit(t *testing.T) {
+	router := (&App{MaxBodyBytes: 256}).routes()
+	body := fmt.Sprintf(`{"description": %q, "amount": 1, "category": "Food"}`, strings.Repeat("x", 1024))
+
+	// A declared length over the cap is refused before the handler runs
+	req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "Should return 413")
+
+	var resp errorResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Contains(t, resp.Error.Message, "256 bytes")
+
+	// So is a body of unknown length that turns out too big
+	req, _ = http.NewRequest("POST", "/api/expenses", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	req.ContentLength = -1
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "Should return 413 while reading")
+}
+
+func TestMaxBodyBytes(t *testing.T) {
+	app := &App{}
+	assert.Equal(t, int64(defaultMaxBodyBytes), app.maxBodyBytes("/api/expenses"))
+	assert.Equal(t, int64(maxBulkBodyBytes), app.maxBodyBytes("/api/expenses/bulk"))
+
+	app.MaxBodyBytes = 4096
+	assert.Equal(t, int64(4096), app.maxBodyBytes("/api/expenses"))
+	assert.Equal(t, int64(maxBulkBodyBytes), app.maxBodyBytes("/api/expenses/bulk"), "Should keep the import's larger cap")
+}
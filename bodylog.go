@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"regexp"
+)
+
+// defaultBodyLogLimit caps how much of each body is logged when
+// LOG_BODIES_MAX_BYTES is not set.
+const defaultBodyLogLimit = 4096
+
+// passwordFieldPattern matches a JSON string member whose key mentions a
+// password, e.g. "password" or "new_password". It works on truncated bodies
+// too, which a JSON parser would reject, including a value cut off by the
+// size cap.
+var passwordFieldPattern = regexp.MustCompile(`(?i)("[^"]*password[^"]*"\s*:\s*)"(?:[^"\\]|\\.)*(?:"|\\?$)`)
+
+// redactBody masks password values in a logged body.
+func redactBody(b []byte) string {
+	return passwordFieldPattern.ReplaceAllString(string(b), `$1"[REDACTED]"`)
+}
+
+// limitedBuffer keeps the first max bytes written to it and counts the rest.
+type limitedBuffer struct {
+	buf       bytes.Buffer
+	max       int
+	truncated bool
+}
+
+func (b *limitedBuffer) Write(p []byte) (int, error) {
+	if room := b.max - b.buf.Len(); room > 0 {
+		if len(p) > room {
+			b.buf.Write(p[:room])
+			b.truncated = true
+		} else {
+			b.buf.Write(p)
+		}
+	} else if len(p) > 0 {
+		b.truncated = true
+	}
+	return len(p), nil
+}
+
+// bodyCapture tees the bytes a handler reads from the request body.
+type bodyCapture struct {
+	io.ReadCloser
+	copy *limitedBuffer
+}
+
+func (c *bodyCapture) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.copy.Write(p[:n])
+	return n, err
+}
+
+// responseCapture tees the bytes a handler writes to the client.
+type responseCapture struct {
+	*statusRecorder
+	copy *limitedBuffer
+}
+
+func (c *responseCapture) Write(p []byte) (int, error) {
+	c.copy.Write(p)
+	return c.statusRecorder.Write(p)
+}
+
+// bodyLoggingMiddleware logs request and response bodies at debug level,
+// capped at maxBytes each with password fields redacted. It is meant for
+// reproducing client bugs and is only installed when LOG_BODIES is set.
+func bodyLoggingMiddleware(maxBytes int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			reqBody := &limitedBuffer{max: maxBytes}
+			if r.Body != nil {
+				r.Body = &bodyCapture{ReadCloser: r.Body, copy: reqBody}
+			}
+			respBody := &limitedBuffer{max: maxBytes}
+			capture := &responseCapture{statusRecorder: &statusRecorder{ResponseWriter: w}, copy: respBody}
+
+			next.ServeHTTP(capture, r)
+
+			slog.DebugContext(r.Context(), "Request bodies",
+				"method", r.Method,
+				"path", r.URL.Path,
+				"status", capture.Status(),
+				"request_body", redactBody(reqBody.buf.Bytes()),
+				"request_truncated", reqBody.truncated,
+				"response_body", redactBody(respBody.buf.Bytes()),
+				"response_truncated", respBody.truncated,
+			)
+		})
+	}
+}
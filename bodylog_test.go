@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRedactBody(t *testing.T) {
+	tests := []struct {
+		in, want string
+	}{
+		{`{"username":"alice","password":"hunter2"}`, `{"username":"alice","password":"[REDACTED]"}`},
+		{`{"current_password": "a\"b", "new_password":"x"}`, `{"current_password": "[REDACTED]", "new_password":"[REDACTED]"}`},
+		{`{"Password":"trunc`, `{"Password":"[REDACTED]"`},
+		{`{"description":"password reset fee","amount":5}`, `{"description":"password reset fee","amount":5}`},
+	}
+
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, redactBody([]byte(tt.in)), tt.in)
+	}
+}
+
+func TestBodyLoggingMiddleware(t *testing.T) {
+	var logs bytes.Buffer
+	previous := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug})))
+	defer slog.SetDefault(previous)
+
+	handler := bodyLoggingMiddleware(16)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+
+	reqBody := `{"password":"secret","description":"long enough to be truncated"}`
+	req, _ := http.NewRequest("POST", "/api/expenses", strings.NewReader(reqBody))
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	// The handler still sees the whole body and the client gets the whole response
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, reqBody, rr.Body.String())
+
+	out := logs.String()
+	assert.Contains(t, out, "request_truncated=true")
+	assert.Contains(t, out, "response_truncated=true")
+	assert.Contains(t, out, "status=201")
+	assert.NotContains(t, out, "sec", "Truncated password must not leak")
+}
@@ -0,0 +1,350 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+)
+
+// monthLayout is the YYYY-MM format budgets use for their month.
+const monthLayout = "2006-01"
+
+// Budget periods. A category has either monthly budgets or an annual one
+// for any given year, never both.
+const (
+	budgetMonthly = "monthly"
+	budgetAnnual  = "annual"
+)
+
+// Budget is a spending limit for one category over a calendar month or,
+// for annual budgets, a calendar year. Monthly budgets set Month; annual
+// budgets set Year. Budgets are in defaultCurrency, and only spending in
+// that currency counts against them.
+type Budget struct {
+	ID       int    `json:"id"`
+	Category string `json:"category"`
+	Period   string `json:"period"`
+	Month    string `json:"month,omitempty"`
+	Year     int    `json:"year,omitempty"`
+	Amount   Cents  `json:"amount"`
+}
+
+// BudgetStatus is a budget alongside what has actually been spent against
+// it. For annual budgets Spent is year-to-date.
+type BudgetStatus struct {
+	Budget
+	Spent     Cents `json:"spent"`
+	Remaining Cents `json:"remaining"`
+	Exceeded  bool  `json:"exceeded"`
+}
+
+// setSpent records what was spent against the budget.
+func (s *BudgetStatus) setSpent(spent Cents) {
+	s.Spent = spent
+	s.Remaining = s.Amount - spent
+	s.Exceeded = spent > s.Amount
+}
+
+// parseMonth parses a YYYY-MM string into the first day of that month.
+func parseMonth(v string) (time.Time, error) {
+	t, err := time.Parse(monthLayout, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid month %q: must be YYYY-MM", v)
+	}
+	return t, nil
+}
+
+// start returns the first day the budget covers, which is what the month
+// column stores.
+func (b Budget) start() (time.Time, error) {
+	switch b.Period {
+	case budgetMonthly:
+		return parseMonth(b.Month)
+	case budgetAnnual:
+		if b.Year < 1 || b.Year > 9999 {
+			return time.Time{}, fmt.Errorf("invalid year %d", b.Year)
+		}
+		return time.Date(b.Year, time.January, 1, 0, 0, 0, 0, time.UTC), nil
+	default:
+		return time.Time{}, fmt.Errorf("invalid period %q: must be %s or %s", b.Period, budgetMonthly, budgetAnnual)
+	}
+}
+
+// setBudget creates the budget for a category and period, or replaces its
+// limit if one is already set. A monthly budget is refused while the
+// category has an annual budget for that year, and vice versa.
+func (app *App) setBudget(w http.ResponseWriter, r *http.Request) {
+	var budget Budget
+	if err := json.NewDecoder(r.Body).Decode(&budget); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	if budget.Period == "" {
+		budget.Period = budgetMonthly
+	}
+	start, err := budget.start()
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if budget.Amount <= 0 || budget.Amount > maxAmountCents {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid budget: amount must be between 0.01 and %s", maxAmountCents))
+		return
+	}
+
+	category, err := app.resolveCategory(r.Context(), budget.Category)
+	if errors.Is(err, errUnknownCategory) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	budget.Category = category
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Serialise budget changes per category so two requests can't slip a
+	// monthly and an annual budget in side by side.
+	if _, err := tx.Exec(r.Context(),
+		"SELECT pg_advisory_xact_lock(hashtext(lower($1)))", budget.Category); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var conflict bool
+	err = tx.QueryRow(r.Context(), `
+		SELECT EXISTS (
+			SELECT 1 FROM budgets
+			WHERE lower(category) = lower($1)
+				AND period <> $2
+				AND date_trunc('year', month) = date_trunc('year', $3::date)
+		)`, budget.Category, budget.Period, start).Scan(&conflict)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if conflict {
+		writeJSONError(w, http.StatusConflict,
+			fmt.Sprintf("%s already has a budget with a different period in %d", budget.Category, start.Year()))
+		return
+	}
+
+	err = tx.QueryRow(r.Context(),
+		`INSERT INTO budgets (category, period, month, amount) VALUES ($1, $2, $3, $4)
+		 ON CONFLICT (lower(category), period, month) DO UPDATE SET amount = EXCLUDED.amount
+		 RETURNING id`,
+		budget.Category, budget.Period, start, budget.Amount).Scan(&budget.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, budget)
+}
+
+// getBudgets reports the budgets in force for ?month= (default: the current
+// month): that month's monthly budgets, plus annual budgets for its year
+// measured year-to-date through the end of the month.
+func (app *App) getBudgets(w http.ResponseWriter, r *http.Request) {
+	monthParam := r.URL.Query().Get("month")
+	if monthParam == "" {
+		monthParam = app.now().Format(monthLayout)
+	}
+	month, err := parseMonth(monthParam)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	yearStart := time.Date(month.Year(), time.January, 1, 0, 0, 0, 0, time.UTC)
+	monthEnd := month.AddDate(0, 1, 0)
+
+	// Every budget's window runs from its own start (the month, or January
+	// for annual budgets) to the end of the requested month. Refunds reduce
+	// what was spent and income doesn't count.
+	budgets := []BudgetStatus{}
+	err = app.queryWithTimeout(r.Context(), "budgets", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx, `
+			SELECT b.id, b.category, b.period, b.month, b.amount, COALESCE(SUM(CASE WHEN e.refund_of IS NULL THEN e.amount ELSE -e.amount END), 0)::bigint
+			FROM budgets b
+			LEFT JOIN expenses e
+				ON lower(e.category) = lower(b.category)
+				AND e.date >= b.month
+				AND e.date < $3
+				AND e.deleted_at IS NULL
+				AND e.type = 'expense'
+				AND e.currency = $4
+			WHERE (b.period = 'monthly' AND b.month = $1)
+				OR (b.period = 'annual' AND b.month = $2)
+			GROUP BY b.id
+			ORDER BY b.category`, month, yearStart, monthEnd, defaultCurrency)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var s BudgetStatus
+			var start time.Time
+			var spent Cents
+			if err := rows.Scan(&s.ID, &s.Category, &s.Period, &start, &s.Amount, &spent); err != nil {
+				return err
+			}
+			if s.Period == budgetAnnual {
+				s.Year = start.Year()
+			} else {
+				s.Month = start.Format(monthLayout)
+			}
+			s.setSpent(spent)
+			budgets = append(budgets, s)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, budgets)
+}
+
+// queueBudgetAlerts runs checkBudgetAlert for expenses on a background
+// goroutine, so a slow mail server never holds up the request or worker
+// that stored them. The checks outlive ctx's cancellation but keep its
+// values for logging.
+func (app *App) queueBudgetAlerts(ctx context.Context, expenses ...Expense) {
+	if app.Mailer == nil || app.BudgetAlertTo == "" || len(expenses) == 0 {
+		return
+	}
+
+	ctx = context.WithoutCancel(ctx)
+	app.budgetAlerts.Add(1)
+	go func() {
+		defer app.budgetAlerts.Done()
+		for _, e := range expenses {
+			app.checkBudgetAlert(ctx, e)
+		}
+	}()
+}
+
+// waitForBudgetAlerts waits for queued budget alerts to finish and reports
+// whether they did before ctx was done.
+func (app *App) waitForBudgetAlerts(ctx context.Context) bool {
+	done := make(chan struct{})
+	go func() {
+		app.budgetAlerts.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
+
+// checkBudgetAlert emails an alert when e has taken its category over that
+// month's budget. Each budget alerts at most once, however much more is
+// spent afterwards. Failures are logged rather than returned: the expense
+// has already been stored.
+func (app *App) checkBudgetAlert(ctx context.Context, e Expense) {
+	if app.Mailer == nil || app.BudgetAlertTo == "" || e.Type != expenseTypeExpense || e.RefundOf != nil ||
+		e.Currency != defaultCurrency {
+		return
+	}
+
+	var budget BudgetStatus
+	var month time.Time
+	var spent Cents
+	err := app.queryWithTimeout(ctx, "budget alert", func(ctx context.Context) error {
+		return app.DBClient.QueryRow(ctx, `
+			SELECT b.id, b.category, b.month, b.amount, COALESCE(SUM(CASE WHEN e.refund_of IS NULL THEN e.amount ELSE -e.amount END), 0)::bigint
+			FROM budgets b
+			LEFT JOIN expenses e
+				ON lower(e.category) = lower(b.category)
+				AND e.date >= b.month
+				AND e.date < b.month + INTERVAL '1 month'
+				AND e.deleted_at IS NULL
+				AND e.type = 'expense'
+				AND e.currency = $3
+			WHERE b.period = 'monthly'
+				AND lower(b.category) = lower($1)
+				AND b.month = date_trunc('month', $2::timestamp)::date
+			GROUP BY b.id`, e.Category, e.Date, defaultCurrency).Scan(&budget.ID, &budget.Category, &month, &budget.Amount, &spent)
+	})
+	if errors.Is(err, pgx.ErrNoRows) {
+		return
+	}
+	if err != nil {
+		slog.ErrorContext(ctx, "Error checking budget", "category", e.Category, "error", err)
+		return
+	}
+	budget.setSpent(spent)
+	if !budget.Exceeded {
+		return
+	}
+	budget.Month = month.Format(monthLayout)
+
+	// Claiming the alert first means concurrent expenses can't both send it.
+	// This runs in the background with no request deadline, so it is
+	// bounded like the lookup.
+	var tag pgconn.CommandTag
+	err = app.queryWithTimeout(ctx, "budget alert claim", func(ctx context.Context) error {
+		var err error
+		tag, err = app.DBClient.Exec(ctx,
+			"INSERT INTO budget_alerts (budget_id) VALUES ($1) ON CONFLICT DO NOTHING", budget.ID)
+		return err
+	})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error recording budget alert", "budget_id", budget.ID, "error", err)
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		return
+	}
+
+	// The send and the release of the claim get their own deadline: cut off
+	// with the request, a failed send would leave the claim in place and the
+	// budget would never alert again.
+	sendCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailTimeout)
+	defer cancel()
+	if err := app.Mailer.Send(sendCtx, budgetAlertEmail(app.BudgetAlertTo, budget)); err != nil {
+		slog.ErrorContext(ctx, "Error sending budget alert", "budget_id", budget.ID, "error", err)
+		// Release the claim so the next expense tries again.
+		releaseCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), mailTimeout)
+		defer cancel()
+		if _, err := app.DBClient.Exec(releaseCtx, "DELETE FROM budget_alerts WHERE budget_id=$1", budget.ID); err != nil {
+			slog.ErrorContext(ctx, "Error releasing budget alert", "budget_id", budget.ID, "error", err)
+		}
+	}
+}
+
+func budgetAlertEmail(to string, b BudgetStatus) Email {
+	return Email{
+		To:      to,
+		Subject: fmt.Sprintf("Budget exceeded: %s (%s)", b.Category, b.Month),
+		Body: fmt.Sprintf("You have spent %s against your %s %s budget for %s.\n",
+			b.Spent, b.Amount, b.Category, b.Month),
+	}
+}
@@ -0,0 +1,411 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBudgetsOverspendFlag(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+	month := time.Date(2023, 7, 1, 0, 0, 0, 0, time.UTC)
+
+	// One category per case, each with a 100.00 limit
+	cases := []struct {
+		name     string
+		spend    []Cents
+		spent    Cents
+		exceeded bool
+	}{
+		{fmt.Sprintf("Under %d", suffix), []Cents{6000}, 6000, false},
+		{fmt.Sprintf("Exact %d", suffix), []Cents{4000, 6000}, 10000, false},
+		{fmt.Sprintf("Over %d", suffix), []Cents{10000, 5000}, 15000, true},
+	}
+
+	for _, c := range cases {
+		_, err := app.DBClient.Exec(ctx, "INSERT INTO categories (name) VALUES ($1)", c.name)
+		assert.NoError(t, err, "Should insert category")
+
+		body, _ := json.Marshal(Budget{Category: c.name, Month: "2023-07", Amount: 10000})
+		req, _ := http.NewRequest("POST", "/api/budgets", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "Should set budget")
+
+		for i, amount := range c.spend {
+			_, err := app.DBClient.Exec(ctx,
+				"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4)",
+				"Budget spend", amount, c.name, month.AddDate(0, 0, i+3))
+			assert.NoError(t, err, "Should insert test expense")
+		}
+
+		// Spending in the following month must not count
+		_, err = app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4)",
+			"Next month", Cents(50000), c.name, month.AddDate(0, 1, 0))
+		assert.NoError(t, err, "Should insert test expense")
+
+		// Nor must spending in another currency
+		_, err = app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, currency) VALUES ($1, $2, $3, $4, $5)",
+			"Abroad", Cents(50000), c.name, month.AddDate(0, 0, 1), "EUR")
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET", "/api/budgets?month=2023-07", nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	// Check response
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+	var budgets []BudgetStatus
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &budgets), "Should decode response JSON")
+
+	byCategory := map[string]BudgetStatus{}
+	for _, b := range budgets {
+		byCategory[b.Category] = b
+	}
+
+	for _, c := range cases {
+		b, ok := byCategory[c.name]
+		if assert.True(t, ok, "Budget for %s should be listed", c.name) {
+			assert.Equal(t, Cents(10000), b.Amount)
+			assert.Equal(t, c.spent, b.Spent, c.name)
+			assert.Equal(t, c.exceeded, b.Exceeded, c.name)
+			assert.Equal(t, "2023-07", b.Month)
+		}
+	}
+}
+
+func TestSetBudgetInvalid(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	for _, body := range []string{
+		`{"category": "Food", "month": "July", "amount": 100}`,
+		`{"category": "Food", "month": "2023-07", "amount": 0}`,
+		`{"category": "No Such Category", "month": "2023-07", "amount": 100}`,
+	} {
+		req, _ := http.NewRequest("POST", "/api/budgets", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestAnnualBudgetYearToDate(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	category := fmt.Sprintf("Travel %d", time.Now().UnixNano())
+	_, err := app.DBClient.Exec(ctx, "INSERT INTO categories (name) VALUES ($1)", category)
+	assert.NoError(t, err, "Should insert category")
+
+	body, _ := json.Marshal(Budget{Category: category, Period: budgetAnnual, Year: 2022, Amount: 100000})
+	req, _ := http.NewRequest("POST", "/api/budgets", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should set annual budget")
+
+	// Spending in February, in May, and in the previous December
+	for _, e := range []struct {
+		amount Cents
+		date   time.Time
+	}{
+		{30000, time.Date(2022, 2, 10, 0, 0, 0, 0, time.UTC)},
+		{25000, time.Date(2022, 5, 31, 23, 0, 0, 0, time.UTC)},
+		{99900, time.Date(2021, 12, 31, 0, 0, 0, 0, time.UTC)},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4)",
+			"Trip", e.amount, category, e.date)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	status := func(month string) BudgetStatus {
+		req, _ := http.NewRequest("GET", "/api/budgets?month="+month, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+		var budgets []BudgetStatus
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &budgets))
+		for _, b := range budgets {
+			if b.Category == category {
+				return b
+			}
+		}
+		t.Fatalf("annual budget for %s not listed in %s", category, month)
+		return BudgetStatus{}
+	}
+
+	// March only sees February's spending
+	march := status("2022-03")
+	assert.Equal(t, budgetAnnual, march.Period)
+	assert.Equal(t, 2022, march.Year)
+	assert.Equal(t, Cents(30000), march.Spent)
+	assert.Equal(t, Cents(70000), march.Remaining)
+
+	// May includes the last day of May
+	may := status("2022-05")
+	assert.Equal(t, Cents(55000), may.Spent)
+	assert.Equal(t, Cents(45000), may.Remaining)
+	assert.False(t, may.Exceeded)
+
+	// A monthly budget in the same year is refused
+	body, _ = json.Marshal(Budget{Category: category, Month: "2022-06", Amount: 10000})
+	req, _ = http.NewRequest("POST", "/api/budgets", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Should refuse mixing periods within a year")
+
+	// ...but allowed in another year
+	body, _ = json.Marshal(Budget{Category: category, Month: "2023-01", Amount: 10000})
+	req, _ = http.NewRequest("POST", "/api/budgets", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should allow a monthly budget in a different year")
+}
+
+// fakeMailer records messages instead of sending them.
+type fakeMailer struct {
+	mu   sync.Mutex
+	sent []Email
+}
+
+func (m *fakeMailer) Send(ctx context.Context, msg Email) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+func TestBudgetAlertSentOnce(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	mailer := &fakeMailer{}
+	app.Mailer = mailer
+	app.BudgetAlertTo = "me@example.com"
+
+	ctx := context.Background()
+	category := fmt.Sprintf("Alerts %d", time.Now().UnixNano())
+	_, err := app.DBClient.Exec(ctx, "INSERT INTO categories (name) VALUES ($1)", category)
+	assert.NoError(t, err, "Should insert category")
+
+	body, _ := json.Marshal(Budget{Category: category, Month: "2023-09", Amount: 10000})
+	req, _ := http.NewRequest("POST", "/api/budgets", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should set budget")
+
+	spend := func(amount Cents, day int) {
+		t.Helper()
+		body, _ := json.Marshal(Expense{
+			Description: "Alert spend",
+			Amount:      amount,
+			Category:    category,
+			Date:        time.Date(2023, 9, day, 12, 0, 0, 0, time.UTC),
+		})
+		req, _ := http.NewRequest("POST", "/api/expenses?force=true", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusCreated, rr.Code, "Should create expense")
+		awaitBudgetAlerts(t, app)
+	}
+
+	// Reaching the limit exactly is not over it
+	spend(6000, 1)
+	spend(4000, 2)
+	assert.Empty(t, mailer.sent, "Should not alert while within budget")
+
+	// Crossing it alerts, and spending more doesn't alert again
+	spend(1000, 3)
+	spend(2500, 4)
+	if assert.Len(t, mailer.sent, 1, "Should alert exactly once") {
+		assert.Equal(t, "me@example.com", mailer.sent[0].To)
+		assert.Contains(t, mailer.sent[0].Subject, category)
+		assert.Contains(t, mailer.sent[0].Body, "110.00")
+	}
+}
+
+// awaitBudgetAlerts waits for the alerts queued so far.
+func awaitBudgetAlerts(t *testing.T, app *App) {
+	t.Helper()
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if !app.waitForBudgetAlerts(ctx) {
+		t.Fatal("Budget alerts did not finish")
+	}
+}
+
+// blockingMailer holds every send until release is closed, like a mail
+// server that is slow to answer.
+type blockingMailer struct {
+	fakeMailer
+	release chan struct{}
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg Email) error {
+	<-m.release
+	return m.fakeMailer.Send(ctx, msg)
+}
+
+func TestBudgetAlertDoesNotHoldUpCreate(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	mailer := &blockingMailer{release: make(chan struct{})}
+	app.Mailer = mailer
+	app.BudgetAlertTo = "me@example.com"
+
+	ctx := context.Background()
+	category := fmt.Sprintf("Slow mail %d", time.Now().UnixNano())
+	_, err := app.DBClient.Exec(ctx, "INSERT INTO categories (name) VALUES ($1)", category)
+	assert.NoError(t, err, "Should insert category")
+	_, err = app.DBClient.Exec(ctx,
+		"INSERT INTO budgets (category, month, amount) VALUES ($1, $2, $3)",
+		category, time.Date(2023, 11, 1, 0, 0, 0, 0, time.UTC), Cents(1000))
+	assert.NoError(t, err, "Should insert budget")
+
+	body, _ := json.Marshal(Expense{
+		Description: "Over budget",
+		Amount:      2000,
+		Category:    category,
+		Date:        time.Date(2023, 11, 2, 12, 0, 0, 0, time.UTC),
+	})
+	req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should answer while the alert is still sending")
+
+	close(mailer.release)
+	awaitBudgetAlerts(t, app)
+	assert.Len(t, mailer.sent, 1, "Should send the alert afterwards")
+}
+
+func TestBudgetAlertFromBulkAndRecurring(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	mailer := &fakeMailer{}
+	app.Mailer = mailer
+	app.BudgetAlertTo = "me@example.com"
+
+	ctx := context.Background()
+	suffix := time.Now().UnixNano()
+	month := time.Date(2023, 12, 1, 0, 0, 0, 0, time.UTC)
+	bulkCategory := fmt.Sprintf("Bulk alert %d", suffix)
+	recurringCategory := fmt.Sprintf("Recurring alert %d", suffix)
+	for _, category := range []string{bulkCategory, recurringCategory} {
+		_, err := app.DBClient.Exec(ctx, "INSERT INTO categories (name) VALUES ($1)", category)
+		assert.NoError(t, err, "Should insert category")
+		_, err = app.DBClient.Exec(ctx,
+			"INSERT INTO budgets (category, month, amount) VALUES ($1, $2, $3)", category, month, Cents(5000))
+		assert.NoError(t, err, "Should insert budget")
+	}
+
+	// Two bulk expenses that only cross the budget together
+	rr := bulkRequest(router, fmt.Sprintf(`[
+		{"description": "Bulk alert 1", "amount": "30.00", "category": %[1]q, "date": "2023-12-03T10:00:00Z"},
+		{"description": "Bulk alert 2", "amount": "30.00", "category": %[1]q, "date": "2023-12-04T10:00:00Z"}
+	]`, bulkCategory))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	awaitBudgetAlerts(t, app)
+	if assert.Len(t, mailer.sent, 1, "Should alert for bulk-created expenses") {
+		assert.Contains(t, mailer.sent[0].Subject, bulkCategory)
+	}
+
+	// A recurring expense generated over the budget
+	now := time.Date(2023, 12, 10, 12, 0, 0, 0, time.UTC)
+	_, err := app.DBClient.Exec(ctx,
+		`INSERT INTO recurring_expenses (description, amount, category, interval, next_run)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		fmt.Sprintf("Recurring alert %d", suffix), Cents(6000), recurringCategory, "monthly", now.Add(-time.Hour))
+	assert.NoError(t, err, "Should insert recurring expense")
+
+	_, err = app.generateDueRecurring(ctx, now)
+	assert.NoError(t, err)
+	awaitBudgetAlerts(t, app)
+	if assert.Len(t, mailer.sent, 2, "Should alert for generated expenses") {
+		assert.Contains(t, mailer.sent[1].Subject, recurringCategory)
+	}
+}
+
+// cancellingMailer fails every send after cancelling the request it was
+// called from, as a request timeout mid-send would.
+type cancellingMailer struct {
+	cancel context.CancelFunc
+}
+
+func (m cancellingMailer) Send(ctx context.Context, msg Email) error {
+	m.cancel()
+	return errors.New("connection reset")
+}
+
+func TestBudgetAlertReleasedAfterCancelledSend(t *testing.T) {
+	app, _ := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	category := fmt.Sprintf("Cancelled %d", time.Now().UnixNano())
+	_, err := app.DBClient.Exec(ctx, "INSERT INTO categories (name) VALUES ($1)", category)
+	assert.NoError(t, err, "Should insert category")
+
+	var budgetID int
+	err = app.DBClient.QueryRow(ctx,
+		"INSERT INTO budgets (category, month, amount) VALUES ($1, $2, $3) RETURNING id",
+		category, time.Date(2023, 10, 1, 0, 0, 0, 0, time.UTC), Cents(5000)).Scan(&budgetID)
+	assert.NoError(t, err, "Should insert budget")
+
+	e := Expense{
+		Description: "Over budget",
+		Amount:      8000,
+		Category:    category,
+		Date:        time.Date(2023, 10, 5, 12, 0, 0, 0, time.UTC),
+		Currency:    defaultCurrency,
+		Type:        expenseTypeExpense,
+	}
+	_, err = app.DBClient.Exec(ctx,
+		"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4)",
+		e.Description, e.Amount, e.Category, e.Date)
+	assert.NoError(t, err, "Should insert test expense")
+
+	reqCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	app.Mailer = cancellingMailer{cancel}
+	app.BudgetAlertTo = "me@example.com"
+	app.checkBudgetAlert(reqCtx, e)
+
+	var claimed bool
+	err = app.DBClient.QueryRow(ctx,
+		"SELECT EXISTS (SELECT 1 FROM budget_alerts WHERE budget_id=$1)", budgetID).Scan(&claimed)
+	assert.NoError(t, err)
+	assert.False(t, claimed, "Should release the claim so a later expense retries")
+}
@@ -0,0 +1,257 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxBulkExpenses caps how many expenses one bulk request may create.
+const maxBulkExpenses = 1000
+
+// maxBatchDeleteIDs caps how many expenses one batch delete may name.
+const maxBatchDeleteIDs = 1000
+
+// bulkResult is the body returned by a successful bulk create.
+type bulkResult struct {
+	Expenses          []Expense `json:"expenses"`
+	SkippedDuplicates int       `json:"skipped_duplicates"`
+}
+
+// batchDeleteRequest is the body of a batch delete.
+type batchDeleteRequest struct {
+	IDs []int `json:"ids"`
+}
+
+// batchDeleteResult reports how many of the requested expenses were
+// deleted. IDs that don't exist or were already deleted aren't counted.
+type batchDeleteResult struct {
+	Deleted int `json:"deleted"`
+}
+
+// findDuplicates returns the indexes of the expenses that match a live
+// expense already stored with the same date, amount and description. All
+// entries are checked in one query.
+func findDuplicates(ctx context.Context, tx pgx.Tx, expenses []Expense) (map[int]bool, error) {
+	descriptions := make([]string, len(expenses))
+	amounts := make([]int64, len(expenses))
+	dates := make([]time.Time, len(expenses))
+	for i, e := range expenses {
+		descriptions[i], amounts[i], dates[i] = e.Description, int64(e.Amount), e.Date
+	}
+
+	rows, err := tx.Query(ctx, `
+		SELECT c.i - 1
+		FROM unnest($1::text[], $2::bigint[], $3::timestamp[]) WITH ORDINALITY AS c(description, amount, date, i)
+		WHERE EXISTS (
+			SELECT 1 FROM expenses e
+			WHERE e.deleted_at IS NULL
+				AND e.date = c.date
+				AND e.amount = c.amount
+				AND e.description = c.description
+		)`, descriptions, amounts, dates)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	dupes := map[int]bool{}
+	for rows.Next() {
+		var i int
+		if err := rows.Scan(&i); err != nil {
+			return nil, err
+		}
+		dupes[i] = true
+	}
+	return dupes, rows.Err()
+}
+
+// createExpensesBulk creates every expense in a JSON array in a single
+// transaction, sending the inserts as one pgx.Batch. Either all of them are
+// created or none are: the first invalid entry fails the request with 422
+// and its index in the error body.
+//
+// Entries that duplicate an existing expense (same date, amount and
+// description) are skipped and counted, so re-importing an overlapping bank
+// file doesn't double it. ?allow_duplicates=true inserts them anyway.
+func (app *App) createExpensesBulk(w http.ResponseWriter, r *http.Request) {
+	allowDuplicates, err := parseBoolParam(r, "allow_duplicates", false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var expenses []Expense
+	if err := decodeStrict(r, &expenses); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if len(expenses) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "no expenses in request body")
+		return
+	}
+	if len(expenses) > maxBulkExpenses {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("too many expenses: at most %d per request", maxBulkExpenses))
+		return
+	}
+
+	// Check everything before touching the database. Categories repeat a
+	// lot in imports, so each name is only looked up once.
+	categories := map[string]string{}
+	for i := range expenses {
+		e := &expenses[i]
+		e.Currency = normalizeCurrency(e.Currency)
+		if errs := app.validateExpense(*e); len(errs) > 0 {
+			writeIndexedValidationErrors(w, i, errs)
+			return
+		}
+
+		category, ok := categories[e.Category]
+		if !ok {
+			category, err = app.resolveCategory(r.Context(), e.Category)
+			if errors.Is(err, errUnknownCategory) {
+				writeIndexedJSONError(w, http.StatusBadRequest, i, err.Error())
+				return
+			}
+			if err != nil {
+				writeJSONError(w, http.StatusInternalServerError, err.Error())
+				return
+			}
+			categories[e.Category] = category
+		}
+		e.Category = category
+
+		if e.Currency == "" {
+			e.Currency = defaultCurrency
+		}
+		if e.Type == "" {
+			e.Type = expenseTypeExpense
+		}
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	dupes := map[int]bool{}
+	if !allowDuplicates {
+		// Serialise deduplicating imports so two overlapping files sent at
+		// once can't both miss each other's rows.
+		if _, err := tx.Exec(r.Context(), "SELECT pg_advisory_xact_lock(hashtext('expense-import'))"); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if dupes, err = findDuplicates(r.Context(), tx, expenses); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// indexes maps each queued insert back to its position in the request.
+	var indexes []int
+	batch := &pgx.Batch{}
+	for i, e := range expenses {
+		if dupes[i] {
+			continue
+		}
+		indexes = append(indexes, i)
+		batch.Queue(
+			`INSERT INTO expenses (description, amount, category, date, account_id, currency, type, notes)
+			 VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, 0), default_account_id()), $6, $7, NULLIF($8, ''))
+			 RETURNING `+expenseColumns,
+			e.Description, e.Amount, e.Category, e.Date, e.AccountID, e.Currency, e.Type, e.Notes)
+	}
+
+	created := make([]Expense, len(indexes))
+	results := tx.SendBatch(r.Context(), batch)
+	for n, i := range indexes {
+		err := scanExpense(results.QueryRow(), &created[n])
+		if isPgError(err, pgForeignKeyViolation) {
+			results.Close()
+			writeIndexedJSONError(w, http.StatusBadRequest, i, "account does not exist")
+			return
+		}
+		if err != nil {
+			results.Close()
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+	if err := results.Close(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for n, i := range indexes {
+		if len(expenses[i].Tags) == 0 {
+			continue
+		}
+		if created[n].Tags, err = setExpenseTags(r.Context(), tx, created[n].ID, expenses[i].Tags); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, e := range created {
+		app.publishWebhookEvent(r.Context(), eventExpenseCreated, e)
+	}
+	app.queueBudgetAlerts(r.Context(), created...)
+
+	writeJSON(w, http.StatusCreated, bulkResult{Expenses: created, SkippedDuplicates: len(dupes)})
+}
+
+// deleteExpensesBatch soft deletes every live expense in the ids list in one
+// transaction, with their refunds and receipts as deleteExpense does.
+func (app *App) deleteExpensesBatch(w http.ResponseWriter, r *http.Request) {
+	var req batchDeleteRequest
+	if err := decodeStrict(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	if len(req.IDs) == 0 {
+		writeJSONError(w, http.StatusBadRequest, "no ids in request body")
+		return
+	}
+	if len(req.IDs) > maxBatchDeleteIDs {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("too many ids: at most %d per request", maxBatchDeleteIDs))
+		return
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var result batchDeleteResult
+	var receiptKeys []string
+	result.Deleted, receiptKeys, err = softDeleteExpenses(r.Context(), tx, req.IDs)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	for _, key := range receiptKeys {
+		app.deleteBlob(r, key)
+	}
+
+	writeJSON(w, http.StatusOK, result)
+}
@@ -0,0 +1,188 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func bulkRequest(router http.Handler, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/expenses/bulk", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBulkCreateExpenses(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	rr := bulkRequest(router, `[
+		{"description": "Bus fare", "amount": 2.50, "category": "transport", "date": "2024-02-01T08:00:00Z"},
+		{"description": "Dinner", "amount": 31.20, "category": "Food", "date": "2024-02-01T19:30:00Z", "currency": "EUR"},
+		{"description": "Cinema", "amount": 12.00, "category": "Entertainment", "date": "2024-02-02T20:00:00Z"}
+	]`)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should return 201 Created")
+
+	var result bulkResult
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	created := result.Expenses
+	if assert.Len(t, created, 3) {
+		for _, e := range created {
+			assert.NotZero(t, e.ID, "Each expense should get an ID")
+		}
+		assert.Equal(t, "Transport", created[0].Category, "Category should be canonicalised")
+		assert.Equal(t, "EUR", created[1].Currency)
+		assert.Equal(t, "Cinema", created[2].Description, "Order should be preserved")
+	}
+
+	fmt.Printf("Bulk created %d expenses\n", len(created))
+}
+
+func TestBulkCreateExpensesRollsBack(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	description := fmt.Sprintf("Bulk rollback %d", time.Now().UnixNano())
+	rr := bulkRequest(router, fmt.Sprintf(`[
+		{"description": %q, "amount": 5.00, "category": "Food", "date": "2024-02-01T08:00:00Z"},
+		{"description": %q, "amount": -1, "category": "Food", "date": "2024-02-01T08:00:00Z"}
+	]`, description, description))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should reject the batch")
+
+	var resp errorResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	if assert.NotNil(t, resp.Error.Index) {
+		assert.Equal(t, 1, *resp.Error.Index, "Should point at the invalid entry")
+	}
+	assert.Contains(t, resp.Error.Message, "amount must be greater than zero")
+
+	var count int
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM expenses WHERE description = $1", description).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count, "No expense from a rejected batch should be stored")
+
+	// A bad account is only caught by the insert, and still rolls back
+	rr = bulkRequest(router, fmt.Sprintf(`[
+		{"description": %q, "amount": 5.00, "category": "Food", "date": "2024-02-01T08:00:00Z"},
+		{"description": %q, "amount": 6.00, "category": "Food", "date": "2024-02-01T08:00:00Z", "account_id": 999999}
+	]`, description, description))
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	assert.Contains(t, rr.Body.String(), `"index":1`)
+
+	err = app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM expenses WHERE description = $1", description).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, count)
+}
+
+func TestBulkCreateSkipsDuplicates(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// The second file overlaps the first by one row
+	description := fmt.Sprintf("Bank import %d", time.Now().UnixNano())
+	first := fmt.Sprintf(`[
+		{"description": %q, "amount": 10.00, "category": "Food", "date": "2024-03-01T00:00:00Z"},
+		{"description": %q, "amount": 20.00, "category": "Food", "date": "2024-03-02T00:00:00Z"}
+	]`, description, description)
+	second := fmt.Sprintf(`[
+		{"description": %q, "amount": 20.00, "category": "Food", "date": "2024-03-02T00:00:00Z"},
+		{"description": %q, "amount": 30.00, "category": "Food", "date": "2024-03-03T00:00:00Z"}
+	]`, description, description)
+
+	rr := bulkRequest(router, first)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	rr = bulkRequest(router, second)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var result bulkResult
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.SkippedDuplicates, "Should skip the overlapping row")
+	if assert.Len(t, result.Expenses, 1) {
+		assert.Equal(t, Cents(3000), result.Expenses[0].Amount)
+	}
+
+	// The override imports the duplicate anyway
+	req, _ := http.NewRequest("POST", "/api/expenses/bulk?allow_duplicates=true", bytes.NewBufferString(second))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 0, result.SkippedDuplicates)
+	assert.Len(t, result.Expenses, 2)
+
+	var count int
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM expenses WHERE description = $1", description).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, count)
+}
+
+func batchDelete(router http.Handler, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/expenses/batch-delete", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestBatchDeleteExpenses(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	newExpense := func() int {
+		return insertTestExpense(t, app, Expense{
+			Description: "Batch delete",
+			Amount:      400,
+			Category:    "Food",
+			Date:        time.Now().Round(time.Second),
+		})
+	}
+	first, second, gone := newExpense(), newExpense(), newExpense()
+	_, err := app.DBClient.Exec(context.Background(), "UPDATE expenses SET deleted_at = NOW() WHERE id=$1", gone)
+	assert.NoError(t, err)
+
+	// Only the two live expenses count; the deleted and missing ids don't
+	rr := batchDelete(router, fmt.Sprintf(`{"ids": [%d, %d, %d, 999999999]}`, first, second, gone))
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var result batchDeleteResult
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 2, result.Deleted)
+
+	var live int
+	err = app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM expenses WHERE id = ANY($1) AND deleted_at IS NULL", []int{first, second}).Scan(&live)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, live, "Both expenses should be soft deleted")
+
+	// Repeating the request deletes nothing more
+	rr = batchDelete(router, fmt.Sprintf(`{"ids": [%d, %d]}`, first, second))
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 0, result.Deleted)
+}
+
+func TestBatchDeleteExpensesInvalid(t *testing.T) {
+	router := (&App{}).routes()
+
+	tooMany := make([]int, maxBatchDeleteIDs+1)
+	for i := range tooMany {
+		tooMany[i] = i + 1
+	}
+	tooManyJSON, _ := json.Marshal(batchDeleteRequest{IDs: tooMany})
+
+	for _, body := range []string{`{"ids": []}`, `{"id": [1]}`, `{"ids": "1,2"}`, string(tooManyJSON)} {
+		rr := batchDelete(router, body)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Category is one entry in the managed list of expense categories.
+type Category struct {
+	ID        int       `json:"id"`
+	Name      string    `json:"name"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// errUnknownCategory is returned by resolveCategory when the name is not in
+// the categories table.
+var errUnknownCategory = errors.New("unknown category")
+
+// categoryReferences are the tables that refer to categories by name.
+var categoryReferences = []string{"expenses", "recurring_expenses", "templates", "budgets"}
+
+// resolveCategory looks name up case-insensitively and returns the stored
+// spelling, so "food" is saved as "Food".
+func (app *App) resolveCategory(ctx context.Context, name string) (string, error) {
+	var canonical string
+	err := app.DBClient.QueryRow(ctx,
+		"SELECT name FROM categories WHERE lower(name) = lower($1)", strings.TrimSpace(name)).Scan(&canonical)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return "", fmt.Errorf("%w %q", errUnknownCategory, name)
+	}
+	if err != nil {
+		return "", err
+	}
+	return canonical, nil
+}
+
+func (app *App) getCategories(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DBClient.Query(r.Context(),
+		"SELECT id, name, created_at FROM categories ORDER BY name")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	categories := []Category{}
+	for rows.Next() {
+		var c Category
+		if err := rows.Scan(&c.ID, &c.Name, &c.CreatedAt); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		categories = append(categories, c)
+	}
+
+	writeJSON(w, http.StatusOK, categories)
+}
+
+func (app *App) createCategory(w http.ResponseWriter, r *http.Request) {
+	var category Category
+	if err := json.NewDecoder(r.Body).Decode(&category); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	category.Name = strings.TrimSpace(category.Name)
+	if category.Name == "" {
+		writeJSONError(w, http.StatusBadRequest, "invalid category: name is required")
+		return
+	}
+
+	err := app.DBClient.QueryRow(r.Context(),
+		"INSERT INTO categories (name) VALUES ($1) RETURNING id, created_at",
+		category.Name).Scan(&category.ID, &category.CreatedAt)
+	if isPgError(err, pgUniqueViolation) {
+		writeJSONError(w, http.StatusConflict, "a category with that name already exists")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, category)
+}
+
+func (app *App) deleteCategory(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	// Expenses reference categories by name, so check usage before deleting
+	// in the same transaction.
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var name string
+	err = tx.QueryRow(r.Context(),
+		"SELECT name FROM categories WHERE id=$1 FOR UPDATE", id).Scan(&name)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "category not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Anything filed under the category keeps it alive; the recurring
+	// worker, for one, would go on generating expenses in it.
+	for _, table := range categoryReferences {
+		var inUse bool
+		err = tx.QueryRow(r.Context(),
+			"SELECT EXISTS (SELECT 1 FROM "+table+" WHERE lower(category) = lower($1))", name).Scan(&inUse)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if inUse {
+			writeJSONError(w, http.StatusConflict,
+				fmt.Sprintf("category is still used by %s", strings.ReplaceAll(table, "_", " ")))
+			return
+		}
+	}
+
+	if _, err := tx.Exec(r.Context(), "DELETE FROM categories WHERE id=$1", id); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
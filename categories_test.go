@@ -0,0 +1,147 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func createTestCategory(t *testing.T, router http.Handler, name string) Category {
+	t.Helper()
+
+	body, _ := json.Marshal(Category{Name: name})
+	req, _ := http.NewRequest("POST", "/api/categories", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should return 201 Created")
+
+	var category Category
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &category))
+	return category
+}
+
+func TestCreateCategory(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	name := fmt.Sprintf("Hobbies %d", time.Now().UnixNano())
+	category := createTestCategory(t, router, name)
+	assert.NotZero(t, category.ID, "Should return category with ID")
+	assert.Equal(t, name, category.Name)
+
+	// A differently-cased duplicate is a conflict
+	body, _ := json.Marshal(Category{Name: strings.ToLower(name)})
+	req, _ := http.NewRequest("POST", "/api/categories", bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Should return 409 for a duplicate name")
+
+	// Expenses using any casing are stored with the canonical name
+	expenseJSON, _ := json.Marshal(Expense{
+		Description: "Paint set",
+		Amount:      1800,
+		Category:    strings.ToUpper(name),
+		Date:        time.Now().Round(time.Second),
+	})
+	req, _ = http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(expenseJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var created Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.Equal(t, name, created.Category, "Should store the canonical category name")
+}
+
+func TestExpenseUnknownCategory(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	expenseJSON, _ := json.Marshal(Expense{
+		Description: "Mystery",
+		Amount:      500,
+		Category:    "Not A Real Category",
+		Date:        time.Now().Round(time.Second),
+	})
+	req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(expenseJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject an unknown category")
+	assert.Contains(t, rr.Body.String(), "unknown category")
+}
+
+func TestDeleteCategoryInUse(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	category := createTestCategory(t, router, fmt.Sprintf("Garden %d", time.Now().UnixNano()))
+
+	expenseJSON, _ := json.Marshal(Expense{
+		Description: "Seeds",
+		Amount:      425,
+		Category:    category.Name,
+		Date:        time.Now().Round(time.Second),
+	})
+	req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(expenseJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var created Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+
+	// Deleting while the expense exists is blocked
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/categories/%d", category.ID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Should return 409 while in use")
+
+	// Once nothing references it the category can go
+	_, err := app.DBClient.Exec(req.Context(), "DELETE FROM expenses WHERE id = $1", created.ID)
+	assert.NoError(t, err)
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/categories/%d", category.ID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code, "Should return 204 once unused")
+}
+
+func TestDeleteCategoryUsedByRecurringExpense(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	category := createTestCategory(t, router, fmt.Sprintf("Allotment %d", time.Now().UnixNano()))
+
+	var recurringID int
+	err := app.DBClient.QueryRow(context.Background(),
+		`INSERT INTO recurring_expenses (description, amount, category, interval, next_run)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		"Plot rent", Cents(2000), category.Name, "monthly", time.Now().AddDate(0, 1, 0)).Scan(&recurringID)
+	assert.NoError(t, err, "Should insert recurring expense")
+
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/categories/%d", category.ID), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Should return 409 while a recurring expense uses it")
+	assert.Contains(t, rr.Body.String(), "recurring expenses")
+
+	_, err = app.DBClient.Exec(context.Background(), "DELETE FROM recurring_expenses WHERE id = $1", recurringID)
+	assert.NoError(t, err)
+
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/categories/%d", category.ID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code, "Should return 204 once unused")
+}
@@ -0,0 +1,23 @@
+package main
+
+import "time"
+
+// Clock tells handlers and workers the current time. Tests swap in a fixed
+// clock so date-dependent behaviour is deterministic.
+type Clock interface {
+	Now() time.Time
+}
+
+// realClock is the wall clock.
+type realClock struct{}
+
+func (realClock) Now() time.Time { return time.Now() }
+
+// now returns the current time from app.Clock, or the wall clock when none
+// is set.
+func (app *App) now() time.Time {
+	if app.Clock == nil {
+		return time.Now()
+	}
+	return app.Clock.Now()
+}
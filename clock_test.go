@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// fixedClock always reports the same time.
+type fixedClock time.Time
+
+func (c fixedClock) Now() time.Time { return time.Time(c) }
+
+func TestAppNowDefaultsToWallClock(t *testing.T) {
+	before := time.Now()
+	now := (&App{}).now()
+	assert.False(t, now.Before(before), "Should use the wall clock when no Clock is set")
+
+	fixed := time.Date(2020, 6, 15, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, fixed, (&App{Clock: fixedClock(fixed)}).now())
+}
+
+func TestRelativePeriodUsesClock(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Pretend it is mid-June 2020, so last_month is May 2020
+	app.Clock = fixedClock(time.Date(2020, 6, 15, 9, 0, 0, 0, time.Local))
+
+	accountID := createTestAccount(t, app)
+	_, err := app.DBClient.Exec(context.Background(),
+		"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+		"Old groceries", Cents(4200), "Food", time.Date(2020, 5, 10, 12, 0, 0, 0, time.Local), accountID)
+	assert.NoError(t, err, "Should insert test expense")
+
+	// Create request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/top-categories?account_id=%d&period=last_month", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	var totals []CategoryTotal
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &totals))
+	if assert.Len(t, totals, 1, "Should resolve last_month against the injected clock") {
+		assert.Equal(t, Cents(4200), totals[0].Total)
+	}
+}
@@ -0,0 +1,345 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// LoadConfig builds the database configuration from the PG_* environment
+// variables, falling back to the local development defaults for anything
+// unset. It fails on values that do not parse as integers or durations.
+func LoadConfig() (*DBConfig, error) {
+	cfg := &DBConfig{
+		Host:              envOr("PG_HOST", "localhost"),
+		UserName:          envOr("PG_USERNAME", "admin"),
+		Password:          envOr("PG_PASSWORD", "admin"),
+		DBName:            envOr("PG_DBNAME", "expense_tracker"),
+		MaxConnLifeTime:   30 * time.Minute,
+		MaxConnIdleTime:   10 * time.Minute,
+		HealthCheckPeriod: 2 * time.Minute,
+	}
+
+	port, err := envInt("PG_PORT", 5432)
+	if err != nil {
+		return nil, err
+	}
+	cfg.Port = port
+
+	maxConns, err := envInt("PG_MAX_CONNS", 10)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MaxConns = int32(maxConns)
+
+	minConns, err := envInt("PG_MIN_CONNS", 2)
+	if err != nil {
+		return nil, err
+	}
+	cfg.MinConns = int32(minConns)
+
+	if cfg.ConnectAttempts, err = envInt("PG_CONNECT_ATTEMPTS", 5); err != nil {
+		return nil, err
+	}
+	if cfg.ConnectRetryDelay, err = envDuration("PG_CONNECT_RETRY_DELAY", time.Second); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate rejects pool settings pgxpool would misbehave with, so a bad
+// environment fails at startup with a clear message.
+func (c *DBConfig) Validate() error {
+	if c.MaxConns <= 0 {
+		return fmt.Errorf("invalid PG_MAX_CONNS %d: must be positive", c.MaxConns)
+	}
+	if c.MinConns < 0 {
+		return fmt.Errorf("invalid PG_MIN_CONNS %d: must not be negative", c.MinConns)
+	}
+	if c.MinConns > c.MaxConns {
+		return fmt.Errorf("invalid pool size: PG_MIN_CONNS %d is greater than PG_MAX_CONNS %d", c.MinConns, c.MaxConns)
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"max connection lifetime", c.MaxConnLifeTime},
+		{"max connection idle time", c.MaxConnIdleTime},
+		{"health check period", c.HealthCheckPeriod},
+		{"PG_CONNECT_RETRY_DELAY", c.ConnectRetryDelay},
+	} {
+		if d.value < 0 {
+			return fmt.Errorf("invalid %s %s: must not be negative", d.name, d.value)
+		}
+	}
+	return nil
+}
+
+// envOr returns the value of the environment variable key, or fallback when
+// it is unset or empty.
+func envOr(key, fallback string) string {
+	if v := os.Getenv(key); v != "" {
+		return v
+	}
+	return fallback
+}
+
+// envInt parses the environment variable key as an integer, returning
+// fallback when it is unset or empty.
+func envInt(key string, fallback int) (int, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return n, nil
+}
+
+// envBool parses the environment variable key as a boolean ("true", "1",
+// "false" and so on), returning fallback when it is unset or empty.
+func envBool(key string, fallback bool) (bool, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return false, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return b, nil
+}
+
+// BodyLogConfig controls the opt-in request/response body logging.
+type BodyLogConfig struct {
+	Enabled  bool
+	MaxBytes int
+}
+
+// LoadBodyLogConfig reads LOG_BODIES (off by default) and
+// LOG_BODIES_MAX_BYTES.
+func LoadBodyLogConfig() (BodyLogConfig, error) {
+	cfg := BodyLogConfig{}
+
+	enabled, err := envBool("LOG_BODIES", false)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Enabled = enabled
+
+	maxBytes, err := envInt("LOG_BODIES_MAX_BYTES", defaultBodyLogLimit)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.MaxBytes = maxBytes
+
+	return cfg, nil
+}
+
+// RateConfig points the exchange-rate provider at its API.
+type RateConfig struct {
+	BaseURL string
+	TTL     time.Duration
+}
+
+// LoadRateConfig reads EXCHANGE_RATE_URL and EXCHANGE_RATE_TTL (a Go
+// duration such as "30m").
+func LoadRateConfig() (RateConfig, error) {
+	cfg := RateConfig{BaseURL: envOr("EXCHANGE_RATE_URL", "https://api.frankfurter.app")}
+
+	ttl, err := envDuration("EXCHANGE_RATE_TTL", time.Hour)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.TTL = ttl
+
+	return cfg, nil
+}
+
+// envDuration parses the environment variable key as a duration, returning
+// fallback when it is unset or empty.
+func envDuration(key string, fallback time.Duration) (time.Duration, error) {
+	v := os.Getenv(key)
+	if v == "" {
+		return fallback, nil
+	}
+	d, err := time.ParseDuration(v)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q: %w", key, v, err)
+	}
+	return d, nil
+}
+
+// RateLimitConfig sets the per-client request allowance. A zero
+// RequestsPerSecond turns rate limiting off.
+type RateLimitConfig struct {
+	RequestsPerSecond int
+	Burst             int
+}
+
+// LoadRateLimitConfig reads RATE_LIMIT_RPS and RATE_LIMIT_BURST.
+func LoadRateLimitConfig() (RateLimitConfig, error) {
+	cfg := RateLimitConfig{}
+
+	rps, err := envInt("RATE_LIMIT_RPS", 10)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.RequestsPerSecond = rps
+
+	burst, err := envInt("RATE_LIMIT_BURST", 20)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Burst = burst
+
+	if cfg.RequestsPerSecond < 0 || (cfg.RequestsPerSecond > 0 && cfg.Burst < 1) {
+		return cfg, fmt.Errorf("invalid rate limit: RATE_LIMIT_RPS must not be negative and RATE_LIMIT_BURST must be at least 1")
+	}
+
+	return cfg, nil
+}
+
+// LoadRequestTimeout reads REQUEST_TIMEOUT, the longest a request may run
+// (a Go duration such as "30s"). Zero turns the timeout off.
+func LoadRequestTimeout() (time.Duration, error) {
+	d, err := envDuration("REQUEST_TIMEOUT", 30*time.Second)
+	if err != nil {
+		return 0, err
+	}
+	if d < 0 {
+		return 0, fmt.Errorf("invalid REQUEST_TIMEOUT %q: must not be negative", os.Getenv("REQUEST_TIMEOUT"))
+	}
+	return d, nil
+}
+
+// QueryConfig bounds database queries run by handlers.
+type QueryConfig struct {
+	Timeout       time.Duration
+	SlowThreshold time.Duration
+}
+
+// LoadQueryConfig reads QUERY_TIMEOUT, the longest a read query may run, and
+// SLOW_QUERY_THRESHOLD, the duration from which a query is logged as slow.
+// Both are Go durations; zero turns either off.
+func LoadQueryConfig() (QueryConfig, error) {
+	cfg := QueryConfig{}
+
+	var err error
+	if cfg.Timeout, err = envDuration("QUERY_TIMEOUT", 10*time.Second); err != nil {
+		return cfg, err
+	}
+	if cfg.SlowThreshold, err = envDuration("SLOW_QUERY_THRESHOLD", 500*time.Millisecond); err != nil {
+		return cfg, err
+	}
+	if cfg.Timeout < 0 || cfg.SlowThreshold < 0 {
+		return cfg, fmt.Errorf("invalid query limits: QUERY_TIMEOUT and SLOW_QUERY_THRESHOLD must not be negative")
+	}
+
+	return cfg, nil
+}
+
+// LoadMaintenanceMode reads MAINTENANCE_MODE, which starts the server
+// refusing writes. It can be changed at runtime through
+// /api/admin/maintenance when ADMIN_TOKEN is set.
+func LoadMaintenanceMode() (bool, error) {
+	return envBool("MAINTENANCE_MODE", false)
+}
+
+// LoadAdminToken reads ADMIN_TOKEN, the bearer token for admin writes. It
+// is unset by default, which leaves them disabled.
+func LoadAdminToken() string {
+	return os.Getenv("ADMIN_TOKEN")
+}
+
+// LoadDevSeed reads DEV_SEED, which enables the development-only
+// /api/dev/seed endpoint. It is off by default.
+func LoadDevSeed() (bool, error) {
+	return envBool("DEV_SEED", false)
+}
+
+// LoadRejectFutureDates reads REJECT_FUTURE_DATES, which makes expenses
+// dated after now fail validation. It is off by default.
+func LoadRejectFutureDates() (bool, error) {
+	return envBool("REJECT_FUTURE_DATES", false)
+}
+
+// defaultCORSOrigins are the origins allowed when CORS_ALLOWED_ORIGINS is
+// not set.
+var defaultCORSOrigins = []string{"http://localhost:3000", "http://54.226.1.246:3000"}
+
+// LoadCORSOrigins reads CORS_ALLOWED_ORIGINS, a comma-separated list of
+// origins.
+func LoadCORSOrigins() []string {
+	return parseOrigins(os.Getenv("CORS_ALLOWED_ORIGINS"))
+}
+
+// parseOrigins splits a comma-separated origin list, dropping blanks. A list
+// with no origins in it gives the defaults rather than allowing everyone.
+func parseOrigins(v string) []string {
+	var origins []string
+	for _, o := range strings.Split(v, ",") {
+		if o = strings.TrimSpace(o); o != "" {
+			origins = append(origins, o)
+		}
+	}
+	if len(origins) == 0 {
+		return defaultCORSOrigins
+	}
+	return origins
+}
+
+// LoadMaxBodyBytes reads MAX_BODY_BYTES, the default cap on request bodies.
+func LoadMaxBodyBytes() (int64, error) {
+	n, err := envInt("MAX_BODY_BYTES", defaultMaxBodyBytes)
+	if err != nil {
+		return 0, err
+	}
+	if n <= 0 {
+		return 0, fmt.Errorf("invalid MAX_BODY_BYTES %q: must be positive", os.Getenv("MAX_BODY_BYTES"))
+	}
+	return int64(n), nil
+}
+
+// MailConfig configures outgoing email. Mail is disabled when Host is
+// empty.
+type MailConfig struct {
+	Host     string
+	Port     int
+	Username string
+	Password string
+	From     string
+
+	// AlertTo receives budget alerts.
+	AlertTo string
+}
+
+// LoadMailConfig reads SMTP_HOST, SMTP_PORT, SMTP_USERNAME, SMTP_PASSWORD,
+// MAIL_FROM and BUDGET_ALERT_EMAIL. Once SMTP_HOST is set, the sender and
+// recipient are required.
+func LoadMailConfig() (MailConfig, error) {
+	cfg := MailConfig{
+		Host:     os.Getenv("SMTP_HOST"),
+		Username: os.Getenv("SMTP_USERNAME"),
+		Password: os.Getenv("SMTP_PASSWORD"),
+		From:     os.Getenv("MAIL_FROM"),
+		AlertTo:  os.Getenv("BUDGET_ALERT_EMAIL"),
+	}
+
+	port, err := envInt("SMTP_PORT", 587)
+	if err != nil {
+		return cfg, err
+	}
+	cfg.Port = port
+
+	if cfg.Host != "" && (cfg.From == "" || cfg.AlertTo == "") {
+		return cfg, fmt.Errorf("MAIL_FROM and BUDGET_ALERT_EMAIL are required when SMTP_HOST is set")
+	}
+	return cfg, nil
+}
@@ -0,0 +1,272 @@
+package main
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadConfigDefaults(t *testing.T) {
+	for _, key := range []string{"PG_HOST", "PG_PORT", "PG_USERNAME", "PG_PASSWORD", "PG_DBNAME", "PG_MAX_CONNS", "PG_MIN_CONNS", "PG_CONNECT_ATTEMPTS", "PG_CONNECT_RETRY_DELAY"} {
+		t.Setenv(key, "")
+	}
+
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, &DBConfig{
+		Host:              "localhost",
+		Port:              5432,
+		UserName:          "admin",
+		Password:          "admin",
+		DBName:            "expense_tracker",
+		MaxConns:          10,
+		MinConns:          2,
+		MaxConnLifeTime:   30 * time.Minute,
+		MaxConnIdleTime:   10 * time.Minute,
+		HealthCheckPeriod: 2 * time.Minute,
+		ConnectAttempts:   5,
+		ConnectRetryDelay: time.Second,
+	}, cfg)
+}
+
+func TestLoadConfigFromEnv(t *testing.T) {
+	t.Setenv("PG_HOST", "db.internal")
+	t.Setenv("PG_PORT", "6543")
+	t.Setenv("PG_USERNAME", "tracker")
+	t.Setenv("PG_PASSWORD", "s3cret")
+	t.Setenv("PG_DBNAME", "expenses_prod")
+	t.Setenv("PG_MAX_CONNS", "25")
+	t.Setenv("PG_MIN_CONNS", "5")
+
+	cfg, err := LoadConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, "db.internal", cfg.Host)
+	assert.Equal(t, 6543, cfg.Port)
+	assert.Equal(t, "tracker", cfg.UserName)
+	assert.Equal(t, "s3cret", cfg.Password)
+	assert.Equal(t, "expenses_prod", cfg.DBName)
+	assert.Equal(t, int32(25), cfg.MaxConns)
+	assert.Equal(t, int32(5), cfg.MinConns)
+}
+
+func TestLoadConfigInvalidInteger(t *testing.T) {
+	t.Setenv("PG_PORT", "not-a-port")
+
+	_, err := LoadConfig()
+	assert.ErrorContains(t, err, "PG_PORT")
+
+	t.Setenv("PG_PORT", "")
+	t.Setenv("PG_MAX_CONNS", "ten")
+
+	_, err = LoadConfig()
+	assert.ErrorContains(t, err, "PG_MAX_CONNS")
+}
+
+func TestDBConfigValidate(t *testing.T) {
+	valid := func() *DBConfig {
+		return &DBConfig{
+			MaxConns:          10,
+			MinConns:          2,
+			MaxConnLifeTime:   30 * time.Minute,
+			MaxConnIdleTime:   10 * time.Minute,
+			HealthCheckPeriod: 2 * time.Minute,
+			ConnectRetryDelay: time.Second,
+		}
+	}
+	assert.NoError(t, valid().Validate())
+
+	tests := []struct {
+		name    string
+		mutate  func(c *DBConfig)
+		wantErr string
+	}{
+		{"min above max", func(c *DBConfig) { c.MinConns = 11 }, "PG_MIN_CONNS 11 is greater than PG_MAX_CONNS 10"},
+		{"zero max", func(c *DBConfig) { c.MaxConns, c.MinConns = 0, 0 }, "PG_MAX_CONNS 0: must be positive"},
+		{"negative max", func(c *DBConfig) { c.MaxConns = -1 }, "PG_MAX_CONNS -1: must be positive"},
+		{"negative min", func(c *DBConfig) { c.MinConns = -1 }, "PG_MIN_CONNS -1: must not be negative"},
+		{"negative lifetime", func(c *DBConfig) { c.MaxConnLifeTime = -time.Minute }, "max connection lifetime"},
+		{"negative idle time", func(c *DBConfig) { c.MaxConnIdleTime = -time.Minute }, "max connection idle time"},
+		{"negative health check", func(c *DBConfig) { c.HealthCheckPeriod = -time.Minute }, "health check period"},
+		{"negative retry delay", func(c *DBConfig) { c.ConnectRetryDelay = -time.Second }, "PG_CONNECT_RETRY_DELAY"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			c := valid()
+			tt.mutate(c)
+			assert.ErrorContains(t, c.Validate(), tt.wantErr)
+		})
+	}
+
+	// Equal bounds are a fixed-size pool
+	c := valid()
+	c.MinConns = c.MaxConns
+	assert.NoError(t, c.Validate())
+}
+
+func TestNewPgRejectsInvalidConfig(t *testing.T) {
+	_, err := NewPg(context.Background(), &DBConfig{MaxConns: 2, MinConns: 5})
+	assert.ErrorContains(t, err, "PG_MIN_CONNS", "Should fail before connecting")
+}
+
+func TestLoadRateConfig(t *testing.T) {
+	t.Setenv("EXCHANGE_RATE_URL", "")
+	t.Setenv("EXCHANGE_RATE_TTL", "")
+
+	cfg, err := LoadRateConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, RateConfig{BaseURL: "https://api.frankfurter.app", TTL: time.Hour}, cfg)
+
+	t.Setenv("EXCHANGE_RATE_URL", "http://rates.internal")
+	t.Setenv("EXCHANGE_RATE_TTL", "15m")
+	cfg, err = LoadRateConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, RateConfig{BaseURL: "http://rates.internal", TTL: 15 * time.Minute}, cfg)
+
+	t.Setenv("EXCHANGE_RATE_TTL", "soon")
+	_, err = LoadRateConfig()
+	assert.ErrorContains(t, err, "invalid EXCHANGE_RATE_TTL")
+}
+
+func TestLoadRateLimitConfig(t *testing.T) {
+	t.Setenv("RATE_LIMIT_RPS", "")
+	t.Setenv("RATE_LIMIT_BURST", "")
+
+	cfg, err := LoadRateLimitConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, RateLimitConfig{RequestsPerSecond: 10, Burst: 20}, cfg)
+
+	t.Setenv("RATE_LIMIT_RPS", "0")
+	cfg, err = LoadRateLimitConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, 0, cfg.RequestsPerSecond, "Zero should turn limiting off")
+
+	t.Setenv("RATE_LIMIT_RPS", "5")
+	t.Setenv("RATE_LIMIT_BURST", "0")
+	_, err = LoadRateLimitConfig()
+	assert.Error(t, err, "Should reject an empty burst")
+}
+
+func TestLoadRequestTimeout(t *testing.T) {
+	t.Setenv("REQUEST_TIMEOUT", "")
+	d, err := LoadRequestTimeout()
+	assert.NoError(t, err)
+	assert.Equal(t, 30*time.Second, d)
+
+	t.Setenv("REQUEST_TIMEOUT", "5s")
+	d, err = LoadRequestTimeout()
+	assert.NoError(t, err)
+	assert.Equal(t, 5*time.Second, d)
+
+	t.Setenv("REQUEST_TIMEOUT", "-1s")
+	_, err = LoadRequestTimeout()
+	assert.Error(t, err)
+}
+
+func TestLoadMaintenanceMode(t *testing.T) {
+	t.Setenv("MAINTENANCE_MODE", "")
+	on, err := LoadMaintenanceMode()
+	assert.NoError(t, err)
+	assert.False(t, on)
+
+	t.Setenv("MAINTENANCE_MODE", "true")
+	on, err = LoadMaintenanceMode()
+	assert.NoError(t, err)
+	assert.True(t, on)
+
+	t.Setenv("MAINTENANCE_MODE", "sometimes")
+	_, err = LoadMaintenanceMode()
+	assert.Error(t, err)
+}
+
+func TestLoadDevSeed(t *testing.T) {
+	t.Setenv("DEV_SEED", "")
+	on, err := LoadDevSeed()
+	assert.NoError(t, err)
+	assert.False(t, on, "Should be off unless asked for")
+
+	t.Setenv("DEV_SEED", "1")
+	on, err = LoadDevSeed()
+	assert.NoError(t, err)
+	assert.True(t, on)
+}
+
+func TestLoadRejectFutureDates(t *testing.T) {
+	t.Setenv("REJECT_FUTURE_DATES", "")
+	on, err := LoadRejectFutureDates()
+	assert.NoError(t, err)
+	assert.False(t, on)
+
+	t.Setenv("REJECT_FUTURE_DATES", "true")
+	on, err = LoadRejectFutureDates()
+	assert.NoError(t, err)
+	assert.True(t, on)
+}
+
+func TestLoadQueryConfig(t *testing.T) {
+	t.Setenv("QUERY_TIMEOUT", "")
+	t.Setenv("SLOW_QUERY_THRESHOLD", "")
+	cfg, err := LoadQueryConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, QueryConfig{Timeout: 10 * time.Second, SlowThreshold: 500 * time.Millisecond}, cfg)
+
+	t.Setenv("QUERY_TIMEOUT", "2s")
+	t.Setenv("SLOW_QUERY_THRESHOLD", "0")
+	cfg, err = LoadQueryConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, QueryConfig{Timeout: 2 * time.Second}, cfg)
+
+	t.Setenv("SLOW_QUERY_THRESHOLD", "-1s")
+	_, err = LoadQueryConfig()
+	assert.Error(t, err)
+}
+
+func TestParseOrigins(t *testing.T) {
+	assert.Equal(t, []string{"https://app.example.com"}, parseOrigins("https://app.example.com"))
+	assert.Equal(t, []string{"https://a.example.com", "https://b.example.com"},
+		parseOrigins("https://a.example.com, https://b.example.com,"))
+
+	// Nothing usable falls back to the defaults, never to "allow all"
+	assert.Equal(t, defaultCORSOrigins, parseOrigins(""))
+	assert.Equal(t, defaultCORSOrigins, parseOrigins(" , "))
+}
+
+func TestLoadMaxBodyBytes(t *testing.T) {
+	t.Setenv("MAX_BODY_BYTES", "")
+	n, err := LoadMaxBodyBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(defaultMaxBodyBytes), n)
+
+	t.Setenv("MAX_BODY_BYTES", "2048")
+	n, err = LoadMaxBodyBytes()
+	assert.NoError(t, err)
+	assert.Equal(t, int64(2048), n)
+
+	t.Setenv("MAX_BODY_BYTES", "0")
+	_, err = LoadMaxBodyBytes()
+	assert.Error(t, err)
+}
+
+func TestLoadMailConfig(t *testing.T) {
+	t.Setenv("SMTP_HOST", "")
+	t.Setenv("SMTP_PORT", "")
+	t.Setenv("MAIL_FROM", "")
+	t.Setenv("BUDGET_ALERT_EMAIL", "")
+	cfg, err := LoadMailConfig()
+	assert.NoError(t, err, "Mail is optional")
+	assert.Empty(t, cfg.Host)
+	assert.Equal(t, 587, cfg.Port)
+
+	// A host without a sender and recipient is a mistake
+	t.Setenv("SMTP_HOST", "smtp.example.com")
+	_, err = LoadMailConfig()
+	assert.Error(t, err)
+
+	t.Setenv("SMTP_PORT", "2525")
+	t.Setenv("MAIL_FROM", "tracker@example.com")
+	t.Setenv("BUDGET_ALERT_EMAIL", "me@example.com")
+	cfg, err = LoadMailConfig()
+	assert.NoError(t, err)
+	assert.Equal(t, MailConfig{Host: "smtp.example.com", Port: 2525, From: "tracker@example.com", AlertTo: "me@example.com"}, cfg)
+}
@@ -0,0 +1,75 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"mime"
+	"net/http"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// nonJSONRoutes are route templates whose bodies aren't JSON, such as the
+// multipart receipt upload.
+var nonJSONRoutes = map[string]bool{
+	"/api/expenses/{id}/receipt": true,
+}
+
+// requireJSONMiddleware refuses POST, PUT and PATCH bodies that aren't
+// declared as application/json with 415, so a form post or text/plain body
+// isn't decoded as JSON by accident. Parameters such as charset are
+// optional. Requests without a body, like a restore, pass through.
+func requireJSONMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodPost, http.MethodPut, http.MethodPatch:
+		default:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if r.ContentLength == 0 {
+			next.ServeHTTP(w, r)
+			return
+		}
+		if current := mux.CurrentRoute(r); current != nil {
+			if route, _ := current.GetPathTemplate(); nonJSONRoutes[route] {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		mediaType, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		if err != nil || mediaType != "application/json" {
+			writeJSONError(w, http.StatusUnsupportedMediaType, "Content-Type must be application/json")
+			return
+		}
+		next.ServeHTTP(w, r)
+	})
+}
+
+// decodeStrict decodes a JSON request body into v, rejecting fields v
+// doesn't have so a misspelt "ammount" fails loudly instead of being
+// dropped.
+func decodeStrict(r *http.Request, v any) error {
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(v); err != nil {
+		if strings.HasPrefix(err.Error(), "json: unknown field ") {
+			return errors.New(strings.TrimPrefix(err.Error(), "json: "))
+		}
+		return err
+	}
+	return nil
+}
+
+// writeDecodeError reports a failure to decode a JSON request body: 413 if
+// the body was over its size cap, 400 otherwise.
+func writeDecodeError(w http.ResponseWriter, err error) {
+	var maxErr *http.MaxBytesError
+	if errors.As(err, &maxErr) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, bodyTooLargeMessage(maxErr.Limit))
+		return
+	}
+	writeJSONError(w, http.StatusBadRequest, err.Error())
+}
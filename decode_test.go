@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRejectUnknownFields(t *testing.T) {
+	router := (&App{}).routes()
+	body := `{"description": "Lunch", "ammount": 12.50, "category": "Food", "date": "2024-03-01T12:00:00Z"}`
+
+	for _, tc := range []struct{ method, target, body string }{
+		{"POST", "/api/expenses", body},
+		{"PUT", "/api/expenses/1", body},
+		{"PATCH", "/api/expenses/1", `{"description": "Lunch", "ammount": 12.50}`},
+		{"POST", "/api/expenses/bulk", "[" + body + "]"},
+	} {
+		req, _ := http.NewRequest(tc.method, tc.target, bytes.NewBufferString(tc.body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		assert.Equal(t, http.StatusBadRequest, rr.Code, "%s %s should reject the typo", tc.method, tc.target)
+
+		var resp errorResponse
+		assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+		assert.Equal(t, `unknown field "ammount"`, resp.Error.Message)
+	}
+}
+
+func TestRequireJSONContentType(t *testing.T) {
+	router := (&App{}).routes()
+	body := `{"description": "Lunch", "amount": 12.50, "category": "Food", "date": "2024-03-01T12:00:00Z"}`
+
+	for _, contentType := range []string{"text/plain", "application/x-www-form-urlencoded", ""} {
+		req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBufferString(body))
+		if contentType != "" {
+			req.Header.Set("Content-Type", contentType)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code, "Content-Type %q", contentType)
+	}
+
+	// Parameters and case don't matter; this gets as far as validation
+	for _, contentType := range []string{"application/json", "application/json; charset=utf-8", "Application/JSON"} {
+		req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBufferString(`{"amount": -1}`))
+		req.Header.Set("Content-Type", contentType)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Content-Type %q", contentType)
+	}
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// duplicateWindow is how close in date two otherwise identical expenses
+// must be for the second to be treated as an accidental resubmission.
+const duplicateWindow = time.Minute
+
+// duplicateResponse is the 409 body for a suspected duplicate. It carries
+// the expense that already exists so the client can use it instead.
+type duplicateResponse struct {
+	Error    errorBody `json:"error"`
+	Existing Expense   `json:"existing"`
+}
+
+// findDuplicate looks for a live expense in the same account with the same
+// type, amount, currency and category, dated within duplicateWindow of e. It takes
+// a transaction-scoped lock on that combination first, so two copies of a
+// double-submitted request can't both get past the check.
+func findDuplicate(ctx context.Context, tx pgx.Tx, e Expense) (*Expense, error) {
+	_, err := tx.Exec(ctx,
+		"SELECT pg_advisory_xact_lock(hashtext(concat_ws('|', $5, COALESCE(NULLIF($1, 0), default_account_id()), $2::text, $3, lower($4))))",
+		e.AccountID, e.Amount, e.Currency, e.Category, e.Type)
+	if err != nil {
+		return nil, err
+	}
+
+	var existing Expense
+	err = scanExpense(tx.QueryRow(ctx, `
+		SELECT `+expenseColumns+` FROM expenses
+		WHERE deleted_at IS NULL
+			AND refund_of IS NULL
+			AND account_id = COALESCE(NULLIF($1, 0), default_account_id())
+			AND amount = $2
+			AND currency = $3
+			AND lower(category) = lower($4)
+			AND type = $5
+			AND date BETWEEN $6 AND $7
+		ORDER BY id
+		LIMIT 1`,
+		e.AccountID, e.Amount, e.Currency, e.Category, e.Type,
+		e.Date.Add(-duplicateWindow), e.Date.Add(duplicateWindow)), &existing)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &existing, nil
+}
+
+// writeDuplicate sends the 409 Conflict for a suspected duplicate.
+func writeDuplicate(w http.ResponseWriter, existing Expense) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, http.StatusConflict, duplicateResponse{
+		Error: errorBody{
+			Code:    http.StatusConflict,
+			Message: "a matching expense already exists; retry with ?force=true to create it anyway",
+		},
+		Existing: existing,
+	})
+}
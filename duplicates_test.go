@@ -0,0 +1,68 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateExpenseDuplicate(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	date := time.Now().Round(time.Second)
+
+	create := func(query string, e Expense) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(e)
+		req, _ := http.NewRequest("POST", "/api/expenses"+query, bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	expense := Expense{
+		Description: "Coffee",
+		Amount:      350,
+		Category:    "Food",
+		Date:        date,
+		AccountID:   accountID,
+	}
+
+	rr := create("", expense)
+	var first Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &first))
+	assert.NotZero(t, first.ID)
+
+	// A resubmission a few seconds later is blocked and points at the original
+	expense.Date = date.Add(10 * time.Second)
+	rr = create("", expense)
+	assert.Equal(t, http.StatusConflict, rr.Code, "Should reject a likely duplicate")
+
+	var conflict duplicateResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &conflict))
+	assert.Equal(t, first.ID, conflict.Existing.ID, "Should return the existing expense")
+
+	// A different amount is not a duplicate
+	expense.Amount = 400
+	rr = create("", expense)
+	assert.NotEqual(t, http.StatusConflict, rr.Code)
+
+	// force=true creates it anyway
+	expense.Amount = 350
+	rr = create("?force=true", expense)
+	assert.NotEqual(t, http.StatusConflict, rr.Code, "Should allow a forced duplicate")
+
+	var forced Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &forced))
+	assert.NotZero(t, forced.ID)
+	assert.NotEqual(t, first.ID, forced.ID, "Should create a new expense")
+
+	rr = create("?force=maybe", expense)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject a malformed force flag")
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestETagMatches(t *testing.T) {
+	etag := `"abc"`
+	assert.True(t, etagMatches(`"abc"`, etag))
+	assert.True(t, etagMatches(`"xyz", "abc"`, etag), "Should look through a list")
+	assert.True(t, etagMatches(`W/"abc"`, etag), "Should compare weak tags by value")
+	assert.True(t, etagMatches(`*`, etag))
+	assert.False(t, etagMatches(``, etag))
+	assert.False(t, etagMatches(`"abcd"`, etag))
+	assert.False(t, etagMatches(`abc`, etag), "Should not match an unquoted tag")
+}
+
+func TestGetExpensesConditional(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	insert := func(description string, amount Cents) {
+		_, err := app.DBClient.Exec(context.Background(),
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			description, amount, "Food", time.Now().Add(-time.Hour), accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+	insert("Cached", 500)
+
+	get := func(ifNoneMatch string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses?account_id=%d", accountID), nil)
+		if ifNoneMatch != "" {
+			req.Header.Set("If-None-Match", ifNoneMatch)
+		}
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get("")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	etag := rr.Header().Get("ETag")
+	assert.NotEmpty(t, etag, "Should tag the response")
+
+	// Nothing changed, so nothing is sent
+	rr = get(etag)
+	assert.Equal(t, http.StatusNotModified, rr.Code)
+	assert.Empty(t, rr.Body.String())
+	assert.Equal(t, etag, rr.Header().Get("ETag"))
+
+	// A new expense changes the tag
+	insert("Fresh", 700)
+	rr = get(etag)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should send the list again once it changes")
+	assert.NotEqual(t, etag, rr.Header().Get("ETag"))
+}
@@ -0,0 +1,169 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"log/slog"
+	"net/http"
+	"sort"
+	"strconv"
+	"time"
+)
+
+// exportFlushEvery is how many CSV rows are buffered before being flushed to
+// the client.
+const exportFlushEvery = 100
+
+// exportSummary accumulates the footer totals while rows stream out.
+type exportSummary struct {
+	count      int
+	total      Cents
+	byCategory map[string]*categorySubtotal
+}
+
+type categorySubtotal struct {
+	count int
+	total Cents
+}
+
+// add folds e into the totals. Refunds are subtracted and, like in the
+// summary endpoints, not counted as expenses.
+func (s *exportSummary) add(e Expense) {
+	amount := e.Amount
+	n := 1
+	if e.RefundOf != nil {
+		amount, n = -amount, 0
+	}
+	s.count += n
+	s.total += amount
+
+	sub, ok := s.byCategory[e.Category]
+	if !ok {
+		sub = &categorySubtotal{}
+		s.byCategory[e.Category] = sub
+	}
+	sub.count += n
+	sub.total += amount
+}
+
+// write appends the footer after a blank separator row. Footer rows start
+// with TOTAL or SUBTOTAL in the id column so spreadsheet imports can skip
+// them.
+func (s *exportSummary) write(cw *csv.Writer, subtotals bool) {
+	cw.Write([]string{})
+
+	if subtotals {
+		categories := make([]string, 0, len(s.byCategory))
+		for c := range s.byCategory {
+			categories = append(categories, c)
+		}
+		sort.Strings(categories)
+
+		for _, c := range categories {
+			sub := s.byCategory[c]
+			cw.Write([]string{"SUBTOTAL", countLabel(sub.count), sub.total.String(), c, ""})
+		}
+	}
+
+	cw.Write([]string{"TOTAL", countLabel(s.count), s.total.String(), "", ""})
+}
+
+func countLabel(n int) string {
+	if n == 1 {
+		return "1 expense"
+	}
+	return strconv.Itoa(n) + " expenses"
+}
+
+// exportExpensesCSV streams the expenses matching the list filters as a CSV
+// download, one row at a time so large exports are never held in memory.
+// With ?summary=true a footer with the total amount and count is appended,
+// and ?subtotals=true adds a subtotal row per category as well. Income is
+// only exported when asked for with ?type=income.
+func (app *App) exportExpensesCSV(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, true)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter = filter.spending()
+
+	withSummary, err := parseBoolParam(r, "summary", false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	withSubtotals, err := parseBoolParam(r, "subtotals", false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	summary := &exportSummary{byCategory: map[string]*categorySubtotal{}}
+
+	where, args := filter.where(app.now())
+	cw := csv.NewWriter(w)
+	started := false
+	err = app.queryWithTimeout(r.Context(), "export expenses", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx,
+			"SELECT "+expenseColumns+" FROM expenses"+where+" ORDER BY date DESC", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+		w.Header().Set("Content-Disposition", `attachment; filename="expenses.csv"`)
+		cw.Write([]string{"id", "description", "amount", "category", "date"})
+		started = true
+
+		n := 0
+		for rows.Next() {
+			var e Expense
+			if err := scanExpense(rows, &e); err != nil {
+				return err
+			}
+			// Refunds are exported as negative amounts so the column sums
+			// to the net spend.
+			amount := e.Amount
+			if e.RefundOf != nil {
+				amount = -amount
+			}
+			cw.Write([]string{
+				strconv.Itoa(e.ID),
+				e.Description,
+				amount.String(),
+				e.Category,
+				e.Date.Format(time.RFC3339),
+			})
+			summary.add(e)
+
+			n++
+			if n%exportFlushEvery == 0 {
+				cw.Flush()
+				if err := cw.Error(); err != nil {
+					return err
+				}
+			}
+		}
+		return rows.Err()
+	})
+	// Once the header row is out the status is committed, so failures past
+	// that point can only be logged.
+	if err != nil {
+		if !started {
+			writeQueryError(w, err)
+			return
+		}
+		slog.ErrorContext(r.Context(), "Error exporting expenses", "error", err)
+		return
+	}
+
+	if withSummary || withSubtotals {
+		summary.write(cw, withSubtotals)
+	}
+
+	cw.Flush()
+	if err := cw.Error(); err != nil {
+		slog.ErrorContext(r.Context(), "Error writing export", "error", err)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExportExpensesCSV(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Add test data under a category no other test uses
+	category := fmt.Sprintf("Export %d", time.Now().UnixNano())
+	ctx := context.Background()
+	for i := 0; i < 3; i++ {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4)",
+			fmt.Sprintf("Export item %d", i), Cents(1050+100*i), category, time.Date(2024, 3, i+1, 12, 0, 0, 0, time.UTC))
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET", "/api/expenses/export.csv?category="+url.QueryEscape(category), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	// Check response
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+	assert.Equal(t, "text/csv; charset=utf-8", rr.Header().Get("Content-Type"))
+	assert.Contains(t, rr.Header().Get("Content-Disposition"), "attachment")
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err, "Should parse CSV")
+	assert.Equal(t, []string{"id", "description", "amount", "category", "date"}, records[0])
+	assert.Len(t, records, 4, "Should return header plus three rows")
+	assert.Equal(t, "12.50", records[1][2], "Newest expense first with two-decimal amount")
+	assert.Equal(t, "2024-03-03T12:00:00Z", records[1][4])
+
+	// Date filters narrow the export
+	req, _ = http.NewRequest("GET", "/api/expenses/export.csv?from=2024-03-02&to=2024-03-02&category="+url.QueryEscape(category), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	records, err = csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err, "Should parse CSV")
+	assert.Len(t, records, 2, "Should return header plus one row")
+
+	fmt.Printf("Exported %d rows\n", len(records)-1)
+}
+
+func TestExportExpensesCSVSummary(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Rows under a category no other test uses
+	prefix := fmt.Sprintf("Footer %d", time.Now().UnixNano())
+	ctx := context.Background()
+	rows := []struct {
+		category string
+		amount   Cents
+	}{
+		{prefix, 10},
+		{prefix, 20},
+	}
+	for _, row := range rows {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4)",
+			"Footer item", row.amount, row.category, time.Date(2024, 4, 1, 9, 0, 0, 0, time.UTC))
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Without the flag there is no footer
+	req, _ := http.NewRequest("GET", "/api/expenses/export.csv?category="+url.QueryEscape(prefix), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	records, err := csv.NewReader(rr.Body).ReadAll()
+	assert.NoError(t, err, "Should parse CSV")
+	assert.Len(t, records, 3, "Should return header plus two rows only")
+
+	// With summary and subtotals the footer follows a blank separator
+	req, _ = http.NewRequest("GET", "/api/expenses/export.csv?summary=true&subtotals=true&category="+url.QueryEscape(prefix), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+	assert.Contains(t, rr.Body.String(), "\n\nSUBTOTAL,")
+
+	reader := csv.NewReader(rr.Body)
+	reader.FieldsPerRecord = -1
+	records, err = reader.ReadAll()
+	assert.NoError(t, err, "Should parse CSV")
+	assert.Len(t, records, 5, "Should return header, two rows, a subtotal and a total")
+	assert.Equal(t, []string{"SUBTOTAL", "2 expenses", "0.30", prefix, ""}, records[3])
+	assert.Equal(t, []string{"TOTAL", "2 expenses", "0.30", "", ""}, records[4])
+}
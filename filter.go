@@ -0,0 +1,390 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// expenseFilter holds the optional filters accepted by endpoints that read
+// expenses, parsed from the request's query string.
+type expenseFilter struct {
+	// IncludeFuture controls whether expenses dated after now (planned
+	// purchases) are returned.
+	IncludeFuture bool
+
+	// AccountID restricts results to one account when non-zero.
+	AccountID int
+
+	// From and To bound the expense date to whole days, both inclusive.
+	// Zero values leave that side open.
+	From time.Time
+	To   time.Time
+
+	// Period is a relative date range such as "last_month", resolved
+	// against the current time when the query runs. It cannot be combined
+	// with From or To.
+	Period string
+
+	// Category restricts results to a single category when non-empty.
+	Category string
+
+	// Currency restricts results to one ISO 4217 currency when non-empty.
+	Currency string
+
+	// Type restricts results to expenses or income when non-empty.
+	Type string
+
+	// Tag restricts results to expenses carrying this tag, ignoring case,
+	// when non-empty.
+	Tag string
+
+	// Since restricts results to expenses created or changed at or after
+	// this instant when non-zero, for clients syncing incrementally.
+	Since time.Time
+
+	// MinAmount and MaxAmount bound the amount, both inclusive. Zero
+	// values leave that side open.
+	MinAmount Cents
+	MaxAmount Cents
+
+	// Search is a case-insensitive substring that must appear in the
+	// description or category. It is only set by the search endpoint.
+	Search string
+}
+
+// periods are the relative date ranges accepted by the period parameter.
+var periods = map[string]bool{
+	"this_month":   true,
+	"last_month":   true,
+	"this_year":    true,
+	"last_year":    true,
+	"last_7_days":  true,
+	"last_30_days": true,
+}
+
+// periodRange returns the [start, end) bounds of a named period relative to
+// now. The last_N_days periods include today.
+func periodRange(period string, now time.Time) (time.Time, time.Time) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+	thisMonth := time.Date(y, m, 1, 0, 0, 0, 0, now.Location())
+	thisYear := time.Date(y, time.January, 1, 0, 0, 0, 0, now.Location())
+
+	switch period {
+	case "this_month":
+		return thisMonth, thisMonth.AddDate(0, 1, 0)
+	case "last_month":
+		return thisMonth.AddDate(0, -1, 0), thisMonth
+	case "this_year":
+		return thisYear, thisYear.AddDate(1, 0, 0)
+	case "last_year":
+		return thisYear.AddDate(-1, 0, 0), thisYear
+	case "last_7_days":
+		return today.AddDate(0, 0, -6), today.AddDate(0, 0, 1)
+	default: // last_30_days
+		return today.AddDate(0, 0, -29), today.AddDate(0, 0, 1)
+	}
+}
+
+// sortColumns maps the keys accepted by ?sort= to the columns they order
+// by. Only these ever reach the SQL.
+var sortColumns = map[string]string{
+	"date":   "date",
+	"amount": "amount",
+}
+
+// defaultSort is the list order when ?sort= is absent: newest first.
+const defaultSort = "-date"
+
+// sortKey is one column of a sort order.
+type sortKey struct {
+	column string
+	desc   bool
+}
+
+func (k sortKey) direction() string {
+	if k.desc {
+		return "DESC"
+	}
+	return "ASC"
+}
+
+// sortOrder is a parsed ?sort= value.
+type sortOrder struct {
+	// key is the value as given, such as "-date,amount".
+	key  string
+	keys []sortKey
+}
+
+// parseSort parses a comma-separated list of sort keys such as "amount"
+// or "-date,amount", where a leading - sorts that key descending. Each key
+// must be in sortColumns and may only appear once.
+func parseSort(v string) (sortOrder, error) {
+	if v == "" {
+		v = defaultSort
+	}
+	s := sortOrder{key: v}
+	seen := map[string]bool{}
+	for _, part := range strings.Split(v, ",") {
+		name, desc := part, false
+		if strings.HasPrefix(part, "-") {
+			name, desc = part[1:], true
+		}
+		column, ok := sortColumns[name]
+		if !ok {
+			return s, fmt.Errorf("invalid sort key %q: must be date or amount, with a leading - for descending", part)
+		}
+		if seen[column] {
+			return s, fmt.Errorf("invalid sort %q: %s appears more than once", v, name)
+		}
+		seen[column] = true
+		s.keys = append(s.keys, sortKey{column: column, desc: desc})
+	}
+	return s, nil
+}
+
+// idKey is the tie-breaker appended to every order, running the same way
+// as the last key.
+func (s sortOrder) idKey() sortKey {
+	return sortKey{column: "id", desc: s.keys[len(s.keys)-1].desc}
+}
+
+// orderBy renders the ORDER BY clause. The id breaks ties so pages are
+// stable.
+func (s sortOrder) orderBy() string {
+	terms := make([]string, 0, len(s.keys)+1)
+	for _, k := range append(append([]sortKey{}, s.keys...), s.idKey()) {
+		terms = append(terms, k.column+" "+k.direction())
+	}
+	return " ORDER BY " + strings.Join(terms, ", ")
+}
+
+// dateLayout is the format accepted for the from and to query parameters.
+const dateLayout = "2006-01-02"
+
+// parseExpenseFilter reads the filter query parameters from r. Listing
+// endpoints show future-dated expenses by default while summaries hide them,
+// so the caller supplies the default for include_future.
+func parseExpenseFilter(r *http.Request, includeFuture bool) (expenseFilter, error) {
+	f := expenseFilter{IncludeFuture: includeFuture}
+
+	q := r.URL.Query()
+	var err error
+	if f.IncludeFuture, err = parseBoolParam(r, "include_future", includeFuture); err != nil {
+		return f, err
+	}
+
+	if v := q.Get("account_id"); v != "" {
+		id, err := strconv.Atoi(v)
+		if err != nil || id <= 0 {
+			return f, fmt.Errorf("invalid account_id %q", v)
+		}
+		f.AccountID = id
+	}
+
+	if f.From, err = parseDateParam(q.Get("from")); err != nil {
+		return f, fmt.Errorf("invalid from: %w", err)
+	}
+	if f.To, err = parseDateParam(q.Get("to")); err != nil {
+		return f, fmt.Errorf("invalid to: %w", err)
+	}
+	if !f.From.IsZero() && !f.To.IsZero() && f.From.After(f.To) {
+		return f, fmt.Errorf("from must not be after to")
+	}
+
+	if v := q.Get("period"); v != "" {
+		if !periods[v] {
+			return f, fmt.Errorf("invalid period %q", v)
+		}
+		if !f.From.IsZero() || !f.To.IsZero() {
+			return f, fmt.Errorf("period cannot be combined with from or to")
+		}
+		f.Period = v
+	}
+
+	f.Category = strings.TrimSpace(q.Get("category"))
+
+	f.Tag = strings.TrimSpace(q.Get("tag"))
+
+	if v := q.Get("currency"); v != "" {
+		f.Currency = normalizeCurrency(v)
+		if !currencies[f.Currency] {
+			return f, fmt.Errorf("invalid currency %q", v)
+		}
+	}
+
+	if v := q.Get("since"); v != "" {
+		if f.Since, err = time.Parse(time.RFC3339, v); err != nil {
+			return f, fmt.Errorf("invalid since %q: must be an RFC 3339 timestamp", v)
+		}
+	}
+
+	if f.MinAmount, err = parseAmountParam(q, "min_amount"); err != nil {
+		return f, err
+	}
+	if f.MaxAmount, err = parseAmountParam(q, "max_amount"); err != nil {
+		return f, err
+	}
+	if f.MinAmount != 0 && f.MaxAmount != 0 && f.MinAmount > f.MaxAmount {
+		return f, fmt.Errorf("min_amount must not be greater than max_amount")
+	}
+
+	if v := q.Get("type"); v != "" {
+		if !expenseTypes[v] {
+			return f, fmt.Errorf("invalid type %q: must be expense or income", v)
+		}
+		f.Type = v
+	}
+
+	return f, nil
+}
+
+// spending returns the filter for a spending report: expenses only unless
+// the client asked for a type explicitly.
+func (f expenseFilter) spending() expenseFilter {
+	if f.Type == "" {
+		f.Type = expenseTypeExpense
+	}
+	return f
+}
+
+// bounds returns the filter's date range as [start, end), from either the
+// explicit days or the named period. To is inclusive, so its end is the
+// start of the next day. A zero time means that side is open.
+func (f expenseFilter) bounds(now time.Time) (start, end time.Time) {
+	if f.Period != "" {
+		return periodRange(f.Period, now)
+	}
+	start = f.From
+	if !f.To.IsZero() {
+		end = f.To.AddDate(0, 0, 1)
+	}
+	return start, end
+}
+
+// where renders the filter as a SQL WHERE clause along with its positional
+// arguments. Soft-deleted expenses are always excluded.
+func (f expenseFilter) where(now time.Time) (string, []any) {
+	conds := []string{"deleted_at IS NULL"}
+	var args []any
+
+	if !f.IncludeFuture {
+		args = append(args, now)
+		conds = append(conds, fmt.Sprintf("date <= $%d", len(args)))
+	}
+
+	if f.AccountID != 0 {
+		args = append(args, f.AccountID)
+		conds = append(conds, fmt.Sprintf("account_id = $%d", len(args)))
+	}
+
+	start, end := f.bounds(now)
+	if !start.IsZero() {
+		args = append(args, start)
+		conds = append(conds, fmt.Sprintf("date >= $%d", len(args)))
+	}
+
+	if !end.IsZero() {
+		args = append(args, end)
+		conds = append(conds, fmt.Sprintf("date < $%d", len(args)))
+	}
+
+	if f.Category != "" {
+		args = append(args, f.Category)
+		conds = append(conds, fmt.Sprintf("category = $%d", len(args)))
+	}
+
+	if f.Currency != "" {
+		args = append(args, f.Currency)
+		conds = append(conds, fmt.Sprintf("currency = $%d", len(args)))
+	}
+
+	if f.Type != "" {
+		args = append(args, f.Type)
+		conds = append(conds, fmt.Sprintf("type = $%d", len(args)))
+	}
+
+	switch {
+	case f.MinAmount != 0 && f.MaxAmount != 0:
+		args = append(args, f.MinAmount, f.MaxAmount)
+		conds = append(conds, fmt.Sprintf("amount BETWEEN $%d AND $%d", len(args)-1, len(args)))
+	case f.MinAmount != 0:
+		args = append(args, f.MinAmount)
+		conds = append(conds, fmt.Sprintf("amount >= $%d", len(args)))
+	case f.MaxAmount != 0:
+		args = append(args, f.MaxAmount)
+		conds = append(conds, fmt.Sprintf("amount <= $%d", len(args)))
+	}
+
+	if !f.Since.IsZero() {
+		args = append(args, f.Since)
+		conds = append(conds, fmt.Sprintf("updated_at >= $%d", len(args)))
+	}
+
+	if f.Tag != "" {
+		args = append(args, f.Tag)
+		conds = append(conds, fmt.Sprintf(`EXISTS (SELECT 1 FROM expense_tags et JOIN tags t ON t.id = et.tag_id
+			WHERE et.expense_id = expenses.id AND lower(t.name) = lower($%d))`, len(args)))
+	}
+
+	if f.Search != "" {
+		args = append(args, "%"+escapeLike(f.Search)+"%")
+		conds = append(conds, fmt.Sprintf(`(description ILIKE $%[1]d ESCAPE '\' OR category ILIKE $%[1]d ESCAPE '\')`, len(args)))
+	}
+
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// likeEscaper escapes the LIKE wildcards so user input matches literally.
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// escapeLike makes s safe to embed in a LIKE pattern using '\' as the
+// escape character.
+func escapeLike(s string) string {
+	return likeEscaper.Replace(s)
+}
+
+// parseDateParam parses a YYYY-MM-DD query value, returning the zero time
+// for an empty string.
+func parseDateParam(v string) (time.Time, error) {
+	if v == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(dateLayout, v)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("%q is not a YYYY-MM-DD date", v)
+	}
+	return t, nil
+}
+
+// parseAmountParam reads the query parameter name as a positive amount such
+// as "12.50", returning zero when it is absent.
+func parseAmountParam(q url.Values, name string) (Cents, error) {
+	v := q.Get(name)
+	if v == "" {
+		return 0, nil
+	}
+	c, err := parseCents(v)
+	if err != nil || c <= 0 {
+		return 0, fmt.Errorf("invalid %s %q: must be a positive amount with at most two decimal places", name, v)
+	}
+	return c, nil
+}
+
+// parseBoolParam reads the query parameter name as a boolean, returning def
+// when it is absent.
+func parseBoolParam(r *http.Request, name string, def bool) (bool, error) {
+	v := r.URL.Query().Get(name)
+	if v == "" {
+		return def, nil
+	}
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return def, fmt.Errorf("invalid %s %q: must be true or false", name, v)
+	}
+	return b, nil
+}
@@ -0,0 +1,203 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExpenseFilter(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/expenses?from=2024-01-01&to=2024-01-31&category=Food&account_id=3&include_future=false", nil)
+
+	f, err := parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	assert.False(t, f.IncludeFuture)
+	assert.Equal(t, 3, f.AccountID)
+	assert.Equal(t, "Food", f.Category)
+	assert.Equal(t, time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC), f.From)
+
+	now := time.Date(2024, 6, 1, 0, 0, 0, 0, time.UTC)
+	where, args := f.where(now)
+	assert.Equal(t, " WHERE deleted_at IS NULL AND date <= $1 AND account_id = $2 AND date >= $3 AND date < $4 AND category = $5", where)
+	assert.Equal(t, []any{now, 3, f.From, time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC), "Food"}, args)
+}
+
+func TestParseExpenseFilterInvalid(t *testing.T) {
+	for _, query := range []string{
+		"include_future=maybe",
+		"account_id=abc",
+		"from=01/02/2024",
+		"from=2024-02-01&to=2024-01-01",
+	} {
+		req, _ := http.NewRequest("GET", "/api/expenses?"+query, nil)
+		_, err := parseExpenseFilter(req, true)
+		assert.Error(t, err, query)
+	}
+}
+
+func TestExpenseFilterExcludesDeleted(t *testing.T) {
+	where, args := expenseFilter{IncludeFuture: true}.where(time.Now())
+	assert.Equal(t, " WHERE deleted_at IS NULL", where)
+	assert.Empty(t, args)
+}
+
+func TestPeriodRange(t *testing.T) {
+	now := time.Date(2024, 3, 15, 14, 30, 0, 0, time.UTC)
+	day := func(y int, m time.Month, d int) time.Time { return time.Date(y, m, d, 0, 0, 0, 0, time.UTC) }
+
+	tests := []struct {
+		period     string
+		start, end time.Time
+	}{
+		{"this_month", day(2024, 3, 1), day(2024, 4, 1)},
+		{"last_month", day(2024, 2, 1), day(2024, 3, 1)},
+		{"this_year", day(2024, 1, 1), day(2025, 1, 1)},
+		{"last_year", day(2023, 1, 1), day(2024, 1, 1)},
+		{"last_7_days", day(2024, 3, 9), day(2024, 3, 16)},
+		{"last_30_days", day(2024, 2, 15), day(2024, 3, 16)},
+	}
+
+	for _, tt := range tests {
+		start, end := periodRange(tt.period, now)
+		assert.Equal(t, tt.start, start, tt.period)
+		assert.Equal(t, tt.end, end, tt.period)
+	}
+
+	// January's previous month is in the previous year
+	start, end := periodRange("last_month", time.Date(2024, 1, 20, 0, 0, 0, 0, time.UTC))
+	assert.Equal(t, day(2023, 12, 1), start)
+	assert.Equal(t, day(2024, 1, 1), end)
+}
+
+func TestParseExpenseFilterPeriod(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/expenses?period=last_month", nil)
+	f, err := parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "last_month", f.Period)
+
+	req, _ = http.NewRequest("GET", "/api/expenses?period=fortnight", nil)
+	_, err = parseExpenseFilter(req, true)
+	assert.Error(t, err, "Should reject an unknown period")
+
+	req, _ = http.NewRequest("GET", "/api/expenses?period=this_year&from=2024-01-01", nil)
+	_, err = parseExpenseFilter(req, true)
+	assert.Error(t, err, "Should reject period combined with from")
+}
+
+func TestParseExpenseFilterCurrency(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/expenses?currency=eur", nil)
+	f, err := parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "EUR", f.Currency)
+
+	req, _ = http.NewRequest("GET", "/api/expenses?currency=EURO", nil)
+	_, err = parseExpenseFilter(req, true)
+	assert.Error(t, err, "Should reject an unknown currency")
+}
+
+func TestParseExpenseFilterType(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/expenses", nil)
+	f, err := parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	assert.Empty(t, f.Type, "Should list both types by default")
+	assert.Equal(t, "expense", f.spending().Type, "Spending reports default to expenses")
+
+	req, _ = http.NewRequest("GET", "/api/expenses?type=income", nil)
+	f, err = parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	assert.Equal(t, "income", f.spending().Type)
+
+	req, _ = http.NewRequest("GET", "/api/expenses?type=salary", nil)
+	_, err = parseExpenseFilter(req, true)
+	assert.Error(t, err, "Should reject an unknown type")
+}
+
+func TestParseExpenseFilterSince(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/expenses?since=2024-05-01T10:00:00Z", nil)
+	f, err := parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	since := time.Date(2024, 5, 1, 10, 0, 0, 0, time.UTC)
+	assert.Equal(t, since, f.Since)
+
+	where, args := f.where(time.Now())
+	assert.Equal(t, " WHERE deleted_at IS NULL AND updated_at >= $1", where)
+	assert.Equal(t, []any{since}, args)
+
+	req, _ = http.NewRequest("GET", "/api/expenses?since=2024-05-01", nil)
+	_, err = parseExpenseFilter(req, true)
+	assert.Error(t, err, "Should require a full timestamp")
+}
+
+func TestParseExpenseFilterAmountRange(t *testing.T) {
+	req, _ := http.NewRequest("GET", "/api/expenses?min_amount=10&max_amount=25.50", nil)
+	f, err := parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	assert.Equal(t, Cents(1000), f.MinAmount)
+	assert.Equal(t, Cents(2550), f.MaxAmount)
+
+	where, args := f.where(time.Now())
+	assert.Equal(t, " WHERE deleted_at IS NULL AND amount BETWEEN $1 AND $2", where)
+	assert.Equal(t, []any{Cents(1000), Cents(2550)}, args)
+
+	// Either side may be left open
+	req, _ = http.NewRequest("GET", "/api/expenses?max_amount=5", nil)
+	f, err = parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+	where, _ = f.where(time.Now())
+	assert.Equal(t, " WHERE deleted_at IS NULL AND amount <= $1", where)
+
+	for _, query := range []string{
+		"min_amount=ten",
+		"max_amount=-5",
+		"min_amount=1.005",
+		"min_amount=20&max_amount=10",
+	} {
+		req, _ := http.NewRequest("GET", "/api/expenses?"+query, nil)
+		_, err := parseExpenseFilter(req, true)
+		assert.Error(t, err, query)
+	}
+
+	// Equal bounds are a valid, exact match
+	req, _ = http.NewRequest("GET", "/api/expenses?min_amount=12.50&max_amount=12.5", nil)
+	_, err = parseExpenseFilter(req, true)
+	assert.NoError(t, err)
+}
+
+func TestEscapeLike(t *testing.T) {
+	assert.Equal(t, "plain", escapeLike("plain"))
+	assert.Equal(t, `100\% \_off\\`, escapeLike(`100% _off\`))
+}
+
+func TestParseSort(t *testing.T) {
+	tests := map[string]string{
+		"":        " ORDER BY date DESC, id DESC",
+		"date":    " ORDER BY date ASC, id ASC",
+		"-date":   " ORDER BY date DESC, id DESC",
+		"amount":  " ORDER BY amount ASC, id ASC",
+		"-amount": " ORDER BY amount DESC, id DESC",
+
+		"-date,amount":  " ORDER BY date DESC, amount ASC, id ASC",
+		"amount,-date":  " ORDER BY amount ASC, date DESC, id DESC",
+		"-date,-amount": " ORDER BY date DESC, amount DESC, id DESC",
+	}
+	for v, want := range tests {
+		got, err := parseSort(v)
+		assert.NoError(t, err, v)
+		assert.Equal(t, want, got.orderBy(), v)
+	}
+
+	for _, v := range []string{
+		"description",
+		"--date",
+		"amount;DROP TABLE expenses",
+		"-date,amount;DROP TABLE expenses",
+		"date,(SELECT 1)",
+		"date,",
+		"date,-date",
+	} {
+		_, err := parseSort(v)
+		assert.Error(t, err, "Should reject %q", v)
+	}
+}
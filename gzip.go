@@ -0,0 +1,176 @@
+package main
+
+import (
+	"compress/gzip"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// gzipMinSize is the smallest response worth compressing; below it the
+// gzip framing costs more than it saves.
+const gzipMinSize = 1024
+
+// gzipWriter holds back the response until it has seen gzipMinSize bytes (or
+// the handler finishes), then either compresses it or passes it through
+// unchanged.
+type gzipWriter struct {
+	http.ResponseWriter
+	minSize int
+
+	status  int
+	buf     []byte
+	decided bool
+	gz      *gzip.Writer
+}
+
+func (gw *gzipWriter) WriteHeader(code int) {
+	if gw.status == 0 {
+		gw.status = code
+	}
+}
+
+func (gw *gzipWriter) Write(b []byte) (int, error) {
+	if gw.status == 0 {
+		gw.status = http.StatusOK
+	}
+	if !gw.decided {
+		gw.buf = append(gw.buf, b...)
+		if len(gw.buf) < gw.minSize {
+			return len(b), nil
+		}
+		if err := gw.decide(); err != nil {
+			return 0, err
+		}
+		return len(b), nil
+	}
+	if gw.gz != nil {
+		return gw.gz.Write(b)
+	}
+	return gw.ResponseWriter.Write(b)
+}
+
+// decide sends the headers, compressed or not, followed by whatever has
+// been buffered so far.
+func (gw *gzipWriter) decide() error {
+	gw.decided = true
+	h := gw.Header()
+	if len(gw.buf) >= gw.minSize && compressible(gw.status, h) {
+		h.Set("Content-Encoding", "gzip")
+		h.Del("Content-Length")
+		gw.gz = gzip.NewWriter(gw.ResponseWriter)
+	}
+	if gw.status != 0 {
+		gw.ResponseWriter.WriteHeader(gw.status)
+	}
+
+	buf := gw.buf
+	gw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if gw.gz != nil {
+		_, err = gw.gz.Write(buf)
+	} else {
+		_, err = gw.ResponseWriter.Write(buf)
+	}
+	return err
+}
+
+// close sends anything still buffered and finishes the gzip stream.
+func (gw *gzipWriter) close() error {
+	if !gw.decided {
+		if err := gw.decide(); err != nil {
+			return err
+		}
+	}
+	if gw.gz != nil {
+		return gw.gz.Close()
+	}
+	return nil
+}
+
+// Flush commits to a decision early so streamed responses aren't held back.
+func (gw *gzipWriter) Flush() {
+	if !gw.decided {
+		gw.decide()
+	}
+	if gw.gz != nil {
+		gw.gz.Flush()
+	}
+	http.NewResponseController(gw.ResponseWriter).Flush()
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (gw *gzipWriter) Unwrap() http.ResponseWriter {
+	return gw.ResponseWriter
+}
+
+// compressedTypes are content types that are already compressed, so gzip
+// would only add overhead.
+var compressedTypes = map[string]bool{
+	"application/gzip":   true,
+	"application/pdf":    true,
+	"application/zip":    true,
+	"application/x-gzip": true,
+}
+
+// compressible reports whether a response with this status and headers
+// should be gzipped.
+func compressible(status int, h http.Header) bool {
+	if status < http.StatusOK || status == http.StatusNoContent || status == http.StatusNotModified {
+		return false
+	}
+	if h.Get("Content-Encoding") != "" {
+		return false
+	}
+	mediaType, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	switch {
+	case mediaType == "image/svg+xml":
+		return true
+	case strings.HasPrefix(mediaType, "image/"),
+		strings.HasPrefix(mediaType, "audio/"),
+		strings.HasPrefix(mediaType, "video/"):
+		return false
+	}
+	return !compressedTypes[mediaType]
+}
+
+// acceptsGzip reports whether the client listed gzip in Accept-Encoding
+// without ruling it out with q=0.
+func acceptsGzip(r *http.Request) bool {
+	for _, part := range strings.Split(r.Header.Get("Accept-Encoding"), ",") {
+		coding, params, _ := strings.Cut(strings.TrimSpace(part), ";")
+		if !strings.EqualFold(strings.TrimSpace(coding), "gzip") {
+			continue
+		}
+		q, ok := strings.CutPrefix(strings.TrimSpace(params), "q=")
+		if !ok {
+			return true
+		}
+		weight, err := strconv.ParseFloat(q, 64)
+		return err == nil && weight > 0
+	}
+	return false
+}
+
+// gzipMiddleware compresses responses of at least minSize bytes for clients
+// that accept gzip. Small responses and content that is already compressed,
+// such as receipt images, are sent as is.
+func gzipMiddleware(minSize int) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Add("Vary", "Accept-Encoding")
+			if r.Method == http.MethodHead || !acceptsGzip(r) {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			gw := &gzipWriter{ResponseWriter: w, minSize: minSize}
+			defer gw.close()
+			next.ServeHTTP(gw, r)
+		})
+	}
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"compress/gzip"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGzipMiddleware(t *testing.T) {
+	large := "[" + strings.Repeat(`{"description":"Coffee","amount":3.5},`, 100) + `{}]`
+	small := `{"ok":true}`
+
+	handler := gzipMiddleware(gzipMinSize)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", r.URL.Query().Get("type"))
+		if r.URL.Query().Get("size") == "large" {
+			io.WriteString(w, large)
+			return
+		}
+		io.WriteString(w, small)
+	}))
+	serve := func(target, acceptEncoding string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", target, nil)
+		req.Header.Set("Accept-Encoding", acceptEncoding)
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// A large JSON response is compressed and decodes back to the original
+	rr := serve("/?size=large&type=application/json", "gzip, deflate")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "gzip", rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, "Accept-Encoding", rr.Header().Get("Vary"))
+	assert.Less(t, rr.Body.Len(), len(large), "Should be smaller than the original")
+
+	zr, err := gzip.NewReader(rr.Body)
+	assert.NoError(t, err)
+	body, err := io.ReadAll(zr)
+	assert.NoError(t, err)
+	assert.Equal(t, large, string(body))
+
+	// A small response is left plain
+	rr = serve("/?size=small&type=application/json", "gzip")
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, small, rr.Body.String())
+
+	// So is one the client didn't ask to have compressed
+	rr = serve("/?size=large&type=application/json", "gzip;q=0")
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, rr.Body.String())
+
+	// And content that is already compressed
+	rr = serve("/?size=large&type=image/png", "gzip")
+	assert.Empty(t, rr.Header().Get("Content-Encoding"))
+	assert.Equal(t, large, rr.Body.String())
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+)
+
+// readinessTimeout bounds the database ping done by the readiness probe so a
+// hung connection cannot stall the orchestrator.
+const readinessTimeout = 2 * time.Second
+
+// poolDegradedRatio is the share of the pool in use from which readiness
+// reports degraded: still serving, but close to making requests queue for
+// a connection.
+const poolDegradedRatio = 0.9
+
+// The values of the readiness statuses.
+const (
+	statusOK       = "ok"
+	statusDegraded = "degraded"
+	statusDown     = "down"
+)
+
+// Readiness is the body of /readyz. Status is the worst of the components'.
+type Readiness struct {
+	Status   string         `json:"status"`
+	Database DatabaseHealth `json:"database"`
+	Pool     PoolHealth     `json:"pool"`
+}
+
+// DatabaseHealth reports whether the database answered a ping.
+type DatabaseHealth struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// PoolHealth reports how much of the connection pool is in use.
+type PoolHealth struct {
+	Status        string  `json:"status"`
+	AcquiredConns int32   `json:"acquired_conns"`
+	MaxConns      int32   `json:"max_conns"`
+	Utilization   float64 `json:"utilization"`
+}
+
+// poolHealth rates a pool with acquired of its max connections in use.
+func poolHealth(acquired, max int32) PoolHealth {
+	p := PoolHealth{Status: statusOK, AcquiredConns: acquired, MaxConns: max}
+	if max > 0 {
+		p.Utilization = float64(acquired) / float64(max)
+	}
+	if p.Utilization >= poolDegradedRatio {
+		p.Status = statusDegraded
+	}
+	return p
+}
+
+// healthz reports liveness: the process is up and serving HTTP.
+func (app *App) healthz(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	w.Write([]byte("ok"))
+}
+
+// readyz reports readiness: 503 when the database is unreachable, and 200
+// otherwise, with a degraded status when the pool is nearly exhausted so
+// dashboards can see trouble coming before requests fail.
+func (app *App) readyz(w http.ResponseWriter, r *http.Request) {
+	ctx, cancel := context.WithTimeout(r.Context(), readinessTimeout)
+	defer cancel()
+
+	s := app.DBClient.Stat()
+	resp := Readiness{
+		Status:   statusOK,
+		Database: DatabaseHealth{Status: statusOK},
+		Pool:     poolHealth(s.AcquiredConns(), s.MaxConns()),
+	}
+
+	if err := app.DBClient.Ping(ctx); err != nil {
+		resp.Status = statusDown
+		resp.Database = DatabaseHealth{Status: statusDown, Error: "database unavailable"}
+		writeJSON(w, http.StatusServiceUnavailable, resp)
+		return
+	}
+
+	resp.Status = resp.Pool.Status
+	writeJSON(w, http.StatusOK, resp)
+}
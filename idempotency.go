@@ -0,0 +1,101 @@
+package main
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	idempotencyKeyHeader = "Idempotency-Key"
+
+	// idempotencyTTL is how long a key is remembered. After that the same
+	// key may be used again for a new request.
+	idempotencyTTL = 24 * time.Hour
+
+	maxIdempotencyKeyLength = 255
+)
+
+var errIdempotencyKeyReused = errors.New("Idempotency-Key has already been used with a different request body")
+
+// idempotentResponse is a response recorded under an Idempotency-Key.
+type idempotentResponse struct {
+	requestHash string
+	status      int
+	body        []byte
+}
+
+// parseIdempotencyKey returns the request's Idempotency-Key header, or ""
+// if none was sent.
+func parseIdempotencyKey(r *http.Request) (string, error) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if len(key) > maxIdempotencyKeyLength {
+		return "", fmt.Errorf("%s must be at most %d characters", idempotencyKeyHeader, maxIdempotencyKeyLength)
+	}
+	return key, nil
+}
+
+// requestHash fingerprints a decoded request so a replayed key can be told
+// apart from a key reused for something else.
+func requestHash(v any) (string, error) {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(b)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// lookupIdempotencyKey locks key for the rest of tx and returns the response
+// recorded under it, or nil if the key is new or has expired. Holding the
+// lock means a concurrent request with the same key waits for this one and
+// then sees its response.
+func lookupIdempotencyKey(ctx context.Context, tx pgx.Tx, key string) (*idempotentResponse, error) {
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock(hashtext('idempotency|' || $1))", key); err != nil {
+		return nil, err
+	}
+
+	var resp idempotentResponse
+	err := tx.QueryRow(ctx,
+		`SELECT request_hash, status_code, response FROM idempotency_keys
+		 WHERE key = $1 AND created_at > NOW() - $2::interval`,
+		key, idempotencyTTL).Scan(&resp.requestHash, &resp.status, &resp.body)
+	if errors.Is(err, pgx.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &resp, nil
+}
+
+// saveIdempotencyKey records the response sent for key, replacing any
+// expired entry.
+func saveIdempotencyKey(ctx context.Context, tx pgx.Tx, key string, expenseID int, resp idempotentResponse) error {
+	_, err := tx.Exec(ctx,
+		`INSERT INTO idempotency_keys (key, request_hash, expense_id, status_code, response)
+		 VALUES ($1, $2, $3, $4, $5)
+		 ON CONFLICT (key) DO UPDATE SET
+			request_hash = EXCLUDED.request_hash,
+			expense_id = EXCLUDED.expense_id,
+			status_code = EXCLUDED.status_code,
+			response = EXCLUDED.response,
+			created_at = NOW()`,
+		key, resp.requestHash, expenseID, resp.status, resp.body)
+	return err
+}
+
+// write replays the recorded response.
+func (resp idempotentResponse) write(w http.ResponseWriter) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Idempotent-Replayed", "true")
+	w.WriteHeader(resp.status)
+	w.Write(resp.body)
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCreateExpenseIdempotencyKey(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	key := fmt.Sprintf("test-key-%d", time.Now().UnixNano())
+	date := time.Now().Round(time.Second)
+
+	create := func(e Expense) *httptest.ResponseRecorder {
+		body, _ := json.Marshal(e)
+		req, _ := http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(body))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Idempotency-Key", key)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+	expense := Expense{
+		Description: "Train ticket",
+		Amount:      2780,
+		Category:    "Transport",
+		Date:        date,
+	}
+
+	// First request creates the expense
+	rr := create(expense)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var first Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &first))
+	assert.NotZero(t, first.ID)
+
+	// Replaying it returns the original response without inserting again
+	rr = create(expense)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should replay the original status")
+	assert.Equal(t, "true", rr.Header().Get("Idempotent-Replayed"))
+
+	var replayed Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &replayed))
+	assert.Equal(t, first.ID, replayed.ID, "Should return the same expense")
+
+	var count int
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM expenses WHERE description = $1 AND date = $2", expense.Description, date).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, count, "Should only insert once")
+
+	// The same key with a different body is rejected
+	expense.Amount = 3000
+	rr = create(expense)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should reject a reused key")
+}
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSMTPMailerMessage(t *testing.T) {
+	m := NewSMTPMailer(MailConfig{Host: "smtp.example.com", Port: 587, From: "tracker@example.com"})
+	assert.Equal(t, "smtp.example.com:587", m.addr)
+
+	msg := string(m.message(Email{
+		To:      "me@example.com",
+		Subject: "Budget exceeded: Food\r\nBcc: someone@example.com",
+		Body:    "line one\nline two",
+	}))
+
+	headers, body, ok := strings.Cut(msg, "\r\n\r\n")
+	assert.True(t, ok, "Headers and body should be separated by a blank line")
+	assert.Contains(t, headers, "From: tracker@example.com\r\n")
+	assert.Contains(t, headers, "To: me@example.com\r\n")
+	assert.NotContains(t, headers, "\r\nBcc:", "Line breaks in values must not start new headers")
+	assert.Equal(t, "line one\r\nline two", body)
+}
@@ -3,15 +3,22 @@ package main
 import (
 	"context"
 	"encoding/json"
+	"errors"
 	"fmt"
-	"log"
 	"log/slog"
 	"net/http"
 	"os"
+	"os/signal"
+	"strconv"
+	"strings"
 	"sync"
+	"sync/atomic"
+	"syscall"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
 	"github.com/jackc/pgx/v5/pgxpool"
 	"github.com/rs/cors"
 )
@@ -19,13 +26,195 @@ import (
 type Expense struct {
 	ID          int       `json:"id"`
 	Description string    `json:"description"`
-	Amount      float64   `json:"amount"`
+	Amount      Cents     `json:"amount"`
 	Category    string    `json:"category"`
 	Date        time.Time `json:"date"`
+	AccountID   int       `json:"account_id"`
+	Currency    string    `json:"currency"`
+
+	// Type is "expense" for money spent or "income" for money received.
+	// It defaults to "expense".
+	Type string `json:"type"`
+
+	// RefundOf is set on refunds to the expense they give money back on.
+	// It can only be set through the refunds endpoint.
+	RefundOf *int `json:"refund_of,omitempty"`
+
+	// NetCost is the amount less any refunds recorded against it.
+	NetCost Cents `json:"net_cost"`
+
+	// Tags are free-form labels, sorted by name. On update, leaving tags
+	// out keeps the current ones while an empty list removes them all.
+	Tags []string `json:"tags"`
+
+	// HasReceipt reports whether a receipt has been uploaded; fetch it from
+	// /api/expenses/{id}/receipt.
+	HasReceipt bool `json:"has_receipt"`
+
+	// Notes is an optional free-form annotation, up to maxNotesLength
+	// characters. On update, leaving notes out keeps them while an empty
+	// string removes them.
+	Notes *string `json:"notes,omitempty"`
+
+	// CreatedAt and UpdatedAt are set by the server and ignored on input.
+	// UpdatedAt moves forward on every change, including tag edits.
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+// expenseColumns is the select list matching scanExpense. The computed
+// columns give the net cost after the expense's live refunds, its tags,
+// and whether it has a receipt.
+const expenseColumns = `id, description, amount, category, date, account_id, currency, type, refund_of,
+	amount - COALESCE((SELECT SUM(r.amount)::bigint FROM expenses r
+		WHERE r.refund_of = expenses.id AND r.deleted_at IS NULL), 0),
+	COALESCE((SELECT array_agg(t.name ORDER BY lower(t.name)) FROM expense_tags et
+		JOIN tags t ON t.id = et.tag_id WHERE et.expense_id = expenses.id), '{}'),
+	receipt_key IS NOT NULL, created_at, updated_at, notes`
+
+// scanExpense reads a row selected with expenseColumns into e.
+func scanExpense(row pgx.Row, e *Expense) error {
+	return row.Scan(&e.ID, &e.Description, &e.Amount, &e.Category, &e.Date, &e.AccountID, &e.Currency,
+		&e.Type, &e.RefundOf, &e.NetCost, &e.Tags, &e.HasReceipt, &e.CreatedAt, &e.UpdatedAt, &e.Notes)
+}
+
+// netAmount is the SQL expression summaries add up: refunds count against
+// spending (or income) rather than towards it.
+const netAmount = "CASE WHEN refund_of IS NULL THEN amount ELSE -amount END"
+
+// The values of Expense.Type.
+const (
+	expenseTypeExpense = "expense"
+	expenseTypeIncome  = "income"
+)
+
+var expenseTypes = map[string]bool{expenseTypeExpense: true, expenseTypeIncome: true}
+
+// maxAmountCents caps amounts at what the DECIMAL(10,2) columns they were
+// once stored in could hold.
+const maxAmountCents Cents = 9999999999
+
+// maxNotesLength caps Expense.Notes.
+const maxNotesLength = 2000
+
+// FieldError reports one invalid field of a request body.
+type FieldError struct {
+	Field   string `json:"field"`
+	Message string `json:"message"`
+}
+
+// Validate checks the fields required by the expenses table and returns
+// every field that failed, so clients can flag them all at once.
+func (e Expense) Validate() []FieldError {
+	var errs []FieldError
+
+	if strings.TrimSpace(e.Description) == "" {
+		errs = append(errs, FieldError{"description", "description is required"})
+	}
+
+	switch {
+	case e.Amount <= 0:
+		errs = append(errs, FieldError{"amount", "amount must be greater than zero"})
+	case e.Amount > maxAmountCents:
+		errs = append(errs, FieldError{"amount", fmt.Sprintf("amount must not exceed %s", maxAmountCents)})
+	}
+
+	if strings.TrimSpace(e.Category) == "" {
+		errs = append(errs, FieldError{"category", "category is required"})
+	}
+
+	if e.Date.IsZero() {
+		errs = append(errs, FieldError{"date", "date is required"})
+	}
+
+	// An empty currency is filled in later: USD on create, unchanged on update.
+	if e.Currency != "" && !currencies[e.Currency] {
+		errs = append(errs, FieldError{"currency", fmt.Sprintf("currency %q is not a supported ISO 4217 code", e.Currency)})
+	}
+
+	// An empty type is filled in later: expense on create, unchanged on update.
+	if e.Type != "" && !expenseTypes[e.Type] {
+		errs = append(errs, FieldError{"type", fmt.Sprintf("type %q must be expense or income", e.Type)})
+	}
+
+	if e.Notes != nil && utf8.RuneCountInString(*e.Notes) > maxNotesLength {
+		errs = append(errs, FieldError{"notes", fmt.Sprintf("notes must be at most %d characters", maxNotesLength)})
+	}
+
+	for _, tag := range e.Tags {
+		if n := len(strings.TrimSpace(tag)); n == 0 || n > maxTagLength {
+			errs = append(errs, FieldError{"tags", fmt.Sprintf("tags must be between 1 and %d characters", maxTagLength)})
+			break
+		}
+	}
+
+	return errs
+}
+
+// futureDateTolerance lets clients whose clocks run a little ahead through
+// when future dates are rejected.
+const futureDateTolerance = 5 * time.Minute
+
+// validateExpense is Validate plus the checks that depend on the server's
+// configuration.
+func (app *App) validateExpense(e Expense) []FieldError {
+	errs := e.Validate()
+	if app.RejectFutureDates && e.Date.After(app.now().Add(futureDateTolerance)) {
+		errs = append(errs, FieldError{"date", "date must not be in the future"})
+	}
+	return errs
 }
 
 type App struct {
 	DBClient *pgxpool.Pool
+
+	// Rates converts summary totals between currencies.
+	Rates RateProvider
+
+	// Receipts stores uploaded receipt files.
+	Receipts BlobStore
+
+	// Clock is the time source for anything date-dependent. Nil means the
+	// wall clock.
+	Clock Clock
+
+	// MaxBodyBytes caps request bodies on routes without their own limit.
+	// Zero means defaultMaxBodyBytes.
+	MaxBodyBytes int64
+
+	// Webhooks delivers expense events to registered URLs. Nil disables
+	// them.
+	Webhooks *WebhookDispatcher
+
+	// Mailer sends budget alerts to BudgetAlertTo. Nil disables them.
+	Mailer        Mailer
+	BudgetAlertTo string
+
+	// budgetAlerts tracks alert checks running in the background.
+	budgetAlerts sync.WaitGroup
+
+	// QueryTimeout bounds the read queries run through queryWithTimeout,
+	// and those taking SlowQueryThreshold or longer are logged. Zero turns
+	// either off.
+	QueryTimeout       time.Duration
+	SlowQueryThreshold time.Duration
+
+	// Maintenance makes every route but reads refuse requests with 503.
+	// It starts from MAINTENANCE_MODE and can be flipped at runtime by
+	// callers holding AdminToken.
+	Maintenance atomic.Bool
+
+	// AdminToken is the bearer token PUT /api/admin/maintenance requires.
+	// Empty disables the runtime toggle.
+	AdminToken string
+
+	// RejectFutureDates makes validateExpense refuse expenses dated after
+	// now, for ledgers that should only record what has happened.
+	RejectFutureDates bool
+
+	// DevSeed registers POST /api/dev/seed, which fills the database with
+	// sample expenses. Never enable it in production.
+	DevSeed bool
 }
 
 type DBConfig struct {
@@ -39,27 +228,97 @@ type DBConfig struct {
 	MaxConnLifeTime   time.Duration
 	MaxConnIdleTime   time.Duration
 	HealthCheckPeriod time.Duration
+
+	// ConnectAttempts is how many times NewPg tries to reach the database
+	// before giving up, waiting ConnectRetryDelay after the first failure
+	// and twice as long after each one after that.
+	ConnectAttempts   int
+	ConnectRetryDelay time.Duration
 }
 
+// maxConnectRetryDelay caps the backoff between connection attempts.
+const maxConnectRetryDelay = 30 * time.Second
+
 var (
 	pgOnce sync.Once
 )
 
+// shutdownTimeout bounds how long in-flight requests get to finish once a
+// shutdown signal arrives.
+const shutdownTimeout = 15 * time.Second
+
 func main() {
 	rootCtx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
-	dbConfig := &DBConfig{
-		Host:              "localhost",
-		Port:              5432,
-		UserName:          "admin",
-		Password:          "admin",
-		DBName:            "expense_tracker",
-		MaxConns:          10,
-		MinConns:          2,
-		MaxConnLifeTime:   30 * time.Minute,
-		MaxConnIdleTime:   10 * time.Minute,
-		HealthCheckPeriod: 2 * time.Minute,
+	// Lines logged with a request's context carry its ID.
+	logLevel := new(slog.LevelVar)
+	slog.SetDefault(slog.New(requestIDLogHandler{slog.NewTextHandler(os.Stderr, &slog.HandlerOptions{Level: logLevel})}))
+
+	dbConfig, err := LoadConfig()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	bodyLogConfig, err := LoadBodyLogConfig()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	rateConfig, err := LoadRateConfig()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	rateLimitConfig, err := LoadRateLimitConfig()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	requestTimeout, err := LoadRequestTimeout()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	maxBodyBytes, err := LoadMaxBodyBytes()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	mailConfig, err := LoadMailConfig()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	queryConfig, err := LoadQueryConfig()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	maintenance, err := LoadMaintenanceMode()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	devSeed, err := LoadDevSeed()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
+	}
+
+	rejectFutureDates, err := LoadRejectFutureDates()
+	if err != nil {
+		slog.Error("Error loading configuration", "error", err)
+		os.Exit(1)
 	}
 
 	db, err := NewPg(rootCtx, dbConfig)
@@ -67,42 +326,212 @@ func main() {
 		slog.Error("Error connecting to database", "error", err)
 		os.Exit(1)
 	}
-	defer db.Close()
 
 	app := &App{
-		DBClient: db,
+		DBClient:     db,
+		Rates:        NewHTTPRateProvider(rateConfig.BaseURL, rateConfig.TTL),
+		Receipts:     NewLocalBlobStore(envOr("RECEIPTS_DIR", "receipts")),
+		Clock:        realClock{},
+		MaxBodyBytes: maxBodyBytes,
+
+		QueryTimeout:       queryConfig.Timeout,
+		SlowQueryThreshold: queryConfig.SlowThreshold,
+
+		RejectFutureDates: rejectFutureDates,
+		DevSeed:           devSeed,
+		AdminToken:        LoadAdminToken(),
+	}
+	if maintenance {
+		app.Maintenance.Store(true)
+		slog.Warn("Starting in maintenance mode; writes are refused")
+	}
+	if devSeed {
+		slog.Warn("Development seed endpoint enabled", "path", "/api/dev/seed")
 	}
 
 	if err := app.initDB(rootCtx); err != nil {
 		slog.Error("Error initializing database", "error", err)
+		db.Close()
+		os.Exit(1)
+	}
+
+	go app.runRecurringWorker(rootCtx, recurringCheckInterval)
+
+	if mailConfig.Host != "" {
+		app.Mailer = NewSMTPMailer(mailConfig)
+		app.BudgetAlertTo = mailConfig.AlertTo
+	}
+
+	app.Webhooks = NewWebhookDispatcher(webhookQueueSize)
+	app.Webhooks.record = app.recordWebhookDelivery
+	go app.Webhooks.Run(rootCtx, webhookWorkers)
+
+	c := cors.New(cors.Options{
+		AllowedOrigins:   LoadCORSOrigins(),
+		AllowedMethods:   []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+		AllowedHeaders:   []string{"Content-Type", requestIDHeader},
+		ExposedHeaders:   []string{requestIDHeader},
+		AllowCredentials: true,
+	})
+
+	port := envOr("PORT", "3001")
+
+	var handler http.Handler = app.routes()
+	if requestTimeout > 0 {
+		handler = timeoutMiddleware(requestTimeout)(handler)
+	}
+	if bodyLogConfig.Enabled {
+		// Body logs are emitted at debug level, so turn that on too.
+		logLevel.Set(slog.LevelDebug)
+		handler = bodyLoggingMiddleware(bodyLogConfig.MaxBytes)(handler)
+		slog.Warn("Request/response body logging enabled", "max_bytes", bodyLogConfig.MaxBytes)
+	}
+	// Outside body logging, so logged bodies stay readable.
+	handler = gzipMiddleware(gzipMinSize)(handler)
+	if rateLimitConfig.RequestsPerSecond > 0 {
+		limiter := newIPRateLimiter(rateLimitConfig.RequestsPerSecond, rateLimitConfig.Burst)
+		go limiter.runPruner(rootCtx, time.Minute)
+		handler = rateLimitMiddleware(limiter)(handler)
+	}
+
+	srv := &http.Server{
+		Addr:              "0.0.0.0:" + port,
+		Handler:           c.Handler(requestIDMiddleware(loggingMiddleware(handler))),
+		ReadHeaderTimeout: 10 * time.Second,
+	}
+
+	serverErr := make(chan error, 1)
+	go func() {
+		slog.Info("Server starting", "port", port, "version", version, "commit", commit)
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			serverErr <- err
+		}
+	}()
+
+	stop := make(chan os.Signal, 1)
+	signal.Notify(stop, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-serverErr:
+		slog.Error("Server failed", "error", err)
+		db.Close()
 		os.Exit(1)
+	case sig := <-stop:
+		slog.Info("Shutdown signal received", "signal", sig.String())
+	}
+
+	shutdownCtx, cancelShutdown := context.WithTimeout(context.Background(), shutdownTimeout)
+	defer cancelShutdown()
+
+	slog.Info("Draining in-flight requests", "timeout", shutdownTimeout)
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		slog.Error("Error shutting down server", "error", err)
 	}
 
+	// Let budget alerts for the drained requests finish while the pool is
+	// still open.
+	if !app.waitForBudgetAlerts(shutdownCtx) {
+		slog.Warn("Budget alerts still running at shutdown")
+	}
+
+	// Stop anything tied to the root context before the pool goes away.
+	cancel()
+	db.Close()
+	slog.Info("Server stopped")
+}
+
+// routes builds the router with every API endpoint registered.
+func (app *App) routes() *mux.Router {
 	r := mux.NewRouter()
+	r.NotFoundHandler = http.HandlerFunc(notFound)
+	r.MethodNotAllowedHandler = methodNotAllowed(r)
+	m := newMetrics(app)
+	r.Use(m.middleware, recoverMiddleware, app.maintenanceMiddleware, app.bodyLimitMiddleware, requireJSONMiddleware)
+
+	// Probes are registered outside /api so they never sit behind auth.
+	r.HandleFunc("/healthz", app.healthz).Methods("GET")
+	r.HandleFunc("/readyz", app.readyz).Methods("GET")
+	r.Handle("/metrics", m.handler()).Methods("GET")
+	r.HandleFunc("/openapi.json", getOpenAPISpec).Methods("GET")
+	r.HandleFunc("/version", getVersion).Methods("GET")
 
 	// Expense routes
 	r.HandleFunc("/api/expenses", app.getExpenses).Methods("GET")
 	r.HandleFunc("/api/expenses", app.createExpense).Methods("POST")
+	r.HandleFunc("/api/expenses/bulk", app.createExpensesBulk).Methods("POST")
+	r.HandleFunc("/api/expenses/batch-delete", app.deleteExpensesBatch).Methods("POST")
+	r.HandleFunc("/api/expenses/from-template/{id}", app.createExpenseFromTemplate).Methods("POST")
+	r.HandleFunc("/api/expenses/export.csv", app.exportExpensesCSV).Methods("GET")
+	r.HandleFunc("/api/expenses/search", app.searchExpenses).Methods("GET")
+	r.HandleFunc("/api/expenses/summary", app.getExpenseSummary).Methods("GET")
+	r.HandleFunc("/api/expenses/sync", app.syncExpenses).Methods("GET")
+	r.HandleFunc("/api/expenses/top-categories", app.getTopCategories).Methods("GET")
 	r.HandleFunc("/api/expenses/{id}", app.updateExpense).Methods("PUT")
+	r.HandleFunc("/api/expenses/{id}", app.patchExpense).Methods("PATCH")
 	r.HandleFunc("/api/expenses/{id}", app.deleteExpense).Methods("DELETE")
+	r.HandleFunc("/api/expenses/{id}/restore", app.restoreExpense).Methods("POST")
+	r.HandleFunc("/api/expenses/{id}/refunds", app.createRefund).Methods("POST")
+	r.HandleFunc("/api/expenses/{id}/history", app.getExpenseHistory).Methods("GET")
+	r.HandleFunc("/api/expenses/{id}/receipt", app.uploadReceipt).Methods("POST")
+	r.HandleFunc("/api/expenses/{id}/receipt", app.getReceipt).Methods("GET")
 
-	c := cors.New(cors.Options{
-		AllowedOrigins:   []string{"http://localhost:3000", "http://54.226.1.246:3000"},
-		AllowedMethods:   []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowedHeaders:   []string{"Content-Type"},
-		AllowCredentials: true,
-	})
+	// Analytics routes
+	r.HandleFunc("/api/analytics/by-category", app.getSpendingByCategory).Methods("GET")
+	r.HandleFunc("/api/analytics/trend", app.getSpendingTrend).Methods("GET")
+	r.HandleFunc("/api/analytics/top", app.getTopExpenses).Methods("GET")
+	r.HandleFunc("/api/analytics/averages", app.getSpendingAverages).Methods("GET")
+
+	// Account routes
+	r.HandleFunc("/api/accounts", app.getAccounts).Methods("GET")
+	r.HandleFunc("/api/accounts", app.createAccount).Methods("POST")
+	r.HandleFunc("/api/accounts/{id}", app.updateAccount).Methods("PUT")
+	r.HandleFunc("/api/accounts/{id}", app.deleteAccount).Methods("DELETE")
+
+	// Transfer routes
+	r.HandleFunc("/api/transfers", app.createTransfer).Methods("POST")
+
+	// Category routes
+	r.HandleFunc("/api/categories", app.getCategories).Methods("GET")
+	r.HandleFunc("/api/categories", app.createCategory).Methods("POST")
+	r.HandleFunc("/api/categories/{id}", app.deleteCategory).Methods("DELETE")
+
+	// Budget routes
+	r.HandleFunc("/api/budgets", app.getBudgets).Methods("GET")
+	r.HandleFunc("/api/budgets", app.setBudget).Methods("POST")
+
+	// Admin routes
+	r.HandleFunc("/api/admin/db-stats", app.getDBStats).Methods("GET")
+	r.HandleFunc(maintenanceRoute, app.getMaintenance).Methods("GET")
+	r.HandleFunc(maintenanceRoute, app.setMaintenance).Methods("PUT")
+
+	// Recurring expense routes
+	r.HandleFunc("/api/recurring-expenses", app.getRecurringExpenses).Methods("GET")
+	r.HandleFunc("/api/recurring-expenses", app.createRecurringExpense).Methods("POST")
+
+	// Template routes
+	r.HandleFunc("/api/templates", app.getTemplates).Methods("GET")
+	r.HandleFunc("/api/templates", app.createTemplate).Methods("POST")
+	r.HandleFunc("/api/templates/{id}", app.deleteTemplate).Methods("DELETE")
+
+	// Webhook routes
+	r.HandleFunc("/api/webhooks", app.getWebhooks).Methods("GET")
+	r.HandleFunc("/api/webhooks", app.createWebhook).Methods("POST")
+	r.HandleFunc("/api/webhooks/{id}", app.deleteWebhook).Methods("DELETE")
+	r.HandleFunc("/api/webhooks/{id}/deliveries", app.getWebhookDeliveries).Methods("GET")
 
-	port := os.Getenv("PORT")
-	if port == "" {
-		port = "3001"
+	// Development routes, left out of the OpenAPI document
+	if app.DevSeed {
+		r.HandleFunc("/api/dev/seed", app.seedDemoData).Methods("POST")
 	}
 
-	slog.Info("Server starting", "port", port)
-	log.Fatal(http.ListenAndServe("0.0.0.0:"+port, c.Handler(r)))
+	return r
 }
 
 func NewPg(ctx context.Context, dbConfig *DBConfig) (*pgxpool.Pool, error) {
+	if err := dbConfig.Validate(); err != nil {
+		return nil, err
+	}
+
 	connString := fmt.Sprintf("postgresql://%s:%s@%s:%d/%s?sslmode=disable",
 		dbConfig.UserName, dbConfig.Password, dbConfig.Host, dbConfig.Port, dbConfig.DBName)
 
@@ -122,7 +551,8 @@ func NewPg(ctx context.Context, dbConfig *DBConfig) (*pgxpool.Pool, error) {
 		return nil, fmt.Errorf("unable to create connection pool: %w", err)
 	}
 
-	if err = db.Ping(ctx); err != nil {
+	if err = pingWithRetry(ctx, db, dbConfig.ConnectAttempts, dbConfig.ConnectRetryDelay); err != nil {
+		db.Close()
 		return nil, fmt.Errorf("unable to ping database: %w", err)
 	}
 
@@ -130,60 +560,238 @@ func NewPg(ctx context.Context, dbConfig *DBConfig) (*pgxpool.Pool, error) {
 	return db, nil
 }
 
-func (app *App) initDB(ctx context.Context) error {
-	_, err := app.DBClient.Exec(ctx, `
-		CREATE TABLE IF NOT EXISTS expenses (
-			id SERIAL PRIMARY KEY,
-			description TEXT NOT NULL,
-			amount DECIMAL(10,2) NOT NULL,
-			category TEXT NOT NULL,
-			date TIMESTAMP NOT NULL
+// pingWithRetry pings the database up to attempts times with exponential
+// backoff starting at delay, so the server can start before Postgres is
+// accepting connections. It returns the last error once every attempt has
+// failed, or straight away if ctx is cancelled.
+func pingWithRetry(ctx context.Context, db *pgxpool.Pool, attempts int, delay time.Duration) error {
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	for attempt := 1; ; attempt++ {
+		err := db.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		slog.Warn("Database ping failed",
+			"attempt", attempt,
+			"max_attempts", attempts,
+			"error", err,
 		)
-	`)
-	return err
+		if attempt >= attempts || ctx.Err() != nil {
+			return err
+		}
+
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return ctx.Err()
+		}
+		delay = min(delay*2, maxConnectRetryDelay)
+	}
 }
 
+// initDB brings the schema up to date by running pending migrations.
+func (app *App) initDB(ctx context.Context) error {
+	return app.migrate(ctx)
+}
+
+// getExpenses lists the expenses matching the filters as a bare array.
+// With ?paginated=true it returns one page at a time instead, wrapped in
+// {data, pagination}; see listExpensePage. Either way the response carries
+// an ETag and If-None-Match is answered with 304 when nothing changed.
 func (app *App) getExpenses(w http.ResponseWriter, r *http.Request) {
-	rows, err := app.DBClient.Query(r.Context(),
-		"SELECT id, description, amount, category, date FROM expenses ORDER BY date DESC")
+	filter, err := parseExpenseFilter(r, true)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	order, err := parseSort(r.URL.Query().Get("sort"))
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
-	defer rows.Close()
 
+	paginated, err := parseBoolParam(r, "paginated", false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if paginated {
+		app.listExpensePage(w, r, filter, order)
+		return
+	}
+	if q := r.URL.Query(); q.Has("limit") || q.Has("cursor") {
+		writeJSONError(w, http.StatusBadRequest, "limit and cursor require paginated=true")
+		return
+	}
+
+	where, args := filter.where(app.now())
 	var expenses []Expense
-	for rows.Next() {
-		var e Expense
-		err := rows.Scan(&e.ID, &e.Description, &e.Amount, &e.Category, &e.Date)
+	err = app.queryWithTimeout(r.Context(), "list expenses", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx,
+			"SELECT "+expenseColumns+" FROM expenses"+where+order.orderBy(), args...)
 		if err != nil {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-			return
+			return err
 		}
-		expenses = append(expenses, e)
+		defer rows.Close()
+
+		for rows.Next() {
+			var e Expense
+			if err := scanExpense(rows, &e); err != nil {
+				return err
+			}
+			expenses = append(expenses, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeQueryError(w, err)
+		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(expenses)
+	writeJSONWithETag(w, r, expenses)
 }
 
+// createExpense adds an expense. Unless ?force=true, a live expense in the
+// same account with the same amount, currency and category dated within a
+// minute is taken for a double submission and answered with 409 Conflict.
+//
+// A request carrying an Idempotency-Key header that was already used in the
+// last 24 hours gets the original response back instead of a new expense,
+// or 422 if the body differs from the original.
 func (app *App) createExpense(w http.ResponseWriter, r *http.Request) {
+	force, err := parseBoolParam(r, "force", false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	idempotencyKey, err := parseIdempotencyKey(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
 	var expense Expense
-	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeStrict(r, &expense); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	expense.Currency = normalizeCurrency(expense.Currency)
+
+	if errs := app.validateExpense(expense); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	category, err := app.resolveCategory(r.Context(), expense.Category)
+	if errors.Is(err, errUnknownCategory) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	expense.Category = category
+
+	if expense.Currency == "" {
+		expense.Currency = defaultCurrency
+	}
+	if expense.Type == "" {
+		expense.Type = expenseTypeExpense
+	}
+
+	hash, err := requestHash(expense)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	defer tx.Rollback(r.Context())
 
-	err := app.DBClient.QueryRow(r.Context(),
-		"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4) RETURNING id",
-		expense.Description, expense.Amount, expense.Category, expense.Date).Scan(&expense.ID)
+	if idempotencyKey != "" {
+		prior, err := lookupIdempotencyKey(r.Context(), tx, idempotencyKey)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if prior != nil {
+			if prior.requestHash != hash {
+				writeJSONError(w, http.StatusUnprocessableEntity, errIdempotencyKeyReused.Error())
+				return
+			}
+			prior.write(w)
+			return
+		}
+	}
+
+	if !force {
+		existing, err := findDuplicate(r.Context(), tx, expense)
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		if existing != nil {
+			writeDuplicate(w, *existing)
+			return
+		}
+	}
+
+	// An account_id of zero means "not given" and falls back to the default
+	// account.
+	tags := expense.Tags
+	err = scanExpense(tx.QueryRow(r.Context(),
+		`INSERT INTO expenses (description, amount, category, date, account_id, currency, type, notes)
+		 VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, 0), default_account_id()), $6, $7, NULLIF($8, ''))
+		 RETURNING `+expenseColumns,
+		expense.Description, expense.Amount, expense.Category, expense.Date, expense.AccountID, expense.Currency, expense.Type, expense.Notes),
+		&expense)
+	if isPgError(err, pgForeignKeyViolation) {
+		writeJSONError(w, http.StatusBadRequest, "account does not exist")
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
 
+	if expense.Tags, err = setExpenseTags(r.Context(), tx, expense.ID, tags); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	body, err := json.Marshal(expense)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	body = append(body, '\n')
+	if idempotencyKey != "" {
+		resp := idempotentResponse{requestHash: hash, status: http.StatusCreated, body: body}
+		if err := saveIdempotencyKey(r.Context(), tx, idempotencyKey, expense.ID, resp); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.publishWebhookEvent(r.Context(), eventExpenseCreated, expense)
+	app.queueBudgetAlerts(r.Context(), expense)
+
 	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(expense)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(body)
 }
 
 func (app *App) updateExpense(w http.ResponseWriter, r *http.Request) {
@@ -191,32 +799,231 @@ func (app *App) updateExpense(w http.ResponseWriter, r *http.Request) {
 	id := vars["id"]
 
 	var expense Expense
-	if err := json.NewDecoder(r.Body).Decode(&expense); err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+	if err := decodeStrict(r, &expense); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	expense.Currency = normalizeCurrency(expense.Currency)
+
+	if errs := app.validateExpense(expense); len(errs) > 0 {
+		writeValidationErrors(w, errs)
 		return
 	}
 
-	_, err := app.DBClient.Exec(r.Context(),
-		"UPDATE expenses SET description=$1, amount=$2, category=$3, date=$4 WHERE id=$5",
-		expense.Description, expense.Amount, expense.Category, expense.Date, id)
+	category, err := app.resolveCategory(r.Context(), expense.Category)
+	if errors.Is(err, errUnknownCategory) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	expense.Category = category
 
-	w.Header().Set("Content-Type", "application/json")
-	json.NewEncoder(w).Encode(expense)
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Leaving account_id, currency, type, notes or tags out keeps the
+	// current value.
+	tags := expense.Tags
+	err = scanExpense(tx.QueryRow(r.Context(),
+		`UPDATE expenses SET description=$1, amount=$2, category=$3, date=$4,
+		 account_id=COALESCE(NULLIF($5, 0), account_id),
+		 currency=COALESCE(NULLIF($6, ''), currency),
+		 type=COALESCE(NULLIF($7, ''), type),
+		 notes=CASE WHEN $8::text IS NULL THEN notes ELSE NULLIF($8, '') END
+		 WHERE id=$9 AND deleted_at IS NULL RETURNING `+expenseColumns,
+		expense.Description, expense.Amount, expense.Category, expense.Date, expense.AccountID, expense.Currency, expense.Type,
+		expense.Notes, id),
+		&expense)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "expense not found")
+		return
+	}
+	if isPgError(err, pgForeignKeyViolation) {
+		writeJSONError(w, http.StatusBadRequest, "account does not exist")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	err = checkRefundLimit(r.Context(), tx, expense)
+	if errors.Is(err, errRefundLimit) || errors.Is(err, errRefundedDeleted) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if tags != nil {
+		if expense.Tags, err = setExpenseTags(r.Context(), tx, expense.ID, tags); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expense)
+}
+
+// softDeleteExpenses soft deletes the live expenses among ids along with
+// their refunds, which would otherwise go on being subtracted from totals.
+// The rows stay so they can be restored, but receipts are removed for good:
+// it returns how many of ids were deleted and the receipt keys to delete.
+func softDeleteExpenses(ctx context.Context, tx pgx.Tx, ids []int) (int, []string, error) {
+	// Locking the expenses first serialises this against createRefund, so
+	// the update below sees every refund committed before it.
+	rows, err := tx.Query(ctx, "SELECT id FROM expenses WHERE id = ANY($1) AND deleted_at IS NULL FOR UPDATE", ids)
+	if err != nil {
+		return 0, nil, err
+	}
+	var live []int
+	for rows.Next() {
+		var id int
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return 0, nil, err
+		}
+		live = append(live, id)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil || len(live) == 0 {
+		return 0, nil, err
+	}
+
+	rows, err = tx.Query(ctx, `
+		WITH old AS (
+			SELECT id, receipt_key FROM expenses
+			WHERE (id = ANY($1) OR refund_of = ANY($1)) AND deleted_at IS NULL
+			FOR UPDATE
+		)
+		UPDATE expenses e SET deleted_at = NOW(), receipt_key = NULL, receipt_content_type = NULL
+		FROM old WHERE e.id = old.id
+		RETURNING old.receipt_key`, live)
+	if err != nil {
+		return 0, nil, err
+	}
+	defer rows.Close()
+
+	var keys []string
+	for rows.Next() {
+		var key *string
+		if err := rows.Scan(&key); err != nil {
+			return 0, nil, err
+		}
+		if key != nil {
+			keys = append(keys, *key)
+		}
+	}
+	return len(live), keys, rows.Err()
 }
 
 func (app *App) deleteExpense(w http.ResponseWriter, r *http.Request) {
 	vars := mux.Vars(r)
-	id := vars["id"]
+	id, err := strconv.Atoi(vars["id"])
+	if err != nil {
+		writeJSONError(w, http.StatusNotFound, "expense not found")
+		return
+	}
 
-	_, err := app.DBClient.Exec(r.Context(), "DELETE FROM expenses WHERE id=$1", id)
+	tx, err := app.DBClient.Begin(r.Context())
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
 		return
 	}
+	defer tx.Rollback(r.Context())
+
+	deleted, receiptKeys, err := softDeleteExpenses(r.Context(), tx, []int{id})
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if deleted == 0 {
+		writeJSONError(w, http.StatusNotFound, "expense not found")
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	for _, key := range receiptKeys {
+		app.deleteBlob(r, key)
+	}
 
 	w.WriteHeader(http.StatusNoContent)
 }
+
+// restoreExpense undoes a soft delete, bringing back the refunds that were
+// deleted with the expense. A refund can only be restored while the expense
+// it refunds is live and has enough left to refund.
+func (app *App) restoreExpense(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Refunds deleted along with the expense share its deleted_at.
+	_, err = tx.Exec(r.Context(), `
+		WITH old AS (
+			SELECT id, deleted_at FROM expenses WHERE id=$1 AND deleted_at IS NOT NULL FOR UPDATE
+		)
+		UPDATE expenses e SET deleted_at = NULL
+		FROM old WHERE e.refund_of = old.id AND e.deleted_at = old.deleted_at`, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var expense Expense
+	err = scanExpense(tx.QueryRow(r.Context(),
+		"UPDATE expenses SET deleted_at = NULL WHERE id=$1 AND deleted_at IS NOT NULL RETURNING "+expenseColumns, id),
+		&expense)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "deleted expense not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if expense.RefundOf != nil {
+		err = checkRefundLimit(r.Context(), tx, expense)
+		if errors.Is(err, errRefundedDeleted) {
+			writeJSONError(w, http.StatusConflict, "cannot restore a refund of a deleted expense; restore that expense first")
+			return
+		}
+		if errors.Is(err, errRefundLimit) {
+			writeJSONError(w, http.StatusConflict, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expense)
+}
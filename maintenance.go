@@ -0,0 +1,85 @@
+package main
+
+import (
+	"crypto/subtle"
+	"log/slog"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// maintenanceRetryAfter is the Retry-After sent with writes refused during
+// maintenance, in seconds.
+const maintenanceRetryAfter = 120
+
+// maintenanceRoute is left writable during maintenance so it can be turned
+// off again. Changing the mode needs ADMIN_TOKEN.
+const maintenanceRoute = "/api/admin/maintenance"
+
+// maintenanceMiddleware refuses anything but reads with 503 while
+// maintenance mode is on, so migrations can run against a database nobody
+// is writing to.
+func (app *App) maintenanceMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !app.Maintenance.Load() {
+			next.ServeHTTP(w, r)
+			return
+		}
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+		if current := mux.CurrentRoute(r); current != nil {
+			if route, _ := current.GetPathTemplate(); route == maintenanceRoute {
+				next.ServeHTTP(w, r)
+				return
+			}
+		}
+
+		w.Header().Set("Retry-After", strconv.Itoa(maintenanceRetryAfter))
+		writeJSONError(w, http.StatusServiceUnavailable, "the service is in maintenance mode; try again later")
+	})
+}
+
+// maintenanceStatus is the body of the maintenance endpoints.
+type maintenanceStatus struct {
+	Enabled bool `json:"enabled"`
+}
+
+func (app *App) getMaintenance(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, maintenanceStatus{Enabled: app.Maintenance.Load()})
+}
+
+// setMaintenance turns maintenance mode on or off. Since it can stop every
+// write, it needs the admin token as a bearer token; without ADMIN_TOKEN
+// the mode can only be set at startup.
+func (app *App) setMaintenance(w http.ResponseWriter, r *http.Request) {
+	if !app.isAdmin(r) {
+		w.Header().Set("WWW-Authenticate", "Bearer")
+		writeJSONError(w, http.StatusUnauthorized, "an admin token is required to change maintenance mode")
+		return
+	}
+
+	var req maintenanceStatus
+	if err := decodeStrict(r, &req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	app.Maintenance.Store(req.Enabled)
+	slog.InfoContext(r.Context(), "Maintenance mode changed", "enabled", req.Enabled)
+	writeJSON(w, http.StatusOK, req)
+}
+
+// isAdmin reports whether r carries AdminToken as a bearer token. It is
+// always false when no token is configured.
+func (app *App) isAdmin(r *http.Request) bool {
+	if app.AdminToken == "" {
+		return false
+	}
+	token, ok := strings.CutPrefix(r.Header.Get("Authorization"), "Bearer ")
+	return ok && subtle.ConstantTimeCompare([]byte(token), []byte(app.AdminToken)) == 1
+}
@@ -0,0 +1,86 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMaintenanceMode(t *testing.T) {
+	app := &App{AdminToken: "s3cret"}
+	app.Maintenance.Store(true)
+	router := app.routes()
+
+	// Writes are refused
+	for _, method := range []string{"POST", "PUT", "PATCH", "DELETE"} {
+		target := "/api/expenses/1"
+		if method == "POST" {
+			target = "/api/expenses"
+		}
+		req, _ := http.NewRequest(method, target, bytes.NewBufferString(`{}`))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusServiceUnavailable, rr.Code, method)
+		assert.Equal(t, "120", rr.Header().Get("Retry-After"), method)
+	}
+
+	// Reads still work
+	for _, target := range []string{"/healthz", "/openapi.json", "/api/admin/maintenance"} {
+		req, _ := http.NewRequest("GET", target, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusOK, rr.Code, target)
+	}
+
+	// Changing the mode needs the admin token
+	for _, auth := range []string{"", "Bearer wrong", "s3cret"} {
+		req, _ := http.NewRequest("PUT", "/api/admin/maintenance", bytes.NewBufferString(`{"enabled": false}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", auth)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, auth)
+		assert.Equal(t, "Bearer", rr.Header().Get("WWW-Authenticate"), auth)
+		assert.True(t, app.Maintenance.Load(), auth)
+	}
+
+	// The toggle itself stays writable, so maintenance can be ended
+	req, _ := http.NewRequest("PUT", "/api/admin/maintenance", bytes.NewBufferString(`{"enabled": false}`))
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer s3cret")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.False(t, app.Maintenance.Load())
+
+	var status maintenanceStatus
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &status))
+	assert.False(t, status.Enabled)
+
+	// Writes reach the handlers again
+	req, _ = http.NewRequest("POST", "/api/expenses", bytes.NewBufferString(`{"ammount": 1}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should be rejected by the handler, not maintenance")
+}
+
+func TestMaintenanceToggleDisabledWithoutAdminToken(t *testing.T) {
+	app := &App{}
+	router := app.routes()
+
+	for _, auth := range []string{"", "Bearer "} {
+		req, _ := http.NewRequest("PUT", "/api/admin/maintenance", bytes.NewBufferString(`{"enabled": true}`))
+		req.Header.Set("Content-Type", "application/json")
+		req.Header.Set("Authorization", auth)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusUnauthorized, rr.Code, auth)
+		assert.False(t, app.Maintenance.Load(), auth)
+	}
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+// metrics holds the Prometheus collectors for one router. Each router gets
+// its own registry so building several (as the tests do) never collides.
+type metrics struct {
+	registry *prometheus.Registry
+	requests *prometheus.CounterVec
+	latency  *prometheus.HistogramVec
+}
+
+func newMetrics(app *App) *metrics {
+	m := &metrics{
+		registry: prometheus.NewRegistry(),
+		requests: prometheus.NewCounterVec(prometheus.CounterOpts{
+			Name: "http_requests_total",
+			Help: "HTTP requests handled, by route template, method and status code.",
+		}, []string{"route", "method", "status"}),
+		latency: prometheus.NewHistogramVec(prometheus.HistogramOpts{
+			Name:    "http_request_duration_seconds",
+			Help:    "HTTP request latency, by route template and method.",
+			Buckets: prometheus.DefBuckets,
+		}, []string{"route", "method"}),
+	}
+	m.registry.MustRegister(m.requests, m.latency)
+
+	if app.DBClient != nil {
+		pool := app.DBClient
+		m.registry.MustRegister(
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "db_pool_acquired_connections",
+				Help: "Database connections currently checked out of the pool.",
+			}, func() float64 { return float64(pool.Stat().AcquiredConns()) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "db_pool_idle_connections",
+				Help: "Database connections idle in the pool.",
+			}, func() float64 { return float64(pool.Stat().IdleConns()) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "db_pool_total_connections",
+				Help: "Database connections open in the pool.",
+			}, func() float64 { return float64(pool.Stat().TotalConns()) }),
+			prometheus.NewGaugeFunc(prometheus.GaugeOpts{
+				Name: "db_pool_max_connections",
+				Help: "Maximum size of the database pool.",
+			}, func() float64 { return float64(pool.Stat().MaxConns()) }),
+		)
+	}
+
+	return m
+}
+
+// handler serves the collected metrics in the Prometheus text format.
+func (m *metrics) handler() http.Handler {
+	return promhttp.HandlerFor(m.registry, promhttp.HandlerOpts{})
+}
+
+// middleware counts and times every matched request. Requests are labelled
+// with the route template (/api/expenses/{id}) rather than the raw path so
+// IDs don't explode the label cardinality.
+func (m *metrics) middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := "unknown"
+		if current := mux.CurrentRoute(r); current != nil {
+			if tmpl, err := current.GetPathTemplate(); err == nil {
+				route = tmpl
+			}
+		}
+
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+		next.ServeHTTP(rec, r)
+
+		m.requests.WithLabelValues(route, r.Method, strconv.Itoa(rec.Status())).Inc()
+		m.latency.WithLabelValues(route, r.Method).Observe(time.Since(start).Seconds())
+	})
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMetricsCountsRequests(t *testing.T) {
+	router := (&App{}).routes()
+
+	// Hit a route twice
+	for i := 0; i < 2; i++ {
+		req, _ := http.NewRequest("GET", "/healthz", nil)
+		router.ServeHTTP(httptest.NewRecorder(), req)
+	}
+
+	// Scrape
+	req, _ := http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	body := rr.Body.String()
+	assert.Contains(t, body, `http_requests_total{method="GET",route="/healthz",status="200"} 2`)
+	assert.Contains(t, body, `http_request_duration_seconds_count{method="GET",route="/healthz"} 2`)
+}
+
+func TestMetricsUseRouteTemplate(t *testing.T) {
+	router := (&App{}).routes()
+
+	// An empty body makes the handler fail before it reaches the database
+	req, _ := http.NewRequest("PUT", "/api/expenses/42", nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	req, _ = http.NewRequest("GET", "/metrics", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Contains(t, rr.Body.String(), `route="/api/expenses/{id}"`, "Should label by template, not raw path")
+	assert.NotContains(t, rr.Body.String(), `route="/api/expenses/42"`)
+}
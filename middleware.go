@@ -0,0 +1,97 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+	"time"
+)
+
+// statusRecorder wraps an http.ResponseWriter to remember the status code
+// written by the handler.
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (rec *statusRecorder) WriteHeader(code int) {
+	if rec.status == 0 {
+		rec.status = code
+	}
+	rec.ResponseWriter.WriteHeader(code)
+}
+
+func (rec *statusRecorder) Write(b []byte) (int, error) {
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	return rec.ResponseWriter.Write(b)
+}
+
+// Status returns the status code sent to the client, defaulting to 200 when
+// the handler wrote nothing.
+func (rec *statusRecorder) Status() int {
+	if rec.status == 0 {
+		return http.StatusOK
+	}
+	return rec.status
+}
+
+// Unwrap lets http.ResponseController reach the underlying writer.
+func (rec *statusRecorder) Unwrap() http.ResponseWriter {
+	return rec.ResponseWriter
+}
+
+// loggingMiddleware logs one line per request with its method, path,
+// response status, latency and remote address.
+func loggingMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		start := time.Now()
+		rec := &statusRecorder{ResponseWriter: w}
+
+		next.ServeHTTP(rec, r)
+
+		slog.InfoContext(r.Context(), "Request handled",
+			"method", r.Method,
+			"path", r.URL.Path,
+			"status", rec.Status(),
+			"duration", time.Since(start),
+			"remote_addr", r.RemoteAddr,
+		)
+	})
+}
+
+// recoverMiddleware turns a panicking handler into a 500 response so one bad
+// request cannot take the server down. The panic value and stack trace are
+// logged for debugging.
+func recoverMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			rec := recover()
+			if rec == nil {
+				return
+			}
+			// http.ErrAbortHandler is the sanctioned way to abort a response;
+			// let net/http handle it quietly.
+			if err, ok := rec.(error); ok && errors.Is(err, http.ErrAbortHandler) {
+				panic(rec)
+			}
+
+			slog.ErrorContext(r.Context(), "Recovered from panic",
+				"panic", fmt.Sprint(rec),
+				"method", r.Method,
+				"path", r.URL.Path,
+				"stack", string(debug.Stack()),
+			)
+			writeErrorBody(w, errorBody{
+				Code:      http.StatusInternalServerError,
+				Message:   "internal server error",
+				RequestID: requestIDFromContext(r.Context()),
+			})
+		}()
+
+		next.ServeHTTP(w, r)
+	})
+}
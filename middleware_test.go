@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecoverMiddleware(t *testing.T) {
+	router := (&App{}).routes()
+	router.HandleFunc("/panic", func(w http.ResponseWriter, r *http.Request) {
+		var e *Expense
+		_ = e.Description // nil pointer dereference
+	})
+
+	// The panicking route returns a JSON 500 carrying the request ID
+	req, _ := http.NewRequest("GET", "/panic", nil)
+	req.Header.Set(requestIDHeader, "panic-123")
+	rr := httptest.NewRecorder()
+	assert.NotPanics(t, func() { requestIDMiddleware(router).ServeHTTP(rr, req) })
+	assert.Equal(t, http.StatusInternalServerError, rr.Code, "Should return 500")
+
+	var body errorResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &body), "Should decode error JSON")
+	assert.Equal(t, http.StatusInternalServerError, body.Error.Code)
+	assert.Equal(t, "panic-123", body.Error.RequestID)
+
+	// The router keeps serving afterwards
+	req, _ = http.NewRequest("GET", "/healthz", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should keep serving after a panic")
+}
+
+func TestStatusRecorderCapturesStatus(t *testing.T) {
+	rr := httptest.NewRecorder()
+	rec := &statusRecorder{ResponseWriter: rr}
+
+	writeJSONError(rec, http.StatusNotFound, "expense not found")
+
+	assert.Equal(t, http.StatusNotFound, rec.Status(), "Should capture the written status")
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Should pass the status through")
+
+	// Handlers that only write a body are reported as 200
+	rec = &statusRecorder{ResponseWriter: httptest.NewRecorder()}
+	rec.Write([]byte("ok"))
+	assert.Equal(t, http.StatusOK, rec.Status())
+}
+
+func TestLoggingMiddleware(t *testing.T) {
+	handler := loggingMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	req, _ := http.NewRequest("GET", "/brew", nil)
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusTeapot, rr.Code, "Should not alter the response")
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	"context"
+	"embed"
+	"errors"
+	"fmt"
+	"io/fs"
+	"log/slog"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the advisory lock key held while a migration runs so
+// that several instances starting together don't race each other.
+const migrationLockID = 7243817
+
+// migration is one schema change read from the migrations directory. Its
+// version is the file name without the .sql extension, e.g.
+// "0001_create_expenses".
+type migration struct {
+	Version string
+	SQL     string
+}
+
+// loadMigrations returns the embedded migrations sorted by file name.
+func loadMigrations() ([]migration, error) {
+	names, err := fs.Glob(migrationFiles, "migrations/*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("error listing migrations: %w", err)
+	}
+	sort.Strings(names)
+
+	migrations := make([]migration, 0, len(names))
+	for _, name := range names {
+		body, err := migrationFiles.ReadFile(name)
+		if err != nil {
+			return nil, fmt.Errorf("error reading migration %s: %w", name, err)
+		}
+		migrations = append(migrations, migration{
+			Version: strings.TrimSuffix(path.Base(name), ".sql"),
+			SQL:     string(body),
+		})
+	}
+	return migrations, nil
+}
+
+// migrate applies every pending migration in order, each inside its own
+// transaction, recording applied versions in schema_migrations. Running it
+// again once everything is applied is a no-op.
+func (app *App) migrate(ctx context.Context) error {
+	_, err := app.DBClient.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version TEXT PRIMARY KEY,
+			applied_at TIMESTAMP NOT NULL DEFAULT NOW()
+		)
+	`)
+	if err != nil {
+		return fmt.Errorf("error creating schema_migrations: %w", err)
+	}
+
+	migrations, err := loadMigrations()
+	if err != nil {
+		return err
+	}
+
+	for _, m := range migrations {
+		applied, err := app.applyMigration(ctx, m)
+		if err != nil {
+			return fmt.Errorf("error applying migration %s: %w", m.Version, err)
+		}
+		if applied {
+			slog.Info("Applied migration", "version", m.Version)
+		}
+	}
+	return nil
+}
+
+// applyMigration runs m unless it has already been recorded, reporting
+// whether it did anything.
+func (app *App) applyMigration(ctx context.Context, m migration) (bool, error) {
+	tx, err := app.DBClient.Begin(ctx)
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback(ctx)
+
+	if _, err := tx.Exec(ctx, "SELECT pg_advisory_xact_lock($1)", migrationLockID); err != nil {
+		return false, err
+	}
+
+	var version string
+	err = tx.QueryRow(ctx, "SELECT version FROM schema_migrations WHERE version = $1", m.Version).Scan(&version)
+	if err == nil {
+		return false, nil
+	}
+	if !errors.Is(err, pgx.ErrNoRows) {
+		return false, err
+	}
+
+	if _, err := tx.Exec(ctx, m.SQL); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec(ctx, "INSERT INTO schema_migrations (version) VALUES ($1)", m.Version); err != nil {
+		return false, err
+	}
+
+	return true, tx.Commit(ctx)
+}
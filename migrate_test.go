@@ -0,0 +1,38 @@
+package main
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadMigrationsOrdered(t *testing.T) {
+	migrations, err := loadMigrations()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	assert.Equal(t, "0001_create_expenses", migrations[0].Version)
+
+	for i := 1; i < len(migrations); i++ {
+		assert.Less(t, migrations[i-1].Version, migrations[i].Version, "Migrations should be sorted")
+	}
+}
+
+func TestMigrateIdempotent(t *testing.T) {
+	app, _ := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+
+	// Running twice in a row must not fail or re-apply anything
+	assert.NoError(t, app.migrate(ctx), "First run should succeed")
+	assert.NoError(t, app.migrate(ctx), "Second run should succeed")
+
+	migrations, err := loadMigrations()
+	assert.NoError(t, err)
+
+	var applied int
+	err = app.DBClient.QueryRow(ctx, "SELECT COUNT(*) FROM schema_migrations").Scan(&applied)
+	assert.NoError(t, err, "Should count applied migrations")
+	assert.Equal(t, len(migrations), applied, "Each migration should be recorded exactly once")
+}
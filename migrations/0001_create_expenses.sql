@@ -0,0 +1,9 @@
+-- IF NOT EXISTS so databases created before migrations were introduced
+-- pick up the runner without error.
+CREATE TABLE IF NOT EXISTS expenses (
+    id SERIAL PRIMARY KEY,
+    description TEXT NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    category TEXT NOT NULL,
+    date TIMESTAMP NOT NULL
+);
@@ -0,0 +1,22 @@
+-- Accounts (wallets) let spending be split between e.g. personal and
+-- business. Every expense belongs to one; a single default account keeps
+-- clients that never send account_id working.
+CREATE TABLE accounts (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL UNIQUE,
+    is_default BOOLEAN NOT NULL DEFAULT FALSE,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX accounts_single_default ON accounts (is_default) WHERE is_default;
+
+INSERT INTO accounts (name, is_default) VALUES ('Default', TRUE);
+
+CREATE FUNCTION default_account_id() RETURNS INTEGER AS $$
+    SELECT id FROM accounts WHERE is_default
+$$ LANGUAGE SQL STABLE;
+
+ALTER TABLE expenses
+    ADD COLUMN account_id INTEGER NOT NULL DEFAULT default_account_id() REFERENCES accounts (id);
+
+CREATE INDEX expenses_account_id_idx ON expenses (account_id);
@@ -0,0 +1,24 @@
+-- Categories become a managed list so "Food" and "food" can't drift apart.
+-- Names are unique case-insensitively; expenses keep storing the name.
+CREATE TABLE categories (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE UNIQUE INDEX categories_name_lower_idx ON categories (lower(name));
+
+INSERT INTO categories (name) VALUES
+    ('Food'),
+    ('Transport'),
+    ('Housing'),
+    ('Utilities'),
+    ('Entertainment'),
+    ('Health'),
+    ('Shopping'),
+    ('Other');
+
+-- Keep categories already in use valid.
+INSERT INTO categories (name)
+SELECT DISTINCT category FROM expenses
+ON CONFLICT (lower(name)) DO NOTHING;
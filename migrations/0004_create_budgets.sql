@@ -0,0 +1,12 @@
+-- A spending limit for one category in one calendar month. month is always
+-- the first day of that month.
+CREATE TABLE budgets (
+    id SERIAL PRIMARY KEY,
+    category TEXT NOT NULL,
+    month DATE NOT NULL,
+    amount DECIMAL(10,2) NOT NULL CHECK (amount > 0),
+    created_at TIMESTAMP NOT NULL DEFAULT NOW(),
+    CHECK (EXTRACT(DAY FROM month) = 1)
+);
+
+CREATE UNIQUE INDEX budgets_category_month_idx ON budgets (lower(category), month);
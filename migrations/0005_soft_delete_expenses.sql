@@ -0,0 +1,4 @@
+-- Deleting an expense now only stamps deleted_at so it can be restored.
+ALTER TABLE expenses ADD COLUMN deleted_at TIMESTAMP;
+
+CREATE INDEX expenses_live_date_idx ON expenses (date) WHERE deleted_at IS NULL;
@@ -0,0 +1,10 @@
+-- Budgets can cover a whole year instead of a month. Annual budgets store
+-- January 1st of their year in month.
+ALTER TABLE budgets
+    ADD COLUMN period TEXT NOT NULL DEFAULT 'monthly' CHECK (period IN ('monthly', 'annual'));
+
+ALTER TABLE budgets
+    ADD CHECK (period = 'monthly' OR EXTRACT(MONTH FROM month) = 1);
+
+DROP INDEX budgets_category_month_idx;
+CREATE UNIQUE INDEX budgets_category_period_month_idx ON budgets (lower(category), period, month);
@@ -0,0 +1,15 @@
+-- Templates for expenses that repeat (rent, subscriptions). A background
+-- worker inserts a concrete expense whenever next_run comes due and then
+-- advances next_run by the interval.
+CREATE TABLE recurring_expenses (
+    id SERIAL PRIMARY KEY,
+    description TEXT NOT NULL,
+    amount DECIMAL(10,2) NOT NULL,
+    category TEXT NOT NULL,
+    account_id INTEGER NOT NULL DEFAULT default_account_id() REFERENCES accounts (id),
+    interval TEXT NOT NULL CHECK (interval IN ('daily', 'weekly', 'monthly')),
+    next_run TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX recurring_expenses_next_run_idx ON recurring_expenses (next_run);
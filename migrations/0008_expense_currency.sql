@@ -0,0 +1,3 @@
+-- Expenses carry the ISO 4217 code of the currency they were paid in.
+-- Everything recorded before this was in US dollars.
+ALTER TABLE expenses ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
@@ -0,0 +1,5 @@
+-- A refund is an expense row pointing back at the expense it returns money
+-- on. Summaries subtract refunds rather than adding them.
+ALTER TABLE expenses ADD COLUMN refund_of INTEGER REFERENCES expenses (id);
+
+CREATE INDEX expenses_refund_of_idx ON expenses (refund_of) WHERE refund_of IS NOT NULL;
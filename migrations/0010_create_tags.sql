@@ -0,0 +1,17 @@
+-- Free-form labels that cut across categories ("reimbursable",
+-- "vacation-2024"). Names are unique ignoring case; an expense can carry
+-- any number of them.
+CREATE TABLE tags (
+    id SERIAL PRIMARY KEY,
+    name TEXT NOT NULL
+);
+
+CREATE UNIQUE INDEX tags_name_lower_idx ON tags (lower(name));
+
+CREATE TABLE expense_tags (
+    expense_id INTEGER NOT NULL REFERENCES expenses (id) ON DELETE CASCADE,
+    tag_id INTEGER NOT NULL REFERENCES tags (id) ON DELETE CASCADE,
+    PRIMARY KEY (expense_id, tag_id)
+);
+
+CREATE INDEX expense_tags_tag_id_idx ON expense_tags (tag_id);
@@ -0,0 +1,5 @@
+-- An optional receipt (image or PDF) per expense. The file itself lives in
+-- the blob store under receipt_key.
+ALTER TABLE expenses
+    ADD COLUMN receipt_key TEXT,
+    ADD COLUMN receipt_content_type TEXT;
@@ -0,0 +1,13 @@
+-- Idempotency-Key values seen on POST /api/expenses, with the response that
+-- was sent so a retry can be answered without inserting again. Rows older
+-- than a day are treated as expired and overwritten on reuse.
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+    key TEXT PRIMARY KEY,
+    request_hash TEXT NOT NULL,
+    expense_id INTEGER NOT NULL REFERENCES expenses(id) ON DELETE CASCADE,
+    status_code INTEGER NOT NULL,
+    response BYTEA NOT NULL,
+    created_at TIMESTAMPTZ NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX IF NOT EXISTS idempotency_keys_created_at_idx ON idempotency_keys (created_at);
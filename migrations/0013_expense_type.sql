@@ -0,0 +1,5 @@
+-- Rows can record money coming in as well as going out. Everything
+-- recorded before this was spending.
+ALTER TABLE expenses
+    ADD COLUMN type TEXT NOT NULL DEFAULT 'expense'
+    CHECK (type IN ('expense', 'income'));
@@ -0,0 +1,21 @@
+-- A transfer moves money between two accounts. It is recorded as two legs
+-- that always sum to zero: a debit (negative) on the source account and a
+-- credit (positive) on the destination. Transfers are not spending or
+-- income, so they live apart from expenses.
+CREATE TABLE transfers (
+    id SERIAL PRIMARY KEY,
+    description TEXT NOT NULL,
+    currency CHAR(3) NOT NULL,
+    date TIMESTAMP NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE TABLE transfer_legs (
+    id SERIAL PRIMARY KEY,
+    transfer_id INTEGER NOT NULL REFERENCES transfers (id) ON DELETE CASCADE,
+    account_id INTEGER NOT NULL REFERENCES accounts (id),
+    amount DECIMAL(10,2) NOT NULL
+);
+
+CREATE INDEX transfer_legs_transfer_id_idx ON transfer_legs (transfer_id);
+CREATE INDEX transfer_legs_account_id_idx ON transfer_legs (account_id);
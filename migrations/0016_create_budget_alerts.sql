@@ -0,0 +1,7 @@
+-- Records which monthly budgets have already triggered an overspend email,
+-- so each budget alerts at most once. Monthly budgets cover a single month,
+-- so one row per budget is once per month.
+CREATE TABLE budget_alerts (
+    budget_id INTEGER PRIMARY KEY REFERENCES budgets (id) ON DELETE CASCADE,
+    sent_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
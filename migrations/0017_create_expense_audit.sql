@@ -0,0 +1,53 @@
+-- Every change to an expense row, with the row before and after. A trigger
+-- writes it, so the entry commits or rolls back with the change itself and
+-- no code path can skip it. Soft deletes and restores are recorded as such
+-- rather than as updates of deleted_at. There is no foreign key to
+-- expenses: history outlives even a hard delete.
+CREATE TABLE expense_audit (
+    id SERIAL PRIMARY KEY,
+    expense_id INTEGER NOT NULL,
+    action TEXT NOT NULL CHECK (action IN ('create', 'update', 'delete', 'restore')),
+    old_values JSONB,
+    new_values JSONB,
+    changed_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
+
+CREATE INDEX expense_audit_expense_id_idx ON expense_audit (expense_id, id);
+
+-- deleted_at is implied by the action and receipt_key is a storage detail,
+-- so neither is kept; an update touching only those is not logged.
+CREATE FUNCTION audit_expense_change() RETURNS TRIGGER AS $$
+DECLARE
+    old_row JSONB;
+    new_row JSONB;
+    change TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        new_row := to_jsonb(NEW) - 'deleted_at' - 'receipt_key';
+        change := 'create';
+    ELSIF TG_OP = 'DELETE' THEN
+        old_row := to_jsonb(OLD) - 'deleted_at' - 'receipt_key';
+        change := 'delete';
+    ELSE
+        old_row := to_jsonb(OLD) - 'deleted_at' - 'receipt_key';
+        new_row := to_jsonb(NEW) - 'deleted_at' - 'receipt_key';
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            change := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            change := 'restore';
+        ELSIF old_row = new_row THEN
+            RETURN NULL;
+        ELSE
+            change := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO expense_audit (expense_id, action, old_values, new_values)
+    VALUES (CASE WHEN TG_OP = 'DELETE' THEN OLD.id ELSE NEW.id END, change, old_row, new_row);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER expenses_audit
+    AFTER INSERT OR UPDATE OR DELETE ON expenses
+    FOR EACH ROW EXECUTE FUNCTION audit_expense_change();
@@ -0,0 +1,13 @@
+-- Expense and recurring expense amounts are stored as whole cents, so sums
+-- and comparisons are exact integer arithmetic.
+ALTER TABLE expenses ALTER COLUMN amount TYPE BIGINT USING round(amount * 100)::BIGINT;
+ALTER TABLE recurring_expenses ALTER COLUMN amount TYPE BIGINT USING round(amount * 100)::BIGINT;
+
+-- Keep the history comparable with what is written from now on.
+UPDATE expense_audit
+SET old_values = jsonb_set(old_values, '{amount}', to_jsonb(round((old_values->>'amount')::NUMERIC * 100)::BIGINT))
+WHERE old_values ? 'amount';
+
+UPDATE expense_audit
+SET new_values = jsonb_set(new_values, '{amount}', to_jsonb(round((new_values->>'amount')::NUMERIC * 100)::BIGINT))
+WHERE new_values ? 'amount';
@@ -0,0 +1,54 @@
+-- When each expense was created and last changed. Rows from before this
+-- migration get the time it ran for both.
+ALTER TABLE expenses
+    ADD COLUMN created_at TIMESTAMPTZ NOT NULL DEFAULT NOW(),
+    ADD COLUMN updated_at TIMESTAMPTZ NOT NULL DEFAULT NOW();
+
+CREATE INDEX expenses_updated_at_idx ON expenses (updated_at);
+
+-- Stamped by a trigger so every write path, including soft deletes and
+-- restores, moves it forward.
+CREATE FUNCTION touch_expense() RETURNS TRIGGER AS $$
+BEGIN
+    NEW.updated_at := NOW();
+    RETURN NEW;
+END
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER expenses_touch
+    BEFORE UPDATE ON expenses
+    FOR EACH ROW EXECUTE FUNCTION touch_expense();
+
+-- updated_at changes on every update, so the audit log leaves it out like
+-- deleted_at; otherwise no update would ever look like a no-op.
+CREATE OR REPLACE FUNCTION audit_expense_change() RETURNS TRIGGER AS $$
+DECLARE
+    old_row JSONB;
+    new_row JSONB;
+    change TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        new_row := to_jsonb(NEW) - 'deleted_at' - 'receipt_key' - 'updated_at';
+        change := 'create';
+    ELSIF TG_OP = 'DELETE' THEN
+        old_row := to_jsonb(OLD) - 'deleted_at' - 'receipt_key' - 'updated_at';
+        change := 'delete';
+    ELSE
+        old_row := to_jsonb(OLD) - 'deleted_at' - 'receipt_key' - 'updated_at';
+        new_row := to_jsonb(NEW) - 'deleted_at' - 'receipt_key' - 'updated_at';
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            change := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            change := 'restore';
+        ELSIF old_row = new_row THEN
+            RETURN NULL;
+        ELSE
+            change := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO expense_audit (expense_id, action, old_values, new_values)
+    VALUES (CASE WHEN TG_OP = 'DELETE' THEN OLD.id ELSE NEW.id END, change, old_row, new_row);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
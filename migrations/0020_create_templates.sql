@@ -0,0 +1,9 @@
+-- Reusable partial expenses for things bought often. An expense made from
+-- one copies these fields and gets its date when it is created.
+CREATE TABLE templates (
+    id SERIAL PRIMARY KEY,
+    description TEXT NOT NULL,
+    amount BIGINT NOT NULL,
+    category TEXT NOT NULL,
+    created_at TIMESTAMP NOT NULL DEFAULT NOW()
+);
@@ -0,0 +1,3 @@
+-- Free-form annotations kept apart from the short description. NULL means
+-- the expense has none.
+ALTER TABLE expenses ADD COLUMN notes TEXT;
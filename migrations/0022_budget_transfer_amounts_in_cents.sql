@@ -0,0 +1,4 @@
+-- Budget limits and transfer legs are stored as whole cents too, like
+-- expenses since 0018.
+ALTER TABLE budgets ALTER COLUMN amount TYPE BIGINT USING round(amount * 100)::BIGINT;
+ALTER TABLE transfer_legs ALTER COLUMN amount TYPE BIGINT USING round(amount * 100)::BIGINT;
@@ -0,0 +1,6 @@
+-- The day of the month monthly entries fall on. next_run alone can't carry
+-- it: after a run clamped to a short month's last day, the original day is
+-- lost. Existing entries take next_run's day, the best guess left.
+ALTER TABLE recurring_expenses ADD COLUMN day_of_month SMALLINT CHECK (day_of_month BETWEEN 1 AND 31);
+
+UPDATE recurring_expenses SET day_of_month = EXTRACT(DAY FROM next_run);
@@ -0,0 +1,4 @@
+-- Recurring expenses and templates name the currency of the expenses they
+-- make, like expenses themselves since 0008.
+ALTER TABLE recurring_expenses ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+ALTER TABLE templates ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
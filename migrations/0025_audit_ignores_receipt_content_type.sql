@@ -0,0 +1,40 @@
+-- receipt_content_type is a storage detail like receipt_key, so the audit
+-- log leaves it out too; a receipt upload is not a change to the expense.
+CREATE OR REPLACE FUNCTION audit_expense_change() RETURNS TRIGGER AS $$
+DECLARE
+    old_row JSONB;
+    new_row JSONB;
+    change TEXT;
+BEGIN
+    IF TG_OP = 'INSERT' THEN
+        new_row := to_jsonb(NEW) - 'deleted_at' - 'receipt_key' - 'receipt_content_type' - 'updated_at';
+        change := 'create';
+    ELSIF TG_OP = 'DELETE' THEN
+        old_row := to_jsonb(OLD) - 'deleted_at' - 'receipt_key' - 'receipt_content_type' - 'updated_at';
+        change := 'delete';
+    ELSE
+        old_row := to_jsonb(OLD) - 'deleted_at' - 'receipt_key' - 'receipt_content_type' - 'updated_at';
+        new_row := to_jsonb(NEW) - 'deleted_at' - 'receipt_key' - 'receipt_content_type' - 'updated_at';
+        IF OLD.deleted_at IS NULL AND NEW.deleted_at IS NOT NULL THEN
+            change := 'delete';
+        ELSIF OLD.deleted_at IS NOT NULL AND NEW.deleted_at IS NULL THEN
+            change := 'restore';
+        ELSIF old_row = new_row THEN
+            RETURN NULL;
+        ELSE
+            change := 'update';
+        END IF;
+    END IF;
+
+    INSERT INTO expense_audit (expense_id, action, old_values, new_values)
+    VALUES (CASE WHEN TG_OP = 'DELETE' THEN OLD.id ELSE NEW.id END, change, old_row, new_row);
+    RETURN NULL;
+END
+$$ LANGUAGE plpgsql;
+
+-- Drop it from the history already recorded, and with it the updates that
+-- were only receipt uploads.
+UPDATE expense_audit
+SET old_values = old_values - 'receipt_content_type', new_values = new_values - 'receipt_content_type';
+
+DELETE FROM expense_audit WHERE action = 'update' AND old_values = new_values;
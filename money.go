@@ -0,0 +1,103 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// Cents is an amount of money in hundredths of its currency unit. Amounts
+// are added and compared as integers so they never drift the way float64
+// sums do. Clients see them as decimal strings such as "12.50"; on the way
+// in either a string or a JSON number is accepted, with at most two
+// decimal places.
+type Cents int64
+
+// maxCentsDigits bounds the whole-unit digits parseCents accepts, well
+// inside int64.
+const maxCentsDigits = 15
+
+// String formats c as a decimal with two places, e.g. "-3.05".
+func (c Cents) String() string {
+	sign := ""
+	if c < 0 {
+		sign, c = "-", -c
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, c/100, c%100)
+}
+
+// Int64Value and ScanInt64 map Cents to BIGINT columns. Without them pgx
+// would send String() for text-format parameters.
+func (c Cents) Int64Value() (pgtype.Int8, error) {
+	return pgtype.Int8{Int64: int64(c), Valid: true}, nil
+}
+
+func (c *Cents) ScanInt64(v pgtype.Int8) error {
+	if !v.Valid {
+		return errors.New("cannot scan NULL into Cents")
+	}
+	*c = Cents(v.Int64)
+	return nil
+}
+
+func (c Cents) MarshalJSON() ([]byte, error) {
+	return []byte(`"` + c.String() + `"`), nil
+}
+
+func (c *Cents) UnmarshalJSON(b []byte) error {
+	s := string(b)
+	if s == "null" {
+		return nil
+	}
+	if strings.HasPrefix(s, `"`) {
+		unquoted, err := strconv.Unquote(s)
+		if err != nil {
+			return fmt.Errorf("invalid amount %s", s)
+		}
+		s = unquoted
+	}
+	v, err := parseCents(s)
+	if err != nil {
+		return err
+	}
+	*c = v
+	return nil
+}
+
+// parseCents parses a decimal such as "12", "12.5" or "-0.05" exactly,
+// without going through float64.
+func parseCents(s string) (Cents, error) {
+	digits := strings.TrimPrefix(s, "-")
+	whole, frac, hasPoint := strings.Cut(digits, ".")
+	if whole == "" || !isDigits(whole) || (hasPoint && (frac == "" || !isDigits(frac))) {
+		return 0, fmt.Errorf("invalid amount %q: must be a decimal number", s)
+	}
+	if len(frac) > 2 {
+		return 0, fmt.Errorf("invalid amount %q: must have at most two decimal places", s)
+	}
+	if len(strings.TrimLeft(whole, "0")) > maxCentsDigits {
+		return 0, fmt.Errorf("invalid amount %q: too large", s)
+	}
+
+	units, _ := strconv.ParseInt(whole, 10, 64)
+	frac += strings.Repeat("0", 2-len(frac))
+	hundredths, _ := strconv.ParseInt(frac, 10, 64)
+
+	c := Cents(units*100 + hundredths)
+	if len(digits) < len(s) {
+		c = -c
+	}
+	return c, nil
+}
+
+func isDigits(s string) bool {
+	for _, r := range s {
+		if r < '0' || r > '9' {
+			return false
+		}
+	}
+	return true
+}
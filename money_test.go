@@ -0,0 +1,70 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCents(t *testing.T) {
+	for input, want := range map[string]Cents{
+		"12":          1200,
+		"12.5":        1250,
+		"12.50":       1250,
+		"0.05":        5,
+		"-3.05":       -305,
+		"007.10":      710,
+		"99999999.99": 9999999999,
+	} {
+		got, err := parseCents(input)
+		assert.NoError(t, err, input)
+		assert.Equal(t, want, got, input)
+	}
+
+	for _, input := range []string{"", "-", ".5", "12.", "1.234", "1e3", "12,50", "abc", " 1", "1234567890123456"} {
+		_, err := parseCents(input)
+		assert.Error(t, err, input)
+	}
+}
+
+func TestCentsString(t *testing.T) {
+	assert.Equal(t, "12.50", Cents(1250).String())
+	assert.Equal(t, "0.05", Cents(5).String())
+	assert.Equal(t, "0.00", Cents(0).String())
+	assert.Equal(t, "-3.05", Cents(-305).String())
+}
+
+func TestCentsJSON(t *testing.T) {
+	out, err := json.Marshal(Expense{Amount: 1250})
+	assert.NoError(t, err)
+	assert.Contains(t, string(out), `"amount":"12.50"`, "Should present amounts as decimal strings")
+
+	// Both strings and numbers are accepted on the way in
+	for _, body := range []string{`{"amount": "12.50"}`, `{"amount": 12.5}`, `{"amount": 12.50}`} {
+		var e Expense
+		assert.NoError(t, json.Unmarshal([]byte(body), &e), body)
+		assert.Equal(t, Cents(1250), e.Amount, body)
+	}
+
+	for _, body := range []string{`{"amount": 1.234}`, `{"amount": "not-a-number"}`, `{"amount": true}`, `{"amount": 1e2}`} {
+		var e Expense
+		assert.Error(t, json.Unmarshal([]byte(body), &e), body)
+	}
+}
+
+func TestCentsSumsAreExact(t *testing.T) {
+	// 0.1 + 0.2 is 0.30000000000000004 in float64
+	var a, b Cents
+	assert.NoError(t, json.Unmarshal([]byte(`0.1`), &a))
+	assert.NoError(t, json.Unmarshal([]byte(`0.2`), &b))
+	assert.Equal(t, Cents(30), a+b)
+	assert.Equal(t, "0.30", (a + b).String())
+
+	// Ten thousand dimes make exactly a thousand
+	var total Cents
+	for range 10000 {
+		total += 10
+	}
+	assert.Equal(t, "1000.00", total.String())
+}
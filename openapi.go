@@ -0,0 +1,557 @@
+package main
+
+import (
+	"net/http"
+	"reflect"
+	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// The subset of OpenAPI 3.0 the spec below uses.
+type openAPIDocument struct {
+	OpenAPI    string                                  `json:"openapi"`
+	Info       openAPIInfo                             `json:"info"`
+	Paths      map[string]map[string]*openAPIOperation `json:"paths"`
+	Components openAPIComponents                       `json:"components"`
+}
+
+type openAPIInfo struct {
+	Title       string `json:"title"`
+	Version     string `json:"version"`
+	Description string `json:"description,omitempty"`
+}
+
+type openAPIComponents struct {
+	Schemas map[string]schema `json:"schemas"`
+}
+
+// schema is a JSON Schema object, kept loose since only a few keywords are
+// ever set.
+type schema map[string]any
+
+type openAPIOperation struct {
+	Summary     string                     `json:"summary"`
+	Description string                     `json:"description,omitempty"`
+	Tags        []string                   `json:"tags,omitempty"`
+	Parameters  []openAPIParameter         `json:"parameters,omitempty"`
+	RequestBody *openAPIRequestBody        `json:"requestBody,omitempty"`
+	Responses   map[string]openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Name        string `json:"name"`
+	In          string `json:"in"`
+	Description string `json:"description,omitempty"`
+	Required    bool   `json:"required,omitempty"`
+	Schema      schema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Required bool                    `json:"required"`
+	Content  map[string]openAPIMedia `json:"content"`
+}
+
+type openAPIMedia struct {
+	Schema schema `json:"schema"`
+}
+
+type openAPIResponse struct {
+	Description string                  `json:"description"`
+	Content     map[string]openAPIMedia `json:"content,omitempty"`
+}
+
+// specBuilder assembles the document. Schemas for Go types are derived
+// from their JSON tags, so they can't drift from what the handlers encode.
+type specBuilder struct {
+	doc openAPIDocument
+}
+
+// schemaOf returns the schema for the type of v. Structs are added to the
+// components and referenced by name.
+func (b *specBuilder) schemaOf(v any) schema {
+	return b.schemaFor(reflect.TypeOf(v))
+}
+
+func (b *specBuilder) schemaFor(t reflect.Type) schema {
+	if t == reflect.TypeOf(time.Time{}) {
+		return schema{"type": "string", "format": "date-time"}
+	}
+	if t == reflect.TypeOf(Cents(0)) {
+		return schema{"type": "string", "pattern": `^-?\d+(\.\d{1,2})?$`, "example": "12.50"}
+	}
+
+	switch t.Kind() {
+	case reflect.Pointer:
+		return b.schemaFor(t.Elem())
+	case reflect.String:
+		return schema{"type": "string"}
+	case reflect.Bool:
+		return schema{"type": "boolean"}
+	case reflect.Int, reflect.Int32, reflect.Int64:
+		return schema{"type": "integer"}
+	case reflect.Float64:
+		return schema{"type": "number"}
+	case reflect.Slice:
+		return schema{"type": "array", "items": b.schemaFor(t.Elem())}
+	case reflect.Struct:
+		name := componentName(t)
+		if _, ok := b.doc.Components.Schemas[name]; !ok {
+			// Register before filling in so recursive types terminate.
+			b.doc.Components.Schemas[name] = schema{}
+			b.doc.Components.Schemas[name] = schema{"type": "object", "properties": b.properties(t)}
+		}
+		return schema{"$ref": "#/components/schemas/" + name}
+	default:
+		return schema{}
+	}
+}
+
+// properties lists the JSON fields of struct type t, flattening embedded
+// structs the way encoding/json does.
+func (b *specBuilder) properties(t reflect.Type) map[string]schema {
+	props := map[string]schema{}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, _, _ := strings.Cut(f.Tag.Get("json"), ",")
+		if name == "-" {
+			continue
+		}
+		if f.Anonymous && name == "" && f.Type.Kind() == reflect.Struct {
+			for k, v := range b.properties(f.Type) {
+				props[k] = v
+			}
+			continue
+		}
+		if !f.IsExported() {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		props[name] = b.schemaFor(f.Type)
+	}
+	return props
+}
+
+// componentName is the schema name for a Go type, capitalised so
+// unexported request types read like the rest.
+func componentName(t reflect.Type) string {
+	r, n := utf8.DecodeRuneInString(t.Name())
+	return string(unicode.ToUpper(r)) + t.Name()[n:]
+}
+
+// add registers an operation. Every operation can fail with the standard
+// error envelope, so that is added as the default response.
+func (b *specBuilder) add(method, path string, op openAPIOperation) {
+	if b.doc.Paths[path] == nil {
+		b.doc.Paths[path] = map[string]*openAPIOperation{}
+	}
+	if op.Responses == nil {
+		op.Responses = map[string]openAPIResponse{}
+	}
+	op.Responses["default"] = b.jsonResponse("Error", errorResponse{})
+	b.doc.Paths[path][strings.ToLower(method)] = &op
+}
+
+func (b *specBuilder) jsonResponse(description string, v any) openAPIResponse {
+	return openAPIResponse{Description: description, Content: jsonContent(b.schemaOf(v))}
+}
+
+func (b *specBuilder) jsonBody(v any) *openAPIRequestBody {
+	return &openAPIRequestBody{Required: true, Content: jsonContent(b.schemaOf(v))}
+}
+
+func jsonContent(s schema) map[string]openAPIMedia {
+	return map[string]openAPIMedia{"application/json": {Schema: s}}
+}
+
+func textResponse(description, contentType string) openAPIResponse {
+	return openAPIResponse{
+		Description: description,
+		Content:     map[string]openAPIMedia{contentType: {Schema: schema{"type": "string"}}},
+	}
+}
+
+func noContent(description string) openAPIResponse {
+	return openAPIResponse{Description: description}
+}
+
+func queryParam(name, typ, description string) openAPIParameter {
+	return openAPIParameter{Name: name, In: "query", Description: description, Schema: schema{"type": typ}}
+}
+
+var idParam = openAPIParameter{Name: "id", In: "path", Required: true, Schema: schema{"type": "integer"}}
+
+// filterParams are the query parameters read by parseExpenseFilter.
+var filterParams = []openAPIParameter{
+	queryParam("include_future", "boolean", "Include expenses dated after now."),
+	queryParam("account_id", "integer", "Only this account."),
+	{Name: "from", In: "query", Description: "First day, inclusive.", Schema: schema{"type": "string", "format": "date"}},
+	{Name: "to", In: "query", Description: "Last day, inclusive.", Schema: schema{"type": "string", "format": "date"}},
+	{Name: "period", In: "query", Description: "Relative date range; not combined with from or to.", Schema: schema{
+		"type": "string", "enum": []string{"this_month", "last_month", "this_year", "last_year", "last_7_days", "last_30_days"},
+	}},
+	queryParam("category", "string", "Only this category."),
+	queryParam("currency", "string", "Only this ISO 4217 currency."),
+	queryParam("tag", "string", "Only expenses with this tag, ignoring case."),
+	{Name: "min_amount", In: "query", Description: "Smallest amount, inclusive.", Schema: schema{"type": "string", "pattern": `^\d+(\.\d{1,2})?$`}},
+	{Name: "max_amount", In: "query", Description: "Largest amount, inclusive.", Schema: schema{"type": "string", "pattern": `^\d+(\.\d{1,2})?$`}},
+	{Name: "since", In: "query", Description: "Only expenses created or changed at or after this time.", Schema: schema{"type": "string", "format": "date-time"}},
+	{Name: "type", In: "query", Description: "Only expenses or only income.", Schema: schema{
+		"type": "string", "enum": []string{expenseTypeExpense, expenseTypeIncome},
+	}},
+}
+
+func withFilter(params ...openAPIParameter) []openAPIParameter {
+	return append(append([]openAPIParameter{}, filterParams...), params...)
+}
+
+// buildAPISpec describes every route registered in routes. TestOpenAPICoversRoutes
+// fails if one is missing.
+func buildAPISpec() openAPIDocument {
+	b := &specBuilder{doc: openAPIDocument{
+		OpenAPI: "3.0.3",
+		Info: openAPIInfo{
+			Title:       "Expense Tracker API",
+			Version:     "1.0.0",
+			Description: "Track expenses, income, budgets and transfers between accounts. The API does not require authentication.",
+		},
+		Paths:      map[string]map[string]*openAPIOperation{},
+		Components: openAPIComponents{Schemas: map[string]schema{}},
+	}}
+
+	// Operations
+	b.add("GET", "/version", openAPIOperation{
+		Summary: "Build information", Tags: []string{"operations"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The running build", BuildInfo{})},
+	})
+	b.add("GET", "/healthz", openAPIOperation{
+		Summary: "Liveness probe", Tags: []string{"operations"},
+		Responses: map[string]openAPIResponse{"200": textResponse("The process is up", "text/plain")},
+	})
+	b.add("GET", "/readyz", openAPIOperation{
+		Summary: "Readiness probe", Tags: []string{"operations"},
+		Responses: map[string]openAPIResponse{
+			"200": b.jsonResponse("The database is reachable; status is degraded when the pool is nearly exhausted", Readiness{}),
+			"503": b.jsonResponse("The database is unreachable", Readiness{}),
+		},
+	})
+	b.add("GET", "/metrics", openAPIOperation{
+		Summary: "Prometheus metrics", Tags: []string{"operations"},
+		Responses: map[string]openAPIResponse{"200": textResponse("Metrics in the Prometheus text format", "text/plain")},
+	})
+	b.add("GET", "/openapi.json", openAPIOperation{
+		Summary: "This document", Tags: []string{"operations"},
+		Responses: map[string]openAPIResponse{"200": {Description: "The OpenAPI document", Content: jsonContent(schema{"type": "object"})}},
+	})
+
+	// Expenses
+	b.add("GET", "/api/expenses", openAPIOperation{
+		Summary: "List expenses", Tags: []string{"expenses"},
+		Parameters: withFilter(
+			queryParam("sort", "string", "Comma-separated keys, date or amount, each with a leading - for descending, e.g. -date,amount. Defaults to -date."),
+			queryParam("paginated", "boolean", "Return one page in a {data, pagination} envelope instead of a bare array."),
+			queryParam("limit", "integer", "Page size, 1 to 500. Defaults to 50. Needs paginated=true."),
+			queryParam("cursor", "string", "next_cursor from the previous page. Needs paginated=true."),
+			openAPIParameter{Name: "If-None-Match", In: "header", Description: "ETag of a previous response; 304 if the result is unchanged.", Schema: schema{"type": "string"}},
+		),
+		Responses: map[string]openAPIResponse{
+			"200": {
+				Description: "The matching expenses, or one page of them",
+				Content:     jsonContent(schema{"oneOf": []schema{b.schemaOf([]Expense{}), b.schemaOf(expensePage{})}}),
+			},
+			"304": noContent("Unchanged since the ETag sent in If-None-Match"),
+		},
+	})
+	b.add("POST", "/api/expenses", openAPIOperation{
+		Summary: "Create an expense", Tags: []string{"expenses"},
+		Parameters: []openAPIParameter{
+			queryParam("force", "boolean", "Create it even if it looks like a duplicate."),
+			{Name: idempotencyKeyHeader, In: "header", Description: "Replays the original response if sent again within 24 hours.", Schema: schema{"type": "string"}},
+		},
+		RequestBody: b.jsonBody(Expense{}),
+		Responses: map[string]openAPIResponse{
+			"201": b.jsonResponse("The created expense", Expense{}),
+			"409": b.jsonResponse("A matching expense already exists", duplicateResponse{}),
+			"422": b.jsonResponse("Every invalid field", errorResponse{}),
+		},
+	})
+	b.add("POST", "/api/expenses/bulk", openAPIOperation{
+		Summary: "Import expenses", Tags: []string{"expenses"},
+		Parameters:  []openAPIParameter{queryParam("allow_duplicates", "boolean", "Insert entries matching a stored expense too.")},
+		RequestBody: b.jsonBody([]Expense{}),
+		Responses:   map[string]openAPIResponse{"201": b.jsonResponse("The created expenses", bulkResult{})},
+	})
+	b.add("POST", "/api/expenses/batch-delete", openAPIOperation{
+		Summary: "Delete several expenses", Tags: []string{"expenses"},
+		RequestBody: b.jsonBody(batchDeleteRequest{}),
+		Responses:   map[string]openAPIResponse{"200": b.jsonResponse("How many were deleted; unknown or already deleted ids aren't counted", batchDeleteResult{})},
+	})
+	b.add("GET", "/api/expenses/export.csv", openAPIOperation{
+		Summary: "Export expenses as CSV", Tags: []string{"expenses"},
+		Parameters: withFilter(
+			queryParam("summary", "boolean", "Append a total row."),
+			queryParam("subtotals", "boolean", "Append a subtotal row per category."),
+		),
+		Responses: map[string]openAPIResponse{"200": textResponse("The CSV file", "text/csv")},
+	})
+	b.add("GET", "/api/expenses/search", openAPIOperation{
+		Summary: "Search expenses", Tags: []string{"expenses"},
+		Parameters: withFilter(openAPIParameter{
+			Name: "q", In: "query", Required: true, Description: "Text to find in the description or category.", Schema: schema{"type": "string"},
+		}),
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The matching expenses", []Expense{})},
+	})
+	b.add("GET", "/api/expenses/summary", openAPIOperation{
+		Summary: "Totals per currency", Tags: []string{"reports"},
+		Parameters: withFilter(queryParam("convert_to", "string", "Also report the totals in this currency.")),
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("The totals", ExpenseSummary{})},
+	})
+	b.add("GET", "/api/expenses/sync", openAPIOperation{
+		Summary: "Changes since a cursor", Tags: []string{"expenses"},
+		Description: "Returns the expenses created or changed and the ids of those deleted since the cursor. " +
+			"Send the returned cursor as since next time; omit it on the first sync to get every expense.",
+		Parameters: []openAPIParameter{
+			{Name: "since", In: "query", Description: "The cursor from the previous sync.", Schema: schema{"type": "string", "format": "date-time"}},
+		},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The changes and the next cursor", syncResponse{})},
+	})
+	b.add("GET", "/api/expenses/top-categories", openAPIOperation{
+		Summary: "Highest-spending categories", Tags: []string{"reports"},
+		Parameters: withFilter(queryParam("limit", "integer", "How many categories, 1 to 50. Defaults to 5.")),
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("The categories, largest first", []CategoryTotal{})},
+	})
+	b.add("PUT", "/api/expenses/{id}", openAPIOperation{
+		Summary: "Replace an expense", Tags: []string{"expenses"},
+		Parameters:  []openAPIParameter{idParam},
+		RequestBody: b.jsonBody(Expense{}),
+		Responses: map[string]openAPIResponse{
+			"200": b.jsonResponse("The updated expense", Expense{}),
+			"422": b.jsonResponse("Every invalid field", errorResponse{}),
+		},
+	})
+	b.add("PATCH", "/api/expenses/{id}", openAPIOperation{
+		Summary: "Update some fields of an expense", Tags: []string{"expenses"},
+		Parameters:  []openAPIParameter{idParam},
+		RequestBody: b.jsonBody(expensePatch{}),
+		Responses:   map[string]openAPIResponse{"200": b.jsonResponse("The updated expense", Expense{})},
+	})
+	b.add("DELETE", "/api/expenses/{id}", openAPIOperation{
+		Summary: "Delete an expense", Tags: []string{"expenses"},
+		Parameters: []openAPIParameter{idParam},
+		Responses:  map[string]openAPIResponse{"204": noContent("Deleted along with its refunds; it can be restored")},
+	})
+	b.add("POST", "/api/expenses/{id}/restore", openAPIOperation{
+		Summary: "Restore a deleted expense", Tags: []string{"expenses"},
+		Parameters: []openAPIParameter{idParam},
+		Responses: map[string]openAPIResponse{
+			"200": b.jsonResponse("The restored expense, with the refunds deleted along with it", Expense{}),
+			"409": b.jsonResponse("A refund whose expense is deleted or already fully refunded", errorResponse{}),
+		},
+	})
+	b.add("GET", "/api/expenses/{id}/history", openAPIOperation{
+		Summary: "Change history of an expense", Tags: []string{"expenses"},
+		Parameters: []openAPIParameter{idParam},
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("Every recorded change, oldest first", []ExpenseChange{})},
+	})
+	b.add("POST", "/api/expenses/{id}/refunds", openAPIOperation{
+		Summary: "Refund an expense", Tags: []string{"expenses"},
+		Parameters:  []openAPIParameter{idParam},
+		RequestBody: b.jsonBody(refundRequest{}),
+		Responses:   map[string]openAPIResponse{"201": b.jsonResponse("The refund", Expense{})},
+	})
+	b.add("POST", "/api/expenses/from-template/{id}", openAPIOperation{
+		Summary:     "Create an expense from a template",
+		Description: "The expense copies the template and is dated now. Any expense fields in the optional body override the template's.",
+		Tags:        []string{"expenses"},
+		Parameters:  []openAPIParameter{idParam},
+		RequestBody: &openAPIRequestBody{Content: jsonContent(b.schemaOf(Expense{}))},
+		Responses: map[string]openAPIResponse{
+			"201": b.jsonResponse("The created expense", Expense{}),
+			"422": b.jsonResponse("Every invalid field", errorResponse{}),
+		},
+	})
+	b.add("POST", "/api/expenses/{id}/receipt", openAPIOperation{
+		Summary: "Upload a receipt", Tags: []string{"expenses"},
+		Parameters: []openAPIParameter{idParam},
+		RequestBody: &openAPIRequestBody{Required: true, Content: map[string]openAPIMedia{"multipart/form-data": {Schema: schema{
+			"type":       "object",
+			"properties": schema{"receipt": schema{"type": "string", "format": "binary"}},
+		}}}},
+		Responses: map[string]openAPIResponse{"201": b.jsonResponse("The expense", Expense{})},
+	})
+	b.add("GET", "/api/expenses/{id}/receipt", openAPIOperation{
+		Summary: "Download a receipt", Tags: []string{"expenses"},
+		Parameters: []openAPIParameter{idParam},
+		Responses:  map[string]openAPIResponse{"200": textResponse("The receipt file", "application/octet-stream")},
+	})
+
+	// Analytics
+	b.add("GET", "/api/analytics/by-category", openAPIOperation{
+		Summary: "Spending per category", Tags: []string{"reports"},
+		Parameters: filterParams,
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("The categories, largest first", []CategorySpend{})},
+	})
+	b.add("GET", "/api/analytics/trend", openAPIOperation{
+		Summary: "Spending over time", Tags: []string{"reports"},
+		Parameters: withFilter(openAPIParameter{Name: "granularity", In: "query", Schema: schema{
+			"type": "string", "enum": []string{"day", "week", "month"},
+		}}),
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("One point per bucket, oldest first", []TrendPoint{})},
+	})
+	b.add("GET", "/api/analytics/top", openAPIOperation{
+		Summary: "Largest expenses", Tags: []string{"reports"},
+		Parameters: withFilter(queryParam("limit", "integer", "How many, 1 to 100. Defaults to 5.")),
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("The largest expenses, biggest first", []Expense{})},
+	})
+	b.add("GET", "/api/analytics/averages", openAPIOperation{
+		Summary: "Average spend per day and week", Tags: []string{"reports"},
+		Parameters: withFilter(),
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("The averages over the window", SpendingAverages{})},
+	})
+
+	// Accounts
+	b.add("GET", "/api/accounts", openAPIOperation{
+		Summary: "List accounts", Tags: []string{"accounts"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The accounts", []Account{})},
+	})
+	b.add("POST", "/api/accounts", openAPIOperation{
+		Summary: "Create an account", Tags: []string{"accounts"},
+		RequestBody: b.jsonBody(Account{}),
+		Responses:   map[string]openAPIResponse{"201": b.jsonResponse("The created account", Account{})},
+	})
+	b.add("PUT", "/api/accounts/{id}", openAPIOperation{
+		Summary: "Rename an account", Tags: []string{"accounts"},
+		Parameters:  []openAPIParameter{idParam},
+		RequestBody: b.jsonBody(Account{}),
+		Responses:   map[string]openAPIResponse{"200": b.jsonResponse("The updated account", Account{})},
+	})
+	b.add("DELETE", "/api/accounts/{id}", openAPIOperation{
+		Summary: "Delete an unused account", Tags: []string{"accounts"},
+		Parameters: []openAPIParameter{idParam},
+		Responses:  map[string]openAPIResponse{"204": noContent("Deleted")},
+	})
+
+	// Transfers
+	b.add("POST", "/api/transfers", openAPIOperation{
+		Summary: "Move money between accounts", Tags: []string{"accounts"},
+		RequestBody: b.jsonBody(transferRequest{}),
+		Responses: map[string]openAPIResponse{
+			"201": b.jsonResponse("The transfer and both legs", Transfer{}),
+			"422": b.jsonResponse("Every invalid field", errorResponse{}),
+		},
+	})
+
+	// Categories
+	b.add("GET", "/api/categories", openAPIOperation{
+		Summary: "List categories", Tags: []string{"categories"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The categories", []Category{})},
+	})
+	b.add("POST", "/api/categories", openAPIOperation{
+		Summary: "Create a category", Tags: []string{"categories"},
+		RequestBody: b.jsonBody(Category{}),
+		Responses:   map[string]openAPIResponse{"201": b.jsonResponse("The created category", Category{})},
+	})
+	b.add("DELETE", "/api/categories/{id}", openAPIOperation{
+		Summary: "Delete an unused category", Tags: []string{"categories"},
+		Parameters: []openAPIParameter{idParam},
+		Responses: map[string]openAPIResponse{
+			"204": noContent("Deleted"),
+			"409": b.jsonResponse("Still used by expenses, recurring expenses, templates or budgets", errorResponse{}),
+		},
+	})
+
+	// Budgets
+	b.add("GET", "/api/budgets", openAPIOperation{
+		Summary: "Budgets and spending against them", Tags: []string{"budgets"},
+		Parameters: []openAPIParameter{queryParam("month", "string", "YYYY-MM. Defaults to the current month.")},
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("The budgets in force; only spending in USD counts against them", []BudgetStatus{})},
+	})
+	b.add("POST", "/api/budgets", openAPIOperation{
+		Summary: "Set a budget", Tags: []string{"budgets"},
+		RequestBody: b.jsonBody(Budget{}),
+		Responses:   map[string]openAPIResponse{"200": b.jsonResponse("The budget", Budget{})},
+	})
+
+	// Admin
+	b.add("GET", "/api/admin/db-stats", openAPIOperation{
+		Summary: "Database pool statistics", Tags: []string{"operations"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The pool statistics", DBStats{})},
+	})
+	b.add("GET", "/api/admin/maintenance", openAPIOperation{
+		Summary: "Whether maintenance mode is on", Tags: []string{"operations"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The current mode", maintenanceStatus{})},
+	})
+	b.add("PUT", "/api/admin/maintenance", openAPIOperation{
+		Summary:     "Turn maintenance mode on or off",
+		Description: "While it is on, every request other than GET, HEAD and OPTIONS is refused with 503 and a Retry-After header, except this one. Requires ADMIN_TOKEN as a bearer token; without it configured the mode can only be set at startup.",
+		Tags:        []string{"operations"},
+		RequestBody: b.jsonBody(maintenanceStatus{}),
+		Responses: map[string]openAPIResponse{
+			"200": b.jsonResponse("The new mode", maintenanceStatus{}),
+			"401": b.jsonResponse("The admin token is missing or wrong", errorResponse{}),
+		},
+	})
+
+	// Recurring expenses
+	b.add("GET", "/api/recurring-expenses", openAPIOperation{
+		Summary: "List recurring expenses", Tags: []string{"recurring"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The recurring expenses", []RecurringExpense{})},
+	})
+	b.add("POST", "/api/recurring-expenses", openAPIOperation{
+		Summary: "Create a recurring expense", Tags: []string{"recurring"},
+		RequestBody: b.jsonBody(RecurringExpense{}),
+		Responses:   map[string]openAPIResponse{"201": b.jsonResponse("The created recurring expense", RecurringExpense{})},
+	})
+
+	// Templates
+	b.add("GET", "/api/templates", openAPIOperation{
+		Summary: "List expense templates", Tags: []string{"templates"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The templates", []Template{})},
+	})
+	b.add("POST", "/api/templates", openAPIOperation{
+		Summary: "Create an expense template", Tags: []string{"templates"},
+		RequestBody: b.jsonBody(Template{}),
+		Responses:   map[string]openAPIResponse{"201": b.jsonResponse("The created template", Template{})},
+	})
+	b.add("DELETE", "/api/templates/{id}", openAPIOperation{
+		Summary: "Delete an expense template", Tags: []string{"templates"},
+		Parameters: []openAPIParameter{idParam},
+		Responses:  map[string]openAPIResponse{"204": noContent("Deleted")},
+	})
+
+	// Webhooks
+	b.add("GET", "/api/webhooks", openAPIOperation{
+		Summary: "List webhooks", Tags: []string{"webhooks"},
+		Responses: map[string]openAPIResponse{"200": b.jsonResponse("The webhooks, without their secrets", []Webhook{})},
+	})
+	b.add("POST", "/api/webhooks", openAPIOperation{
+		Summary:     "Register a webhook",
+		Description: "Each expense created is POSTed to the URL as an event, signed in the " + webhookSignatureHeader + " header with the HMAC-SHA256 of the body under the secret. A secret is generated if none is given. Deliveries only go to public addresses and do not follow redirects.",
+		Tags:        []string{"webhooks"},
+		RequestBody: b.jsonBody(Webhook{}),
+		Responses:   map[string]openAPIResponse{"201": b.jsonResponse("The webhook, including its secret", Webhook{})},
+	})
+	b.add("DELETE", "/api/webhooks/{id}", openAPIOperation{
+		Summary: "Delete a webhook", Tags: []string{"webhooks"},
+		Parameters: []openAPIParameter{idParam},
+		Responses:  map[string]openAPIResponse{"204": noContent("Deleted")},
+	})
+	b.add("GET", "/api/webhooks/{id}/deliveries", openAPIOperation{
+		Summary: "Recent delivery attempts", Tags: []string{"webhooks"},
+		Parameters: []openAPIParameter{idParam},
+		Responses:  map[string]openAPIResponse{"200": b.jsonResponse("Up to 100 attempts, newest first", []WebhookDelivery{})},
+	})
+
+	return b.doc
+}
+
+var apiSpec = sync.OnceValue(buildAPISpec)
+
+// getOpenAPISpec serves the OpenAPI document describing this API.
+func getOpenAPISpec(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, apiSpec())
+}
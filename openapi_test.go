@@ -0,0 +1,62 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestServeOpenAPISpec(t *testing.T) {
+	router := (&App{}).routes()
+
+	req, _ := http.NewRequest("GET", "/openapi.json", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var spec struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components struct {
+			Schemas map[string]struct {
+				Properties map[string]json.RawMessage `json:"properties"`
+			} `json:"schemas"`
+		} `json:"components"`
+	}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spec), "Should serve valid JSON")
+	assert.True(t, strings.HasPrefix(spec.OpenAPI, "3."))
+	assert.Contains(t, spec.Paths["/api/expenses"], "post", "Should describe expense creation")
+	assert.Contains(t, spec.Components.Schemas["Expense"].Properties, "amount")
+	assert.Contains(t, spec.Components.Schemas["ErrorResponse"].Properties, "error")
+}
+
+func TestOpenAPICoversRoutes(t *testing.T) {
+	spec := buildAPISpec()
+	registered := map[string]bool{}
+
+	err := (&App{}).routes().Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		path, err := route.GetPathTemplate()
+		if err != nil {
+			return nil
+		}
+		methods, _ := route.GetMethods()
+		for _, method := range methods {
+			registered[method+" "+path] = true
+			assert.Contains(t, spec.Paths[path], strings.ToLower(method), "%s %s is missing from the OpenAPI spec", method, path)
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+
+	// Nothing is documented that isn't served
+	for path, ops := range spec.Paths {
+		for method := range ops {
+			assert.True(t, registered[strings.ToUpper(method)+" "+path], "%s %s is in the spec but not routed", method, path)
+		}
+	}
+}
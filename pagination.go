@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Page sizes for ?paginated=true listings.
+const (
+	defaultPageSize = 50
+	maxPageSize     = 500
+)
+
+// Pagination describes one page of a listing. NextCursor is null on the
+// last page; pass it back as ?cursor= to fetch the next one. Total counts
+// every match, not just this page.
+type Pagination struct {
+	Limit      int     `json:"limit"`
+	NextCursor *string `json:"next_cursor"`
+	Total      int     `json:"total"`
+}
+
+// expensePage is the enveloped form of the expense list.
+type expensePage struct {
+	Data       []Expense  `json:"data"`
+	Pagination Pagination `json:"pagination"`
+}
+
+// pageCursor marks where a page ended: the sort values and id of its last
+// row. It is handed to clients as opaque base64.
+type pageCursor struct {
+	Sort   string   `json:"s"`
+	Values []string `json:"v"`
+	ID     int      `json:"id"`
+}
+
+var errInvalidCursor = errors.New("invalid cursor")
+
+// cursorAfter returns the cursor for the page ending at e.
+func cursorAfter(order sortOrder, e Expense) string {
+	c := pageCursor{Sort: order.key, ID: e.ID}
+	for _, k := range order.keys {
+		switch k.column {
+		case "amount":
+			c.Values = append(c.Values, strconv.FormatInt(int64(e.Amount), 10))
+		default:
+			c.Values = append(c.Values, e.Date.Format(time.RFC3339Nano))
+		}
+	}
+	b, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// parseCursor decodes a cursor and returns the sort values it holds, one
+// per key of order and typed for its column. A cursor from a listing with
+// a different sort is rejected, since its position means nothing in this
+// order.
+func parseCursor(v string, order sortOrder) ([]any, int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(v)
+	if err != nil {
+		return nil, 0, errInvalidCursor
+	}
+	var c pageCursor
+	if err := json.Unmarshal(b, &c); err != nil || c.ID <= 0 {
+		return nil, 0, errInvalidCursor
+	}
+	if c.Sort != order.key {
+		return nil, 0, fmt.Errorf("cursor was issued for sort %q, not %q", c.Sort, order.key)
+	}
+	if len(c.Values) != len(order.keys) {
+		return nil, 0, errInvalidCursor
+	}
+
+	values := make([]any, len(order.keys))
+	for i, k := range order.keys {
+		switch k.column {
+		case "amount":
+			amount, err := strconv.ParseInt(c.Values[i], 10, 64)
+			if err != nil {
+				return nil, 0, errInvalidCursor
+			}
+			values[i] = amount
+		default:
+			date, err := time.Parse(time.RFC3339Nano, c.Values[i])
+			if err != nil {
+				return nil, 0, errInvalidCursor
+			}
+			values[i] = date
+		}
+	}
+	return values, c.ID, nil
+}
+
+// after renders the keyset condition selecting rows that come after the
+// cursor position in this order, numbering its parameters from next: one
+// per sort key, then the id. When every key runs the same way a row
+// comparison does it; mixed directions need each key compared in turn.
+func (s sortOrder) after(next int) string {
+	keys := append(append([]sortKey{}, s.keys...), s.idKey())
+	columns := make([]string, len(keys))
+	params := make([]string, len(keys))
+	sameDirection := true
+	for i, k := range keys {
+		columns[i] = k.column
+		params[i] = fmt.Sprintf("$%d", next+i)
+		sameDirection = sameDirection && k.desc == keys[0].desc
+	}
+
+	if sameDirection {
+		return fmt.Sprintf(" AND (%s) %s (%s)", strings.Join(columns, ", "), keys[0].after(), strings.Join(params, ", "))
+	}
+
+	// Past the cursor on the first key, or level with it there and past it
+	// on the second, and so on.
+	alternatives := make([]string, len(keys))
+	for i, k := range keys {
+		var terms []string
+		for j := 0; j < i; j++ {
+			terms = append(terms, columns[j]+" = "+params[j])
+		}
+		terms = append(terms, columns[i]+" "+k.after()+" "+params[i])
+		alternatives[i] = "(" + strings.Join(terms, " AND ") + ")"
+	}
+	return " AND (" + strings.Join(alternatives, " OR ") + ")"
+}
+
+// after is the comparison selecting values that come later in k's
+// direction.
+func (k sortKey) after() string {
+	if k.desc {
+		return "<"
+	}
+	return ">"
+}
+
+// parsePageSize reads ?limit= for paginated listings.
+func parsePageSize(r *http.Request) (int, error) {
+	v := r.URL.Query().Get("limit")
+	if v == "" {
+		return defaultPageSize, nil
+	}
+	n, err := strconv.Atoi(v)
+	if err != nil || n < 1 || n > maxPageSize {
+		return 0, fmt.Errorf("invalid limit %q: must be between 1 and %d", v, maxPageSize)
+	}
+	return n, nil
+}
+
+// listExpensePage writes one page of the expenses matching filter, in
+// order, starting after ?cursor= if given. Pages are keyed on the sort
+// value and id of the last row, so rows added or removed meanwhile don't
+// shift later pages.
+func (app *App) listExpensePage(w http.ResponseWriter, r *http.Request, filter expenseFilter, order sortOrder) {
+	limit, err := parsePageSize(r)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	where, args := filter.where(app.now())
+	pageWhere, pageArgs := where, args
+	if v := r.URL.Query().Get("cursor"); v != "" {
+		values, id, err := parseCursor(v, order)
+		if err != nil {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		pageWhere += order.after(len(args) + 1)
+		pageArgs = append(append(append([]any{}, args...), values...), id)
+	}
+
+	page := expensePage{Data: []Expense{}, Pagination: Pagination{Limit: limit}}
+	err = app.queryWithTimeout(r.Context(), "list expense page", func(ctx context.Context) error {
+		err := app.DBClient.QueryRow(ctx, "SELECT COUNT(*) FROM expenses"+where, args...).Scan(&page.Pagination.Total)
+		if err != nil {
+			return err
+		}
+
+		// One extra row tells us whether there is a next page.
+		rows, err := app.DBClient.Query(ctx,
+			"SELECT "+expenseColumns+" FROM expenses"+pageWhere+order.orderBy()+fmt.Sprintf(" LIMIT %d", limit+1),
+			pageArgs...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e Expense
+			if err := scanExpense(rows, &e); err != nil {
+				return err
+			}
+			page.Data = append(page.Data, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	if len(page.Data) > limit {
+		page.Data = page.Data[:limit]
+		next := cursorAfter(order, page.Data[limit-1])
+		page.Pagination.NextCursor = &next
+	}
+
+	writeJSONWithETag(w, r, page)
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetExpensesPaginated(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	base := time.Now().Add(-time.Hour).Round(time.Second)
+	for i := 0; i < 3; i++ {
+		_, err := app.DBClient.Exec(context.Background(),
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			fmt.Sprintf("Page item %d", i), Cents(1000), "Food", base.Add(time.Duration(i)*time.Minute), accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	get := func(query string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses?account_id=%d&%s", accountID, query), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// The bare array is still the default
+	rr := get("")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var all []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &all), "Should return a bare array")
+	assert.Len(t, all, 3)
+
+	// The envelope pages through the same rows in order
+	rr = get("paginated=true&limit=2")
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var page expensePage
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	assert.Len(t, page.Data, 2)
+	assert.Equal(t, 2, page.Pagination.Limit)
+	assert.Equal(t, 3, page.Pagination.Total, "Should count every match")
+	if !assert.NotNil(t, page.Pagination.NextCursor, "Should point at the next page") {
+		return
+	}
+	seen := []int{page.Data[0].ID, page.Data[1].ID}
+
+	rr = get("paginated=true&limit=2&cursor=" + *page.Pagination.NextCursor)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	page = expensePage{}
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &page))
+	if assert.Len(t, page.Data, 1) {
+		seen = append(seen, page.Data[0].ID)
+	}
+	assert.Nil(t, page.Pagination.NextCursor, "Should be the last page")
+	assert.Equal(t, []int{all[0].ID, all[1].ID, all[2].ID}, seen, "Should match the unpaginated order")
+
+	// Paging options need the envelope
+	rr = get("limit=2")
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
+
+func TestParseCursor(t *testing.T) {
+	byDate, _ := parseSort("-date")
+	byAmount, _ := parseSort("amount")
+	date := time.Date(2024, 5, 1, 12, 30, 0, 0, time.UTC)
+
+	value, id, err := parseCursor(cursorAfter(byDate, Expense{ID: 7, Date: date}), byDate)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{date}, value)
+	assert.Equal(t, 7, id)
+
+	value, _, err = parseCursor(cursorAfter(byAmount, Expense{ID: 7, Amount: 1250}), byAmount)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{int64(1250)}, value)
+
+	_, _, err = parseCursor(cursorAfter(byDate, Expense{ID: 7, Date: date}), byAmount)
+	assert.Error(t, err, "Should reject a cursor from another sort")
+
+	_, _, err = parseCursor("not-a-cursor", byDate)
+	assert.Error(t, err)
+
+	assert.Equal(t, " AND (date, id) < ($3, $4)", byDate.after(3))
+	assert.Equal(t, " AND (amount, id) > ($1, $2)", byAmount.after(1))
+
+	// Several keys carry a value each
+	byDateAmount, _ := parseSort("-date,-amount")
+	value, id, err = parseCursor(cursorAfter(byDateAmount, Expense{ID: 9, Date: date, Amount: 500}), byDateAmount)
+	assert.NoError(t, err)
+	assert.Equal(t, []any{date, int64(500)}, value)
+	assert.Equal(t, 9, id)
+	assert.Equal(t, " AND (date, amount, id) < ($1, $2, $3)", byDateAmount.after(1))
+
+	// Mixed directions can't use a row comparison
+	mixed, _ := parseSort("-date,amount")
+	assert.Equal(t, " AND ((date < $2) OR (date = $2 AND amount > $3) OR (date = $2 AND amount = $3 AND id > $4))", mixed.after(2))
+}
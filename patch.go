@@ -0,0 +1,195 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// expensePatch is the body of a PATCH request. Fields left out of the JSON
+// stay nil and are not touched.
+type expensePatch struct {
+	Description *string    `json:"description"`
+	Amount      *Cents     `json:"amount"`
+	Category    *string    `json:"category"`
+	Date        *time.Time `json:"date"`
+	AccountID   *int       `json:"account_id"`
+	Currency    *string    `json:"currency"`
+	Type        *string    `json:"type"`
+	Tags        *[]string  `json:"tags"`
+	Notes       *string    `json:"notes"`
+}
+
+// apply copies the set fields onto e.
+func (p expensePatch) apply(e *Expense) {
+	if p.Description != nil {
+		e.Description = *p.Description
+	}
+	if p.Amount != nil {
+		e.Amount = *p.Amount
+	}
+	if p.Category != nil {
+		e.Category = *p.Category
+	}
+	if p.Date != nil {
+		e.Date = *p.Date
+	}
+	if p.AccountID != nil {
+		e.AccountID = *p.AccountID
+	}
+	if p.Currency != nil {
+		e.Currency = normalizeCurrency(*p.Currency)
+	}
+	if p.Type != nil {
+		e.Type = *p.Type
+	}
+	if p.Tags != nil {
+		e.Tags = *p.Tags
+	}
+	if p.Notes != nil {
+		e.Notes = p.Notes
+	}
+}
+
+// patchExpense updates only the fields present in the body, so a client
+// changing the amount can't wipe the description by omission.
+func (app *App) patchExpense(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var patch expensePatch
+	if err := decodeStrict(r, &patch); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Validate the expense as it will look after the patch.
+	var expense Expense
+	err = scanExpense(tx.QueryRow(r.Context(),
+		"SELECT "+expenseColumns+" FROM expenses WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id), &expense)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "expense not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	patch.apply(&expense)
+	errs := app.validateExpense(expense)
+	if patch.Currency != nil && expense.Currency == "" {
+		errs = append(errs, FieldError{"currency", "currency must not be empty"})
+	}
+	if patch.Type != nil && expense.Type == "" {
+		errs = append(errs, FieldError{"type", "type must not be empty"})
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	// Build the SET list from the fields the client actually sent.
+	var sets []string
+	var args []any
+	set := func(column string, value any) {
+		args = append(args, value)
+		sets = append(sets, fmt.Sprintf("%s=$%d", column, len(args)))
+	}
+
+	if patch.Description != nil {
+		set("description", expense.Description)
+	}
+	if patch.Amount != nil {
+		set("amount", expense.Amount)
+	}
+	if patch.Category != nil {
+		category, err := app.resolveCategory(r.Context(), expense.Category)
+		if errors.Is(err, errUnknownCategory) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		set("category", category)
+	}
+	if patch.Date != nil {
+		set("date", expense.Date)
+	}
+	if patch.AccountID != nil {
+		set("account_id", expense.AccountID)
+	}
+	if patch.Currency != nil {
+		set("currency", expense.Currency)
+	}
+	if patch.Type != nil {
+		set("type", expense.Type)
+	}
+	if patch.Notes != nil {
+		// An empty string removes the notes.
+		args = append(args, *patch.Notes)
+		sets = append(sets, fmt.Sprintf("notes=NULLIF($%d, '')", len(args)))
+	}
+
+	if len(sets) == 0 && patch.Tags == nil {
+		writeJSONError(w, http.StatusBadRequest, "no updatable fields in request body")
+		return
+	}
+
+	// A tags-only patch still touches the row so updated_at moves forward.
+	if len(sets) == 0 {
+		sets = append(sets, "updated_at = NOW()")
+	}
+	args = append(args, id)
+	err = scanExpense(tx.QueryRow(r.Context(),
+		fmt.Sprintf("UPDATE expenses SET %s WHERE id=$%d RETURNING %s", strings.Join(sets, ", "), len(args), expenseColumns),
+		args...), &expense)
+	if isPgError(err, pgForeignKeyViolation) {
+		writeJSONError(w, http.StatusBadRequest, "account does not exist")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if patch.Amount != nil {
+		err = checkRefundLimit(r.Context(), tx, expense)
+		if errors.Is(err, errRefundLimit) || errors.Is(err, errRefundedDeleted) {
+			writeJSONError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	// Tags live in their own table, so they are replaced separately.
+	if patch.Tags != nil {
+		if expense.Tags, err = setExpenseTags(r.Context(), tx, expense.ID, *patch.Tags); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expense)
+}
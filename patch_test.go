@@ -0,0 +1,109 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func insertTestExpense(t *testing.T, app *App, e Expense) int {
+	t.Helper()
+
+	var id int
+	err := app.DBClient.QueryRow(context.Background(),
+		"INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4) RETURNING id",
+		e.Description, e.Amount, e.Category, e.Date).Scan(&id)
+	assert.NoError(t, err, "Should insert test expense")
+	return id
+}
+
+func patchRequest(router http.Handler, id int, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("PATCH", fmt.Sprintf("/api/expenses/%d", id), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPatchExpenseAmountOnly(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	original := Expense{
+		Description: "Lunch",
+		Amount:      1200,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	}
+	id := insertTestExpense(t, app, original)
+
+	rr := patchRequest(router, id, `{"amount": 14.75}`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+	var patched Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &patched))
+	assert.Equal(t, Cents(1475), patched.Amount, "Amount should change")
+	assert.Equal(t, original.Description, patched.Description, "Description should be untouched")
+	assert.Equal(t, original.Category, patched.Category, "Category should be untouched")
+	assert.Equal(t, original.Date.Format(time.RFC3339), patched.Date.Format(time.RFC3339), "Date should be untouched")
+}
+
+func TestPatchExpenseCategoryOnly(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	original := Expense{
+		Description: "Bus pass",
+		Amount:      3000,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	}
+	id := insertTestExpense(t, app, original)
+
+	rr := patchRequest(router, id, `{"category": "transport"}`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should return 200 OK")
+
+	var patched Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &patched))
+	assert.Equal(t, "Transport", patched.Category, "Category should change to the canonical name")
+	assert.Equal(t, original.Amount, patched.Amount, "Amount should be untouched")
+	assert.Equal(t, original.Description, patched.Description, "Description should be untouched")
+}
+
+func TestPatchExpenseInvalid(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	id := insertTestExpense(t, app, Expense{
+		Description: "Snack",
+		Amount:      250,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	})
+
+	// No updatable fields
+	rr := patchRequest(router, id, `{}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject an empty patch")
+
+	// Patched values are still validated
+	rr = patchRequest(router, id, `{"amount": -1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should reject a negative amount")
+
+	// Clearing the currency is a field error like any other
+	rr = patchRequest(router, id, `{"currency": "", "amount": -1}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should reject an empty currency")
+	var resp errorResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.ElementsMatch(t, []string{"currency", "amount"}, fieldNames(resp.Errors))
+
+	// Unknown expense
+	rr = patchRequest(router, 999999, `{"amount": 1}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Should return 404")
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// queryWithTimeout runs fn, which should do all of its database work with
+// the context it is given, under app.QueryTimeout. A run that takes
+// app.SlowQueryThreshold or longer is logged under label, so slow queries
+// show up before they tie up the pool. Zero durations turn either off.
+//
+// Every query whose cost grows with the number of expenses goes through
+// it: listings, search, export, sync, reports and budgets, as well as the
+// budget alert checks, which run in the background. Writes and single-row
+// lookups made for a request run on its context alone, which
+// REQUEST_TIMEOUT bounds.
+func (app *App) queryWithTimeout(ctx context.Context, label string, fn func(ctx context.Context) error) error {
+	if app.QueryTimeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, app.QueryTimeout)
+		defer cancel()
+	}
+
+	start := time.Now()
+	err := fn(ctx)
+	if elapsed := time.Since(start); app.SlowQueryThreshold > 0 && elapsed >= app.SlowQueryThreshold {
+		slog.WarnContext(ctx, "Slow query", "query", label, "duration", elapsed, "error", err)
+	}
+	return err
+}
+
+// writeQueryError reports a failed query: 503 if it ran out of time, which
+// is worth retrying, and 500 otherwise.
+func writeQueryError(w http.ResponseWriter, err error) {
+	if errors.Is(err, context.DeadlineExceeded) {
+		writeJSONError(w, http.StatusServiceUnavailable, "query timed out")
+		return
+	}
+	writeJSONError(w, http.StatusInternalServerError, err.Error())
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogs sends the default logger to a buffer for the rest of the
+// test.
+func captureLogs(t *testing.T) *bytes.Buffer {
+	var logs bytes.Buffer
+	prev := slog.Default()
+	slog.SetDefault(slog.New(slog.NewTextHandler(&logs, nil)))
+	t.Cleanup(func() { slog.SetDefault(prev) })
+	return &logs
+}
+
+func TestQueryWithTimeoutLogsSlowQueries(t *testing.T) {
+	logs := captureLogs(t)
+	app := &App{SlowQueryThreshold: 20 * time.Millisecond}
+
+	err := app.queryWithTimeout(context.Background(), "quick", func(ctx context.Context) error { return nil })
+	assert.NoError(t, err)
+	assert.Empty(t, logs.String(), "Fast queries should not be logged")
+
+	err = app.queryWithTimeout(context.Background(), "sluggish", func(ctx context.Context) error {
+		time.Sleep(30 * time.Millisecond)
+		return nil
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), "level=WARN")
+	assert.Contains(t, logs.String(), `msg="Slow query" query=sluggish`)
+}
+
+func TestQueryWithTimeoutCancels(t *testing.T) {
+	app := &App{QueryTimeout: 10 * time.Millisecond}
+
+	err := app.queryWithTimeout(context.Background(), "stuck", func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+
+	rr := httptest.NewRecorder()
+	writeQueryError(rr, err)
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "A timed out query is worth retrying")
+}
+
+func TestQueryWithTimeoutDatabase(t *testing.T) {
+	app, _ := setupTestApp()
+	defer app.DBClient.Close()
+
+	logs := captureLogs(t)
+	app.SlowQueryThreshold = 50 * time.Millisecond
+	app.QueryTimeout = 200 * time.Millisecond
+
+	err := app.queryWithTimeout(context.Background(), "nap", func(ctx context.Context) error {
+		_, err := app.DBClient.Exec(ctx, "SELECT pg_sleep(0.1)")
+		return err
+	})
+	assert.NoError(t, err)
+	assert.Contains(t, logs.String(), `msg="Slow query" query=nap`)
+
+	// The statement is cancelled once the timeout passes
+	start := time.Now()
+	err = app.queryWithTimeout(context.Background(), "long nap", func(ctx context.Context) error {
+		_, err := app.DBClient.Exec(ctx, "SELECT pg_sleep(5)")
+		return err
+	})
+	assert.ErrorIs(t, err, context.DeadlineExceeded)
+	assert.Less(t, time.Since(start), 2*time.Second)
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"math"
+	"net"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// rateLimitIdleTTL is how long a client's bucket is kept after its last
+// request. An idle bucket has refilled long before this, so dropping it
+// loses nothing.
+const rateLimitIdleTTL = 10 * time.Minute
+
+// ipRateLimiter hands out one token bucket per client IP.
+type ipRateLimiter struct {
+	limit rate.Limit
+	burst int
+	now   func() time.Time
+
+	mu      sync.Mutex
+	clients map[string]*clientBucket
+}
+
+type clientBucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func newIPRateLimiter(rps, burst int) *ipRateLimiter {
+	return &ipRateLimiter{
+		limit:   rate.Limit(rps),
+		burst:   burst,
+		now:     time.Now,
+		clients: map[string]*clientBucket{},
+	}
+}
+
+// bucket returns the limiter for ip, creating it on first use.
+func (l *ipRateLimiter) bucket(ip string) *rate.Limiter {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	b, ok := l.clients[ip]
+	if !ok {
+		b = &clientBucket{limiter: rate.NewLimiter(l.limit, l.burst)}
+		l.clients[ip] = b
+	}
+	b.lastSeen = l.now()
+	return b.limiter
+}
+
+// prune drops buckets that have not been used for idle.
+func (l *ipRateLimiter) prune(idle time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	cutoff := l.now().Add(-idle)
+	for ip, b := range l.clients {
+		if b.lastSeen.Before(cutoff) {
+			delete(l.clients, ip)
+		}
+	}
+}
+
+// runPruner prunes idle buckets every interval until ctx is cancelled, so
+// the map doesn't grow with every address ever seen.
+func (l *ipRateLimiter) runPruner(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			l.prune(rateLimitIdleTTL)
+		}
+	}
+}
+
+// clientIP is the address the request came from. Forwarding headers are
+// ignored since any client can set them.
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// rateLimitMiddleware rejects requests beyond the client's allowance with
+// 429 Too Many Requests and a Retry-After header in whole seconds. The
+// health probes are never limited.
+func rateLimitMiddleware(l *ipRateLimiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/healthz" || r.URL.Path == "/readyz" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			res := l.bucket(clientIP(r)).Reserve()
+			if delay := res.Delay(); delay > 0 {
+				// Hand the token back; this request isn't going to use it.
+				res.Cancel()
+				w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(delay.Seconds()))))
+				writeJSONError(w, http.StatusTooManyRequests, "rate limit exceeded")
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
@@ -0,0 +1,57 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRateLimitMiddleware(t *testing.T) {
+	limiter := newIPRateLimiter(1, 3)
+	handler := rateLimitMiddleware(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusOK)
+	}))
+
+	serve := func(path, remoteAddr string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("GET", path, nil)
+		req.RemoteAddr = remoteAddr
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Fire rapid requests from one client until the bucket runs dry
+	var limited *httptest.ResponseRecorder
+	for i := 0; i < 10; i++ {
+		rr := serve("/api/expenses", "203.0.113.7:51000")
+		if rr.Code == http.StatusTooManyRequests {
+			limited = rr
+			break
+		}
+	}
+	if assert.NotNil(t, limited, "Should return 429 once the burst is used up") {
+		assert.Equal(t, "1", limited.Header().Get("Retry-After"))
+		assert.Contains(t, limited.Body.String(), "rate limit exceeded")
+	}
+
+	// Other clients and the probes are unaffected
+	assert.Equal(t, http.StatusOK, serve("/api/expenses", "198.51.100.2:40000").Code)
+	assert.Equal(t, http.StatusOK, serve("/healthz", "203.0.113.7:51000").Code)
+}
+
+func TestRateLimiterPrunesIdleBuckets(t *testing.T) {
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newIPRateLimiter(1, 1)
+	limiter.now = func() time.Time { return now }
+
+	limiter.bucket("203.0.113.7")
+	now = now.Add(time.Minute)
+	limiter.bucket("198.51.100.2")
+
+	limiter.prune(30 * time.Second)
+	assert.Len(t, limiter.clients, 1, "Should drop only the idle bucket")
+	assert.Contains(t, limiter.clients, "198.51.100.2")
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// RateProvider supplies exchange rates for converting summary totals.
+type RateProvider interface {
+	// Rate returns how many units of to one unit of from is worth.
+	Rate(ctx context.Context, from, to string) (float64, error)
+}
+
+// rateFetchTimeout bounds a single request to the exchange-rate API.
+const rateFetchTimeout = 5 * time.Second
+
+// HTTPRateProvider fetches rates from a Frankfurter-compatible API
+// (GET {base}/latest?from=USD&to=EUR) and caches each pair for a TTL. Once a
+// cached rate expires it is never served again: a failed refresh is an
+// error rather than a silently stale conversion.
+type HTTPRateProvider struct {
+	baseURL string
+	ttl     time.Duration
+	client  *http.Client
+	now     func() time.Time
+
+	mu    sync.Mutex
+	cache map[string]cachedRate
+}
+
+type cachedRate struct {
+	rate      float64
+	fetchedAt time.Time
+}
+
+// NewHTTPRateProvider returns a provider for the API at baseURL that keeps
+// rates for ttl.
+func NewHTTPRateProvider(baseURL string, ttl time.Duration) *HTTPRateProvider {
+	return &HTTPRateProvider{
+		baseURL: baseURL,
+		ttl:     ttl,
+		client:  &http.Client{Timeout: rateFetchTimeout},
+		now:     time.Now,
+		cache:   map[string]cachedRate{},
+	}
+}
+
+func (p *HTTPRateProvider) Rate(ctx context.Context, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+
+	key := from + "/" + to
+	p.mu.Lock()
+	c, ok := p.cache[key]
+	p.mu.Unlock()
+	if ok && p.now().Sub(c.fetchedAt) < p.ttl {
+		return c.rate, nil
+	}
+
+	rate, err := p.fetch(ctx, from, to)
+	if err != nil {
+		return 0, err
+	}
+
+	p.mu.Lock()
+	p.cache[key] = cachedRate{rate: rate, fetchedAt: p.now()}
+	p.mu.Unlock()
+	return rate, nil
+}
+
+func (p *HTTPRateProvider) fetch(ctx context.Context, from, to string) (float64, error) {
+	u := fmt.Sprintf("%s/latest?from=%s&to=%s", p.baseURL, url.QueryEscape(from), url.QueryEscape(to))
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return 0, err
+	}
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return 0, fmt.Errorf("fetching %s/%s rate: %w", from, to, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return 0, fmt.Errorf("fetching %s/%s rate: unexpected status %d", from, to, resp.StatusCode)
+	}
+
+	var body struct {
+		Rates map[string]float64 `json:"rates"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&body); err != nil {
+		return 0, fmt.Errorf("decoding %s/%s rate: %w", from, to, err)
+	}
+	rate, ok := body.Rates[to]
+	if !ok || rate <= 0 {
+		return 0, fmt.Errorf("no %s/%s rate in response", from, to)
+	}
+	return rate, nil
+}
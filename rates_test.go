@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHTTPRateProviderCaches(t *testing.T) {
+	calls := 0
+	fail := false
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		if fail {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		assert.Equal(t, "/latest", r.URL.Path)
+		assert.Equal(t, "USD", r.URL.Query().Get("from"))
+		fmt.Fprintf(w, `{"base": "USD", "rates": {%q: 0.5}}`, r.URL.Query().Get("to"))
+	}))
+	defer server.Close()
+
+	now := time.Date(2024, 3, 1, 12, 0, 0, 0, time.UTC)
+	p := NewHTTPRateProvider(server.URL, time.Hour)
+	p.now = func() time.Time { return now }
+
+	ctx := context.Background()
+	rate, err := p.Rate(ctx, "USD", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, rate)
+
+	// Within the TTL the cached rate is used
+	now = now.Add(59 * time.Minute)
+	rate, err = p.Rate(ctx, "USD", "EUR")
+	assert.NoError(t, err)
+	assert.Equal(t, 0.5, rate)
+	assert.Equal(t, 1, calls, "Should not refetch within the TTL")
+
+	// Same currency never hits the API
+	rate, err = p.Rate(ctx, "USD", "USD")
+	assert.NoError(t, err)
+	assert.Equal(t, 1.0, rate)
+	assert.Equal(t, 1, calls)
+
+	// Past the TTL a failed refresh is an error, not the stale rate
+	now = now.Add(2 * time.Minute)
+	fail = true
+	_, err = p.Rate(ctx, "USD", "EUR")
+	assert.Error(t, err, "Should not serve a rate past its TTL")
+	assert.Equal(t, 2, calls)
+}
+
+func TestHTTPRateProviderMissingRate(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, `{"base": "USD", "rates": {}}`)
+	}))
+	defer server.Close()
+
+	_, err := NewHTTPRateProvider(server.URL, time.Hour).Rate(context.Background(), "USD", "EUR")
+	assert.ErrorContains(t, err, "no USD/EUR rate")
+}
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// maxReceiptBytes caps the size of an uploaded receipt.
+const maxReceiptBytes = 10 << 20
+
+// maxReceiptBodyBytes caps the whole upload, leaving some room over the
+// file limit for the multipart framing.
+const maxReceiptBodyBytes = maxReceiptBytes + 64<<10
+
+var errReceiptTooLarge = fmt.Errorf("receipt must not exceed %d MB", maxReceiptBytes>>20)
+
+// receiptContentTypes are the accepted receipt formats. The type is sniffed
+// from the file itself rather than trusted from the client.
+var receiptContentTypes = map[string]bool{
+	"image/jpeg":      true,
+	"image/png":       true,
+	"image/webp":      true,
+	"application/pdf": true,
+}
+
+// newReceiptKey returns a fresh blob key for a receipt on expense id. Every
+// upload gets its own key so replacing a receipt never overwrites the file
+// a concurrent download is reading.
+func newReceiptKey(id int) (string, error) {
+	b := make([]byte, 8)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return fmt.Sprintf("receipts/%d/%s", id, hex.EncodeToString(b)), nil
+}
+
+// readReceiptPart returns the contents of the "receipt" file field of a
+// multipart body, failing with errReceiptTooLarge past maxReceiptBytes.
+func readReceiptPart(r *http.Request) ([]byte, error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return nil, errors.New("missing receipt file field")
+		}
+		if err != nil {
+			return nil, err
+		}
+		if part.FormName() != "receipt" {
+			continue
+		}
+
+		data, err := io.ReadAll(io.LimitReader(part, maxReceiptBytes+1))
+		if err != nil {
+			return nil, err
+		}
+		if len(data) > maxReceiptBytes {
+			return nil, errReceiptTooLarge
+		}
+		return data, nil
+	}
+}
+
+// uploadReceipt attaches an image or PDF receipt to an expense, sent as the
+// "receipt" field of a multipart form. An existing receipt is replaced.
+func (app *App) uploadReceipt(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxReceiptBodyBytes)
+	data, err := readReceiptPart(r)
+	var maxErr *http.MaxBytesError
+	if errors.Is(err, errReceiptTooLarge) || errors.As(err, &maxErr) {
+		writeJSONError(w, http.StatusRequestEntityTooLarge, errReceiptTooLarge.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	contentType := http.DetectContentType(data)
+	if !receiptContentTypes[contentType] {
+		writeJSONError(w, http.StatusUnsupportedMediaType,
+			fmt.Sprintf("unsupported receipt type %s: must be a JPEG, PNG or WebP image or a PDF", contentType))
+		return
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	var expenseID int
+	var oldKey *string
+	err = tx.QueryRow(r.Context(),
+		"SELECT id, receipt_key FROM expenses WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id).
+		Scan(&expenseID, &oldKey)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "expense not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	key, err := newReceiptKey(expenseID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := app.Receipts.Put(r.Context(), key, bytes.NewReader(data)); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	var expense Expense
+	err = scanExpense(tx.QueryRow(r.Context(),
+		"UPDATE expenses SET receipt_key=$1, receipt_content_type=$2 WHERE id=$3 RETURNING "+expenseColumns,
+		key, contentType, expenseID), &expense)
+	if err == nil {
+		err = tx.Commit(r.Context())
+	}
+	if err != nil {
+		app.deleteBlob(r, key)
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if oldKey != nil {
+		app.deleteBlob(r, *oldKey)
+	}
+
+	writeJSON(w, http.StatusCreated, expense)
+}
+
+// getReceipt streams an expense's receipt back with its content type.
+func (app *App) getReceipt(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var key, contentType *string
+	err := app.DBClient.QueryRow(r.Context(),
+		"SELECT receipt_key, receipt_content_type FROM expenses WHERE id=$1 AND deleted_at IS NULL", id).
+		Scan(&key, &contentType)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "expense not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if key == nil {
+		writeJSONError(w, http.StatusNotFound, "expense has no receipt")
+		return
+	}
+
+	blob, err := app.Receipts.Get(r.Context(), *key)
+	if errors.Is(err, errBlobNotFound) {
+		writeJSONError(w, http.StatusNotFound, "receipt not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer blob.Close()
+
+	w.Header().Set("Content-Type", *contentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, blob); err != nil {
+		slog.ErrorContext(r.Context(), "Error sending receipt", "key", *key, "error", err)
+	}
+}
+
+// deleteBlob removes a receipt that is no longer referenced. A failure only
+// leaves an orphaned file, so it is logged rather than failing the request.
+func (app *App) deleteBlob(r *http.Request, key string) {
+	if err := app.Receipts.Delete(r.Context(), key); err != nil {
+		slog.ErrorContext(r.Context(), "Error deleting receipt", "key", key, "error", err)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// memBlobStore is an in-memory BlobStore for tests.
+type memBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{blobs: map[string][]byte{}}
+}
+
+func (s *memBlobStore) Put(ctx context.Context, key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memBlobStore) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.blobs[key]
+	if !ok {
+		return nil, errBlobNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memBlobStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.blobs, key)
+	return nil
+}
+
+func (s *memBlobStore) len() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.blobs)
+}
+
+// pngData is enough of a PNG for content sniffing.
+var pngData = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte{0}, 64)...)
+
+func receiptUpload(router http.Handler, id int, data []byte) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("receipt", "receipt.png")
+	fw.Write(data)
+	mw.Close()
+
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/expenses/%d/receipt", id), &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestReceiptUploadAndDownload(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+	store := newMemBlobStore()
+	app.Receipts = store
+
+	id := insertTestExpense(t, app, Expense{
+		Description: "Printer ink",
+		Amount:      4500,
+		Category:    "Shopping",
+		Date:        time.Now().Round(time.Second),
+	})
+
+	rr := receiptUpload(router, id, pngData)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should accept a PNG receipt")
+	assert.Contains(t, rr.Body.String(), `"has_receipt":true`)
+
+	// Attaching a receipt doesn't show up as a change in the history
+	var updates int
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM expense_audit WHERE expense_id=$1 AND action='update'", id).Scan(&updates)
+	assert.NoError(t, err)
+	assert.Zero(t, updates, "Should not audit a receipt upload as an update")
+
+	// Create request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/%d/receipt", id), nil)
+	rr = httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Equal(t, "image/png", rr.Header().Get("Content-Type"))
+	assert.Equal(t, pngData, rr.Body.Bytes(), "Should return the uploaded file")
+
+	// Replacing the receipt drops the old blob
+	rr = receiptUpload(router, id, pngData)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, 1, store.len(), "Should not keep the replaced receipt")
+
+	// Deleting the expense deletes its receipt
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/expenses/%d", id), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+	assert.Equal(t, 0, store.len(), "Should delete the receipt with the expense")
+}
+
+func TestReceiptUploadRejections(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+	store := newMemBlobStore()
+	app.Receipts = store
+
+	id := insertTestExpense(t, app, Expense{
+		Description: "Desk",
+		Amount:      15000,
+		Category:    "Shopping",
+		Date:        time.Now().Round(time.Second),
+	})
+
+	oversized := append(append([]byte{}, pngData...), make([]byte, maxReceiptBytes)...)
+	rr := receiptUpload(router, id, oversized)
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rr.Code, "Should reject an oversized receipt")
+
+	rr = receiptUpload(router, id, []byte("just some text"))
+	assert.Equal(t, http.StatusUnsupportedMediaType, rr.Code, "Should reject a non-image, non-PDF file")
+
+	rr = receiptUpload(router, 999999, pngData)
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+
+	assert.Equal(t, 0, store.len(), "Nothing should have been stored")
+}
+
+func TestLocalBlobStore(t *testing.T) {
+	ctx := context.Background()
+	store := NewLocalBlobStore(t.TempDir())
+
+	assert.NoError(t, store.Put(ctx, "receipts/1/abc", strings.NewReader("hello")))
+
+	blob, err := store.Get(ctx, "receipts/1/abc")
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(blob)
+		blob.Close()
+		assert.Equal(t, "hello", string(data))
+	}
+
+	assert.NoError(t, store.Delete(ctx, "receipts/1/abc"))
+	_, err = store.Get(ctx, "receipts/1/abc")
+	assert.ErrorIs(t, err, errBlobNotFound)
+	assert.NoError(t, store.Delete(ctx, "receipts/1/abc"), "Deleting a missing blob is fine")
+
+	assert.Error(t, store.Put(ctx, "../escape", strings.NewReader("x")), "Should refuse keys outside the directory")
+}
@@ -0,0 +1,234 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"time"
+)
+
+// recurringCheckInterval is how often the worker looks for due entries.
+const recurringCheckInterval = time.Minute
+
+// maxRecurringCatchUp caps the occurrences generated for one entry in one
+// pass, so an entry that fell far behind catches up over several passes
+// instead of in one huge transaction.
+const maxRecurringCatchUp = 100
+
+// RecurringExpense generates a concrete expense every Interval, starting at
+// NextRun.
+type RecurringExpense struct {
+	ID          int       `json:"id"`
+	Description string    `json:"description"`
+	Amount      Cents     `json:"amount"`
+	Currency    string    `json:"currency"`
+	Category    string    `json:"category"`
+	AccountID   int       `json:"account_id"`
+	Interval    string    `json:"interval"`
+	NextRun     time.Time `json:"next_run"`
+
+	// dayOfMonth is the day monthly runs fall on, taken from the first
+	// NextRun.
+	dayOfMonth int
+}
+
+// recurringIntervals are the supported repeat intervals.
+var recurringIntervals = map[string]bool{
+	"daily":   true,
+	"weekly":  true,
+	"monthly": true,
+}
+
+// nextRun returns the occurrence after t for the given interval. Monthly
+// entries fall on day of the month, or on the month's last day when it is
+// shorter, so one started on Jan 31 runs on Feb 29 and then Mar 31 again.
+func nextRun(t time.Time, interval string, day int) time.Time {
+	switch interval {
+	case "daily":
+		return t.AddDate(0, 0, 1)
+	case "weekly":
+		return t.AddDate(0, 0, 7)
+	default:
+		y, m, _ := t.Date()
+		firstOfNext := time.Date(y, m+1, 1, t.Hour(), t.Minute(), t.Second(), t.Nanosecond(), t.Location())
+		if last := firstOfNext.AddDate(0, 1, -1).Day(); day > last {
+			day = last
+		}
+		return firstOfNext.AddDate(0, 0, day-1)
+	}
+}
+
+func (app *App) getRecurringExpenses(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DBClient.Query(r.Context(),
+		`SELECT id, description, amount, currency, category, account_id, interval, next_run
+		 FROM recurring_expenses ORDER BY next_run`)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	recurring := []RecurringExpense{}
+	for rows.Next() {
+		var re RecurringExpense
+		if err := rows.Scan(&re.ID, &re.Description, &re.Amount, &re.Currency, &re.Category, &re.AccountID, &re.Interval, &re.NextRun); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		recurring = append(recurring, re)
+	}
+
+	writeJSON(w, http.StatusOK, recurring)
+}
+
+func (app *App) createRecurringExpense(w http.ResponseWriter, r *http.Request) {
+	var re RecurringExpense
+	if err := json.NewDecoder(r.Body).Decode(&re); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	re.Currency = normalizeCurrency(re.Currency)
+
+	// The generated expenses must pass the usual validation.
+	template := Expense{Description: re.Description, Amount: re.Amount, Category: re.Category, Date: re.NextRun, Currency: re.Currency}
+	if errs := template.Validate(); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+	if !recurringIntervals[re.Interval] {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("invalid interval %q: must be daily, weekly or monthly", re.Interval))
+		return
+	}
+
+	category, err := app.resolveCategory(r.Context(), re.Category)
+	if errors.Is(err, errUnknownCategory) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	re.Category = category
+	if re.Currency == "" {
+		re.Currency = defaultCurrency
+	}
+
+	err = app.DBClient.QueryRow(r.Context(),
+		`INSERT INTO recurring_expenses (description, amount, currency, category, account_id, interval, next_run, day_of_month)
+		 VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, 0), default_account_id()), $6, $7, $8)
+		 RETURNING id, account_id`,
+		re.Description, re.Amount, re.Currency, re.Category, re.AccountID, re.Interval, re.NextRun, re.NextRun.Day()).
+		Scan(&re.ID, &re.AccountID)
+	if isPgError(err, pgForeignKeyViolation) {
+		writeJSONError(w, http.StatusBadRequest, "account does not exist")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, re)
+}
+
+// generateDueRecurring inserts an expense for every occurrence of a
+// recurring entry that is due at now, catching up on any that were missed
+// while the server was down, and advances next_run past now. An entry more
+// than maxRecurringCatchUp occurrences behind is left due to continue on the
+// next pass. Webhooks hear of each expense once the batch is committed. It
+// returns the number of expenses created.
+func (app *App) generateDueRecurring(ctx context.Context, now time.Time) (int, error) {
+	tx, err := app.DBClient.Begin(ctx)
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback(ctx)
+
+	// SKIP LOCKED lets several instances run the worker without generating
+	// the same occurrence twice.
+	rows, err := tx.Query(ctx,
+		`SELECT id, description, amount, currency, category, account_id, interval, next_run,
+			COALESCE(day_of_month, EXTRACT(DAY FROM next_run))::int
+		 FROM recurring_expenses WHERE next_run <= $1
+		 FOR UPDATE SKIP LOCKED`, now)
+	if err != nil {
+		return 0, err
+	}
+
+	var due []RecurringExpense
+	for rows.Next() {
+		var re RecurringExpense
+		if err := rows.Scan(&re.ID, &re.Description, &re.Amount, &re.Currency, &re.Category, &re.AccountID, &re.Interval, &re.NextRun, &re.dayOfMonth); err != nil {
+			rows.Close()
+			return 0, err
+		}
+		due = append(due, re)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return 0, err
+	}
+
+	var created []Expense
+	for _, re := range due {
+		run := re.NextRun
+		for n := 0; !run.After(now) && n < maxRecurringCatchUp; n++ {
+			var e Expense
+			err := scanExpense(tx.QueryRow(ctx,
+				`INSERT INTO expenses (description, amount, currency, category, date, account_id) VALUES ($1, $2, $3, $4, $5, $6)
+				 RETURNING `+expenseColumns,
+				re.Description, re.Amount, re.Currency, re.Category, run, re.AccountID), &e)
+			if err != nil {
+				return 0, fmt.Errorf("error generating recurring expense %d: %w", re.ID, err)
+			}
+			created = append(created, e)
+			run = nextRun(run, re.Interval, re.dayOfMonth)
+		}
+
+		if _, err := tx.Exec(ctx,
+			"UPDATE recurring_expenses SET next_run = $1 WHERE id = $2", run, re.ID); err != nil {
+			return 0, err
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return 0, err
+	}
+	for _, e := range created {
+		app.publishWebhookEvent(ctx, eventExpenseCreated, e)
+	}
+	app.queueBudgetAlerts(ctx, created...)
+	return len(created), nil
+}
+
+// runRecurringWorker generates due recurring expenses every interval until
+// ctx is cancelled.
+func (app *App) runRecurringWorker(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			slog.Info("Recurring expense worker stopped")
+			return
+		case <-ticker.C:
+			created, err := app.generateDueRecurring(ctx, app.now())
+			if err != nil {
+				if ctx.Err() == nil {
+					slog.Error("Error generating recurring expenses", "error", err)
+				}
+				continue
+			}
+			if created > 0 {
+				slog.Info("Generated recurring expenses", "count", created)
+			}
+		}
+	}
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNextRun(t *testing.T) {
+	base := time.Date(2024, 1, 31, 9, 0, 0, 0, time.UTC)
+
+	assert.Equal(t, time.Date(2024, 2, 1, 9, 0, 0, 0, time.UTC), nextRun(base, "daily", 31))
+	assert.Equal(t, time.Date(2024, 2, 7, 9, 0, 0, 0, time.UTC), nextRun(base, "weekly", 31))
+	assert.Equal(t, time.Date(2024, 2, 29, 9, 0, 0, 0, time.UTC), nextRun(base, "monthly", 31), "Should clamp to the end of February")
+	assert.Equal(t, time.Date(2024, 4, 15, 9, 0, 0, 0, time.UTC),
+		nextRun(time.Date(2024, 3, 15, 9, 0, 0, 0, time.UTC), "monthly", 15))
+	assert.Equal(t, time.Date(2025, 1, 10, 9, 0, 0, 0, time.UTC),
+		nextRun(time.Date(2024, 12, 10, 9, 0, 0, 0, time.UTC), "monthly", 10), "Should roll over the year")
+
+	// A clamped run doesn't move the day for the months after
+	run := base
+	var days []int
+	for range 4 {
+		run = nextRun(run, "monthly", 31)
+		days = append(days, run.Day())
+	}
+	assert.Equal(t, []int{29, 31, 30, 31}, days, "Should return to the 31st after February")
+}
+
+func TestGenerateDueRecurring(t *testing.T) {
+	app, _ := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	description := fmt.Sprintf("Gym membership %d", time.Now().UnixNano())
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	// Force an entry that came due two days ago
+	var id int
+	err := app.DBClient.QueryRow(ctx,
+		`INSERT INTO recurring_expenses (description, amount, category, interval, next_run)
+		 VALUES ($1, $2, $3, $4, $5) RETURNING id`,
+		description, Cents(1500), "Health", "daily", now.AddDate(0, 0, -2)).Scan(&id)
+	assert.NoError(t, err, "Should insert recurring expense")
+
+	created, err := app.generateDueRecurring(ctx, now)
+	assert.NoError(t, err, "Should generate due expenses")
+	assert.GreaterOrEqual(t, created, 3, "Should catch up on missed occurrences")
+
+	var count int
+	err = app.DBClient.QueryRow(ctx,
+		"SELECT COUNT(*) FROM expenses WHERE description = $1", description).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count, "Should create one expense per day up to now")
+
+	var next time.Time
+	err = app.DBClient.QueryRow(ctx, "SELECT next_run FROM recurring_expenses WHERE id = $1", id).Scan(&next)
+	assert.NoError(t, err)
+	assert.Equal(t, now.AddDate(0, 0, 1), next.UTC(), "next_run should move past now")
+
+	// Running again at the same instant creates nothing new
+	_, err = app.generateDueRecurring(ctx, now)
+	assert.NoError(t, err)
+	err = app.DBClient.QueryRow(ctx,
+		"SELECT COUNT(*) FROM expenses WHERE description = $1", description).Scan(&count)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, count, "Should not generate duplicates")
+}
+
+func TestCreateRecurringExpenseRejectsUnknownCurrency(t *testing.T) {
+	router := (&App{}).routes()
+
+	req, _ := http.NewRequest("POST", "/api/recurring-expenses", bytes.NewBufferString(`{"description": "Rent",
+		"amount": "900.00", "category": "Housing", "interval": "monthly", "next_run": "2024-07-01T09:00:00Z", "currency": "XYZ"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	assert.Contains(t, rr.Body.String(), "currency")
+}
+
+func TestGenerateDueRecurringCurrency(t *testing.T) {
+	app, _ := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	description := fmt.Sprintf("Streaming %d", time.Now().UnixNano())
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+
+	_, err := app.DBClient.Exec(ctx,
+		`INSERT INTO recurring_expenses (description, amount, currency, category, interval, next_run)
+		 VALUES ($1, $2, $3, $4, $5, $6)`,
+		description, Cents(1299), "GBP", "Entertainment", "monthly", now.Add(-time.Hour))
+	assert.NoError(t, err, "Should insert recurring expense")
+
+	_, err = app.generateDueRecurring(ctx, now)
+	assert.NoError(t, err)
+
+	var currency string
+	err = app.DBClient.QueryRow(ctx,
+		"SELECT currency FROM expenses WHERE description = $1", description).Scan(&currency)
+	assert.NoError(t, err)
+	assert.Equal(t, "GBP", currency, "Should generate expenses in the entry's currency")
+}
+
+func TestGenerateDueRecurringCatchUpCap(t *testing.T) {
+	app, _ := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	description := fmt.Sprintf("Newspaper %d", time.Now().UnixNano())
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	start := now.AddDate(0, 0, -(maxRecurringCatchUp + 20))
+
+	_, err := app.DBClient.Exec(ctx,
+		`INSERT INTO recurring_expenses (description, amount, category, interval, next_run)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		description, Cents(250), "Entertainment", "daily", start)
+	assert.NoError(t, err, "Should insert recurring expense")
+
+	count := func() int {
+		var n int
+		err := app.DBClient.QueryRow(ctx,
+			"SELECT COUNT(*) FROM expenses WHERE description = $1", description).Scan(&n)
+		assert.NoError(t, err)
+		return n
+	}
+
+	// The first pass stops at the cap and leaves the rest due
+	_, err = app.generateDueRecurring(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, maxRecurringCatchUp, count())
+
+	// The next one finishes catching up
+	_, err = app.generateDueRecurring(ctx, now)
+	assert.NoError(t, err)
+	assert.Equal(t, maxRecurringCatchUp+21, count(), "Should create one expense per day up to now")
+}
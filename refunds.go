@@ -0,0 +1,163 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+var (
+	// errRefundLimit means an expense's refunds would add up to more than
+	// the expense.
+	errRefundLimit = errors.New("refunds would exceed the refunded expense")
+
+	// errRefundedDeleted means a refund would be live while the expense it
+	// refunds is deleted.
+	errRefundedDeleted = errors.New("the refunded expense is deleted")
+)
+
+// checkRefundLimit checks, once e has been written in tx, that the live
+// refunds against e (or against the expense e refunds) still add up to no
+// more than that expense. This catches a refund raised past what was left
+// to refund and an original lowered below what has already been refunded.
+// The original is locked first, as in createRefund, so a refund committed
+// concurrently can't slip past the check.
+func checkRefundLimit(ctx context.Context, tx pgx.Tx, e Expense) error {
+	originalID := e.ID
+	if e.RefundOf != nil {
+		originalID = *e.RefundOf
+	}
+
+	var amount, refunded Cents
+	var deleted bool
+	err := tx.QueryRow(ctx,
+		"SELECT amount, deleted_at IS NOT NULL FROM expenses WHERE id=$1 FOR UPDATE", originalID).Scan(&amount, &deleted)
+	if err != nil {
+		return err
+	}
+	if deleted && e.RefundOf != nil {
+		return errRefundedDeleted
+	}
+
+	err = tx.QueryRow(ctx,
+		"SELECT COALESCE(SUM(amount), 0)::bigint FROM expenses WHERE refund_of=$1 AND deleted_at IS NULL",
+		originalID).Scan(&refunded)
+	if err != nil {
+		return err
+	}
+	if refunded > amount {
+		return fmt.Errorf("%w: %s refunded against %s", errRefundLimit, refunded, amount)
+	}
+	return nil
+}
+
+// refundRequest is the body of a refund. Only the amount is required: the
+// description defaults to one based on the original and the date to now.
+type refundRequest struct {
+	Amount      Cents     `json:"amount"`
+	Description string    `json:"description"`
+	Date        time.Time `json:"date"`
+}
+
+// createRefund records a full or partial refund against an expense. The
+// refund takes the original's category, account and currency, and all
+// refunds together may not exceed the original amount.
+func (app *App) createRefund(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var req refundRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	// Locking the original serialises refunds against it.
+	var original Expense
+	err = scanExpense(tx.QueryRow(r.Context(),
+		"SELECT "+expenseColumns+" FROM expenses WHERE id=$1 AND deleted_at IS NULL FOR UPDATE", id), &original)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "expense not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if original.RefundOf != nil {
+		writeJSONError(w, http.StatusBadRequest, "cannot refund a refund")
+		return
+	}
+	if original.Type != expenseTypeExpense {
+		writeJSONError(w, http.StatusBadRequest, "only expenses can be refunded")
+		return
+	}
+
+	refund := Expense{
+		Description: req.Description,
+		Amount:      req.Amount,
+		Category:    original.Category,
+		Date:        req.Date,
+		AccountID:   original.AccountID,
+		Currency:    original.Currency,
+		Type:        original.Type,
+		RefundOf:    &original.ID,
+	}
+	if refund.Description == "" {
+		refund.Description = "Refund: " + original.Description
+	}
+	if refund.Date.IsZero() {
+		refund.Date = app.now()
+	}
+	if errs := app.validateExpense(refund); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	// Sum the refunds in a fresh statement: the net cost read above was
+	// taken before we held the lock and may miss a refund committed since.
+	var refunded Cents
+	err = tx.QueryRow(r.Context(),
+		"SELECT COALESCE(SUM(amount), 0)::bigint FROM expenses WHERE refund_of=$1 AND deleted_at IS NULL",
+		original.ID).Scan(&refunded)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	remaining := original.Amount - refunded
+	if refund.Amount > remaining {
+		writeJSONError(w, http.StatusBadRequest,
+			fmt.Sprintf("refund of %s exceeds the %s left to refund", refund.Amount, remaining))
+		return
+	}
+
+	err = scanExpense(tx.QueryRow(r.Context(),
+		`INSERT INTO expenses (description, amount, category, date, account_id, currency, type, refund_of)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		 RETURNING `+expenseColumns,
+		refund.Description, refund.Amount, refund.Category, refund.Date, refund.AccountID, refund.Currency, refund.Type, original.ID),
+		&refund)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, refund)
+}
@@ -0,0 +1,193 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func refundRequestFor(router http.Handler, id int, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/expenses/%d/refunds", id), bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestPartialRefunds(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	id := insertTestExpense(t, app, Expense{
+		Description: "Headphones",
+		Amount:      10000,
+		Category:    "Shopping",
+		Date:        time.Now().Add(-time.Hour).Round(time.Second),
+	})
+
+	rr := refundRequestFor(router, id, `{"amount": 30.00}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should record a partial refund")
+
+	var refund Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refund))
+	if assert.NotNil(t, refund.RefundOf) {
+		assert.Equal(t, id, *refund.RefundOf)
+	}
+	assert.Equal(t, "Shopping", refund.Category, "Refund should take the original's category")
+	assert.Equal(t, "Refund: Headphones", refund.Description)
+
+	// A second refund may only cover what is left
+	rr = refundRequestFor(router, id, `{"amount": 70.01}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject refunding more than the original")
+	assert.Contains(t, rr.Body.String(), "70.00 left to refund")
+
+	rr = refundRequestFor(router, id, `{"amount": 70.00, "description": "Rest of the refund"}`)
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should allow refunding the remainder")
+
+	// The original now shows a net cost of zero
+	req, _ := http.NewRequest("GET", "/api/expenses", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	for _, e := range expenses {
+		if e.ID == id {
+			assert.Equal(t, Cents(10000), e.Amount)
+			assert.Equal(t, Cents(0), e.NetCost, "Net cost should subtract both refunds")
+		}
+	}
+}
+
+func TestRefundValidation(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	id := insertTestExpense(t, app, Expense{
+		Description: "Train ticket",
+		Amount:      4000,
+		Category:    "Transport",
+		Date:        time.Now().Round(time.Second),
+	})
+
+	rr := refundRequestFor(router, id, `{"amount": 0}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should reject a zero refund")
+
+	rr = refundRequestFor(router, 999999, `{"amount": 1}`)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Should return 404 for a missing expense")
+
+	rr = refundRequestFor(router, id, `{"amount": 10}`)
+	var refund Expense
+	json.Unmarshal(rr.Body.Bytes(), &refund)
+
+	rr = refundRequestFor(router, refund.ID, `{"amount": 1}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should not allow refunding a refund")
+}
+
+func TestSummaryNetsRefunds(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	accountID := createTestAccount(t, app)
+	var id int
+	err := app.DBClient.QueryRow(context.Background(),
+		"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5) RETURNING id",
+		"Jacket", Cents(8000), "Shopping", time.Now().Add(-time.Hour), accountID).Scan(&id)
+	assert.NoError(t, err, "Should insert test expense")
+
+	rr := refundRequestFor(router, id, fmt.Sprintf(`{"amount": 25.50, "date": %q}`, time.Now().Add(-time.Minute).Format(time.RFC3339)))
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	// Create request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/summary?account_id=%d", accountID), nil)
+	rr = httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	var summary ExpenseSummary
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &summary))
+	assert.Equal(t, []CurrencyTotal{{Currency: "USD", Total: 5450, Count: 1}}, summary.Totals,
+		"Refund should be netted off and not counted as an expense")
+}
+
+func TestRefundLimitOnUpdate(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	date := time.Now().Add(-time.Hour).Round(time.Second)
+	id := insertTestExpense(t, app, Expense{Description: "Desk lamp", Amount: 5000, Category: "Shopping", Date: date})
+
+	rr := refundRequestFor(router, id, `{"amount": 20.00}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var refund Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refund))
+
+	// A refund can't be raised past the original
+	rr = patchRequest(router, refund.ID, `{"amount": 50.01}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject raising a refund past the original")
+	rr = patchRequest(router, refund.ID, `{"amount": 50.00}`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should allow refunding the whole original")
+
+	// Nor can the original be lowered below what was refunded
+	body, _ := json.Marshal(Expense{Description: "Desk lamp", Amount: 4999, Category: "Shopping", Date: date})
+	req, _ := http.NewRequest("PUT", fmt.Sprintf("/api/expenses/%d", id), bytes.NewBuffer(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject lowering the original below its refunds")
+
+	rr = patchRequest(router, id, `{"amount": 49.99}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+	rr = patchRequest(router, id, `{"amount": 60.00}`)
+	assert.Equal(t, http.StatusOK, rr.Code, "Should allow raising the original")
+}
+
+func TestDeleteExpenseDeletesRefunds(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	id := insertTestExpense(t, app, Expense{
+		Description: "Sofa",
+		Amount:      60000,
+		Category:    "Shopping",
+		Date:        time.Now().Add(-time.Hour).Round(time.Second),
+	})
+	rr := refundRequestFor(router, id, `{"amount": 100.00}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var refund Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &refund))
+
+	send := func(method, path string) int {
+		req, _ := http.NewRequest(method, path, nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr.Code
+	}
+	deleted := func(id int) bool {
+		var deleted bool
+		err := app.DBClient.QueryRow(context.Background(),
+			"SELECT deleted_at IS NOT NULL FROM expenses WHERE id=$1", id).Scan(&deleted)
+		assert.NoError(t, err)
+		return deleted
+	}
+
+	// Deleting the original takes its refund with it
+	assert.Equal(t, http.StatusNoContent, send("DELETE", fmt.Sprintf("/api/expenses/%d", id)))
+	assert.True(t, deleted(refund.ID), "Refund should be deleted with the original")
+
+	// The refund can't come back on its own
+	assert.Equal(t, http.StatusConflict, send("POST", fmt.Sprintf("/api/expenses/%d/restore", refund.ID)))
+	assert.True(t, deleted(refund.ID))
+
+	// Restoring the original brings it back
+	assert.Equal(t, http.StatusOK, send("POST", fmt.Sprintf("/api/expenses/%d/restore", id)))
+	assert.False(t, deleted(refund.ID), "Refund should be restored with the original")
+}
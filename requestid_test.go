@@ -0,0 +1,58 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+var uuidPattern = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDMiddleware(t *testing.T) {
+	var seen string
+	handler := requestIDMiddleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = requestIDFromContext(r.Context())
+	}))
+
+	// A supplied ID is kept and echoed
+	req, _ := http.NewRequest("GET", "/api/expenses", nil)
+	req.Header.Set("X-Request-ID", "client-abc-123")
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(t, "client-abc-123", rr.Header().Get("X-Request-ID"))
+	assert.Equal(t, "client-abc-123", seen)
+
+	// Without one a UUID is generated
+	req, _ = http.NewRequest("GET", "/api/expenses", nil)
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Regexp(t, uuidPattern, rr.Header().Get("X-Request-ID"))
+	assert.Equal(t, rr.Header().Get("X-Request-ID"), seen)
+
+	// IDs that could forge log lines are replaced
+	req, _ = http.NewRequest("GET", "/api/expenses", nil)
+	req.Header.Set("X-Request-ID", "abc\" level=ERROR msg=\"forged")
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Regexp(t, uuidPattern, rr.Header().Get("X-Request-ID"))
+}
+
+func TestRequestIDLogHandler(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(requestIDLogHandler{slog.NewTextHandler(&logs, nil)})
+
+	ctx := context.WithValue(context.Background(), requestIDKey{}, "req-42")
+	logger.With("component", "test").InfoContext(ctx, "Inside a request")
+	assert.Contains(t, logs.String(), "request_id=req-42")
+	assert.Contains(t, logs.String(), "component=test")
+
+	logs.Reset()
+	logger.Info("Outside a request")
+	assert.NotContains(t, logs.String(), "request_id")
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log/slog"
+	"net/http"
+	"slices"
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+// errorResponse is the JSON envelope returned for every failed request.
+// Validation failures also list each invalid field under Errors.
+type errorResponse struct {
+	Error  errorBody    `json:"error"`
+	Errors []FieldError `json:"errors,omitempty"`
+}
+
+type errorBody struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+
+	// Index points at the offending element of an array request body.
+	Index *int `json:"index,omitempty"`
+
+	// RequestID is set on unexpected failures, so a report can be matched
+	// to the server logs.
+	RequestID string `json:"request_id,omitempty"`
+}
+
+// writeJSONError writes message as a JSON error envelope with the given
+// HTTP status.
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeErrorBody(w, errorBody{Code: status, Message: message})
+}
+
+// writeIndexedJSONError is writeJSONError for array bodies, reporting which
+// element was rejected.
+func writeIndexedJSONError(w http.ResponseWriter, status int, index int, message string) {
+	writeErrorBody(w, errorBody{Code: status, Message: message, Index: &index})
+}
+
+// writeValidationErrors rejects a body that failed validation with 422,
+// listing every invalid field.
+func writeValidationErrors(w http.ResponseWriter, errs []FieldError) {
+	writeErrorResponse(w, errorResponse{
+		Error:  errorBody{Code: http.StatusUnprocessableEntity, Message: validationMessage(errs)},
+		Errors: errs,
+	})
+}
+
+// writeIndexedValidationErrors is writeValidationErrors for array bodies.
+func writeIndexedValidationErrors(w http.ResponseWriter, index int, errs []FieldError) {
+	writeErrorResponse(w, errorResponse{
+		Error:  errorBody{Code: http.StatusUnprocessableEntity, Message: validationMessage(errs), Index: &index},
+		Errors: errs,
+	})
+}
+
+// validationMessage joins the field errors into one line for clients that
+// only read error.message.
+func validationMessage(errs []FieldError) string {
+	messages := make([]string, len(errs))
+	for i, fe := range errs {
+		messages[i] = fe.Message
+	}
+	return "invalid expense: " + strings.Join(messages, "; ")
+}
+
+func writeErrorBody(w http.ResponseWriter, body errorBody) {
+	writeErrorResponse(w, errorResponse{Error: body})
+}
+
+func writeErrorResponse(w http.ResponseWriter, resp errorResponse) {
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	writeJSON(w, resp.Error.Code, resp)
+}
+
+// writeJSON sends v as a JSON body with the given status. The status line
+// has already gone out by the time encoding could fail, so an encoding
+// error is logged rather than answered with a second, conflicting header.
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		slog.Error("Error encoding response", "error", err)
+	}
+}
+
+// notFound answers requests for paths no route serves.
+func notFound(w http.ResponseWriter, r *http.Request) {
+	writeJSONError(w, http.StatusNotFound, "no such endpoint: "+r.URL.Path)
+}
+
+// methodNotAllowed answers requests for a served path with a method it
+// doesn't take, listing the ones it does in the Allow header.
+func methodNotAllowed(router *mux.Router) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		allowed := allowedMethods(router, r)
+		w.Header().Set("Allow", strings.Join(allowed, ", "))
+		writeJSONError(w, http.StatusMethodNotAllowed,
+			fmt.Sprintf("method %s is not allowed; use %s", r.Method, strings.Join(allowed, " or ")))
+	})
+}
+
+// allowedMethods returns, sorted, the methods some route of router would
+// accept for r's path.
+func allowedMethods(router *mux.Router, r *http.Request) []string {
+	seen := map[string]bool{}
+	router.Walk(func(route *mux.Route, _ *mux.Router, _ []*mux.Route) error {
+		methods, err := route.GetMethods()
+		if err != nil {
+			return nil
+		}
+		for _, method := range methods {
+			probe := r.Clone(r.Context())
+			probe.Method = method
+			if route.Match(probe, &mux.RouteMatch{}) {
+				seen[method] = true
+			}
+		}
+		return nil
+	})
+
+	allowed := make([]string, 0, len(seen))
+	for method := range seen {
+		allowed = append(allowed, method)
+	}
+	slices.Sort(allowed)
+	return allowed
+}
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteJSON(t *testing.T) {
+	rr := httptest.NewRecorder()
+	writeJSON(rr, http.StatusCreated, Category{ID: 7, Name: "Food"})
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var got Category
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(t, Category{ID: 7, Name: "Food"}, got)
+}
+
+func TestWriteJSONEncodeError(t *testing.T) {
+	logs := captureLogs(t)
+	rr := httptest.NewRecorder()
+	writeJSON(rr, http.StatusOK, map[string]any{"bad": make(chan int)})
+
+	// The header went out before encoding failed and is not rewritten
+	assert.Equal(t, http.StatusOK, rr.Code)
+	assert.Contains(t, logs.String(), "Error encoding response")
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	router := (&App{}).routes()
+
+	req, _ := http.NewRequest("PATCH", "/api/expenses", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "GET, POST", rr.Header().Get("Allow"))
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var resp errorResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusMethodNotAllowed, resp.Error.Code)
+
+	// Routes with path variables list their own methods
+	req, _ = http.NewRequest("GET", "/api/expenses/42", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusMethodNotAllowed, rr.Code)
+	assert.Equal(t, "DELETE, PATCH, PUT", rr.Header().Get("Allow"))
+}
+
+func TestNotFound(t *testing.T) {
+	router := (&App{}).routes()
+
+	req, _ := http.NewRequest("GET", "/api/nothing-here", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+
+	var resp errorResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	assert.Equal(t, http.StatusNotFound, resp.Error.Code)
+	assert.Contains(t, resp.Error.Message, "/api/nothing-here")
+}
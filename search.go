@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// searchExpenses returns the expenses whose description or category
+// contains ?q=, ignoring case, newest first. The term is matched literally:
+// % and _ are not wildcards. The usual list filters can narrow the search.
+func (app *App) searchExpenses(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, true)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	filter.Search = strings.TrimSpace(r.URL.Query().Get("q"))
+	if filter.Search == "" {
+		writeJSONError(w, http.StatusBadRequest, "q is required")
+		return
+	}
+
+	where, args := filter.where(app.now())
+	expenses := []Expense{}
+	err = app.queryWithTimeout(r.Context(), "search expenses", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx,
+			"SELECT "+expenseColumns+" FROM expenses"+where+" ORDER BY date DESC", args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var e Expense
+			if err := scanExpense(rows, &e); err != nil {
+				return err
+			}
+			expenses = append(expenses, e)
+		}
+		return rows.Err()
+	})
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, expenses)
+}
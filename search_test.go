@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func searchRequest(router http.Handler, q string) ([]Expense, int) {
+	req, _ := http.NewRequest("GET", "/api/expenses/search?q="+url.QueryEscape(q), nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var expenses []Expense
+	json.Unmarshal(rr.Body.Bytes(), &expenses)
+	return expenses, rr.Code
+}
+
+func TestSearchExpenses(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	marker := fmt.Sprintf("zq%d", time.Now().UnixNano())
+	id := insertTestExpense(t, app, Expense{
+		Description: "Weekly GROCERIES " + marker,
+		Amount:      5410,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	})
+
+	// Matching is partial and case-insensitive
+	expenses, code := searchRequest(router, "groceries "+marker)
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, expenses, 1) {
+		assert.Equal(t, id, expenses[0].ID)
+	}
+
+	expenses, code = searchRequest(router, marker+"-nothing")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Empty(t, expenses, "Should return an empty list when nothing matches")
+
+	_, code = searchRequest(router, "  ")
+	assert.Equal(t, http.StatusBadRequest, code, "Should require a search term")
+}
+
+func TestSearchExpensesWildcards(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	marker := fmt.Sprintf("zw%d", time.Now().UnixNano())
+	insertTestExpense(t, app, Expense{
+		Description: marker + " 50% off",
+		Amount:      1000,
+		Category:    "Shopping",
+		Date:        time.Now().Round(time.Second),
+	})
+	insertTestExpense(t, app, Expense{
+		Description: marker + " 50 dollars off",
+		Amount:      5000,
+		Category:    "Shopping",
+		Date:        time.Now().Round(time.Second),
+	})
+
+	// % must match a literal percent sign, not any run of characters
+	expenses, code := searchRequest(router, marker+" 50%")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, expenses, 1) {
+		assert.Equal(t, marker+" 50% off", expenses[0].Description)
+	}
+
+	// _ must not match any single character either
+	expenses, _ = searchRequest(router, marker+" 5_")
+	assert.Empty(t, expenses)
+}
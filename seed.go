@@ -0,0 +1,96 @@
+package main
+
+import (
+	"fmt"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+const (
+	// defaultSeedExpenses is how many expenses a seed creates unless
+	// ?count= says otherwise; maxSeedExpenses caps it.
+	defaultSeedExpenses = 100
+	maxSeedExpenses     = 1000
+
+	// seedDays is how far back seeded expenses are spread.
+	seedDays = 180
+
+	// maxSeedAmount caps each seeded amount.
+	maxSeedAmount Cents = 25000
+)
+
+// seedResult reports what a seed created.
+type seedResult struct {
+	Created int `json:"created"`
+}
+
+// seedDemoData fills the default account with random expenses across every
+// category over the last seedDays, for demoing the reports. The route is
+// only registered when DEV_SEED is on; it must stay off in production.
+func (app *App) seedDemoData(w http.ResponseWriter, r *http.Request) {
+	count := defaultSeedExpenses
+	if v := r.URL.Query().Get("count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 1 || n > maxSeedExpenses {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid count: must be between 1 and %d", maxSeedExpenses))
+			return
+		}
+		count = n
+	}
+
+	rows, err := app.DBClient.Query(r.Context(), "SELECT name FROM categories ORDER BY name")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	var categories []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			rows.Close()
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		categories = append(categories, name)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if len(categories) == 0 {
+		writeJSONError(w, http.StatusConflict, "there are no categories to seed expenses in")
+		return
+	}
+
+	now := app.now()
+	batch := &pgx.Batch{}
+	for range count {
+		category := categories[rand.IntN(len(categories))]
+		date := now.Add(-time.Duration(rand.Int64N(int64(seedDays * 24 * time.Hour)))).Truncate(time.Minute)
+		batch.Queue("INSERT INTO expenses (description, amount, category, date) VALUES ($1, $2, $3, $4)",
+			"Sample "+category+" expense", 100+Cents(rand.Int64N(int64(maxSeedAmount-100))), category, date)
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	if err := tx.SendBatch(r.Context(), batch).Close(); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, seedResult{Created: count})
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSeedDisabled(t *testing.T) {
+	router := (&App{}).routes()
+
+	req, _ := http.NewRequest("POST", "/api/dev/seed", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNotFound, rr.Code, "Should not exist unless DEV_SEED is on")
+}
+
+func TestSeedDemoData(t *testing.T) {
+	app, _ := setupTestApp()
+	defer app.DBClient.Close()
+	app.DevSeed = true
+	router := app.routes()
+
+	var before, lastID int
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*), COALESCE(MAX(id), 0) FROM expenses").Scan(&before, &lastID)
+	assert.NoError(t, err)
+
+	// Keep the random rows out of the other tests' totals
+	defer app.DBClient.Exec(context.Background(), "DELETE FROM expenses WHERE id > $1 AND description LIKE 'Sample %'", lastID)
+
+	req, _ := http.NewRequest("POST", "/api/dev/seed?count=25", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var result seedResult
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	assert.Equal(t, 25, result.Created)
+
+	var after int
+	err = app.DBClient.QueryRow(context.Background(), "SELECT COUNT(*) FROM expenses").Scan(&after)
+	assert.NoError(t, err)
+	assert.Equal(t, before+25, after)
+
+	req, _ = http.NewRequest("POST", "/api/dev/seed?count=0", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
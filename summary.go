@@ -0,0 +1,217 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Limits for the top-categories leaderboard.
+const (
+	defaultTopCategories = 5
+	maxTopCategories     = 50
+)
+
+// CategoryTotal is the spending in one category over a filtered window.
+// Share is the category's percentage of all spending in the window.
+type CategoryTotal struct {
+	Category string  `json:"category"`
+	Total    Cents   `json:"total"`
+	Count    int     `json:"count"`
+	Share    float64 `json:"share"`
+}
+
+// categoryTotals sums the expenses matching filter per category, largest
+// first, with refunds netted off and left out of the count. Income is left
+// out unless the filter asks for it by type. A positive limit keeps only
+// the top entries; shares are always of the whole window, not just the
+// returned rows.
+func (app *App) categoryTotals(ctx context.Context, filter expenseFilter, now time.Time, limit int) ([]CategoryTotal, error) {
+	where, args := filter.spending().where(now)
+	query := `
+		SELECT category, SUM(` + netAmount + `)::bigint, COUNT(*) FILTER (WHERE refund_of IS NULL),
+			(SUM(SUM(` + netAmount + `)) OVER ())::bigint
+		FROM expenses` + where + `
+		GROUP BY category
+		ORDER BY 2 DESC, category`
+	if limit > 0 {
+		args = append(args, limit)
+		query += fmt.Sprintf(" LIMIT $%d", len(args))
+	}
+
+	totals := []CategoryTotal{}
+	err := app.queryWithTimeout(ctx, "category totals", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx, query, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var ct CategoryTotal
+			var grandTotal Cents
+			if err := rows.Scan(&ct.Category, &ct.Total, &ct.Count, &grandTotal); err != nil {
+				return err
+			}
+			if grandTotal > 0 {
+				ct.Share = math.Round(float64(ct.Total)/float64(grandTotal)*10000) / 100
+			}
+			totals = append(totals, ct)
+		}
+		return rows.Err()
+	})
+	return totals, err
+}
+
+// getTopCategories returns the highest-spending categories for the filtered
+// window, e.g. ?period=last_month&limit=5. Like other summaries it leaves
+// out future-dated expenses unless include_future=true.
+func (app *App) getTopCategories(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	limit := defaultTopCategories
+	if v := r.URL.Query().Get("limit"); v != "" {
+		limit, err = strconv.Atoi(v)
+		if err != nil || limit < 1 || limit > maxTopCategories {
+			writeJSONError(w, http.StatusBadRequest,
+				fmt.Sprintf("invalid limit %q: must be between 1 and %d", v, maxTopCategories))
+			return
+		}
+	}
+
+	totals, err := app.categoryTotals(r.Context(), filter, app.now(), limit)
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, totals)
+}
+
+// CurrencyTotal is the money out and in for one currency over a filtered
+// window. Total is the spending, Income what was received and Net the
+// income less the spending; Count is the number of expenses. The Converted
+// fields are the same amounts in the ?convert_to= currency, when one was
+// asked for.
+type CurrencyTotal struct {
+	Currency        string `json:"currency"`
+	Total           Cents  `json:"total"`
+	Income          Cents  `json:"income"`
+	Net             Cents  `json:"net"`
+	Count           int    `json:"count"`
+	Converted       *Cents `json:"converted,omitempty"`
+	ConvertedIncome *Cents `json:"converted_income,omitempty"`
+	ConvertedNet    *Cents `json:"converted_net,omitempty"`
+}
+
+// ExpenseSummary is the body returned by the summary endpoint. Amounts in
+// different currencies are never added together, so there is one set of
+// totals per currency. With ?convert_to= each total is also converted and
+// the Converted fields add them up in that currency.
+type ExpenseSummary struct {
+	Totals          []CurrencyTotal `json:"totals"`
+	ConvertTo       string          `json:"convert_to,omitempty"`
+	ConvertedTotal  *Cents          `json:"converted_total,omitempty"`
+	ConvertedIncome *Cents          `json:"converted_income,omitempty"`
+	ConvertedNet    *Cents          `json:"converted_net,omitempty"`
+}
+
+// currencyTotals sums the expenses and income matching filter per currency,
+// ordered by currency code. Refunds are netted off as in categoryTotals.
+func (app *App) currencyTotals(ctx context.Context, filter expenseFilter, now time.Time) ([]CurrencyTotal, error) {
+	where, args := filter.where(now)
+	totals := []CurrencyTotal{}
+	err := app.queryWithTimeout(ctx, "currency totals", func(ctx context.Context) error {
+		rows, err := app.DBClient.Query(ctx, `
+			SELECT currency,
+				COALESCE(SUM(`+netAmount+`) FILTER (WHERE type = 'expense'), 0)::bigint,
+				COALESCE(SUM(`+netAmount+`) FILTER (WHERE type = 'income'), 0)::bigint,
+				COUNT(*) FILTER (WHERE type = 'expense' AND refund_of IS NULL)
+			FROM expenses`+where+`
+			GROUP BY currency
+			ORDER BY currency`, args...)
+		if err != nil {
+			return err
+		}
+		defer rows.Close()
+
+		for rows.Next() {
+			var ct CurrencyTotal
+			if err := rows.Scan(&ct.Currency, &ct.Total, &ct.Income, &ct.Count); err != nil {
+				return err
+			}
+			ct.Net = ct.Income - ct.Total
+			totals = append(totals, ct)
+		}
+		return rows.Err()
+	})
+	return totals, err
+}
+
+// convert fills in the converted amounts using app.Rates. Converted values
+// are rounded to cents and the grand totals are summed from those.
+func (app *App) convert(ctx context.Context, summary *ExpenseSummary, to string) error {
+	var total, income Cents
+	for i := range summary.Totals {
+		ct := &summary.Totals[i]
+		rate, err := app.Rates.Rate(ctx, ct.Currency, to)
+		if err != nil {
+			return err
+		}
+		spent := Cents(math.Round(float64(ct.Total) * rate))
+		received := Cents(math.Round(float64(ct.Income) * rate))
+		net := received - spent
+		ct.Converted, ct.ConvertedIncome, ct.ConvertedNet = &spent, &received, &net
+		total += spent
+		income += received
+	}
+
+	net := income - total
+	summary.ConvertTo = to
+	summary.ConvertedTotal, summary.ConvertedIncome, summary.ConvertedNet = &total, &income, &net
+	return nil
+}
+
+// getExpenseSummary returns total spending, income and the net of the two
+// per currency for the filtered window. Future-dated expenses are left out unless include_future=true.
+// ?convert_to=EUR also reports every total in that currency; if the rates
+// can't be fetched the request fails with 502 Bad Gateway.
+func (app *App) getExpenseSummary(w http.ResponseWriter, r *http.Request) {
+	filter, err := parseExpenseFilter(r, false)
+	if err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	var convertTo string
+	if v := r.URL.Query().Get("convert_to"); v != "" {
+		convertTo = normalizeCurrency(v)
+		if !currencies[convertTo] {
+			writeJSONError(w, http.StatusBadRequest, fmt.Sprintf("invalid convert_to %q", v))
+			return
+		}
+	}
+
+	totals, err := app.currencyTotals(r.Context(), filter, app.now())
+	if err != nil {
+		writeQueryError(w, err)
+		return
+	}
+
+	summary := ExpenseSummary{Totals: totals}
+	if convertTo != "" {
+		if err := app.convert(r.Context(), &summary, convertTo); err != nil {
+			writeJSONError(w, http.StatusBadGateway, "exchange rates unavailable: "+err.Error())
+			return
+		}
+	}
+
+	writeJSON(w, http.StatusOK, summary)
+}
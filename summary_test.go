@@ -0,0 +1,256 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// createTestAccount makes a fresh account so aggregate tests only see the
+// expenses they insert.
+func createTestAccount(t *testing.T, app *App) int {
+	t.Helper()
+
+	var id int
+	err := app.DBClient.QueryRow(context.Background(),
+		"INSERT INTO accounts (name) VALUES ($1) RETURNING id",
+		fmt.Sprintf("Test account %d", time.Now().UnixNano())).Scan(&id)
+	assert.NoError(t, err, "Should create test account")
+	return id
+}
+
+func TestTopCategories(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+	lastMonth := time.Now().AddDate(0, -1, 0)
+	lastMonthDay := time.Date(lastMonth.Year(), lastMonth.Month(), 10, 12, 0, 0, 0, time.Local)
+
+	// 60 Food, 30 Transport, 10 Health last month; a big Shopping expense this month
+	for _, e := range []struct {
+		category string
+		amount   Cents
+		date     time.Time
+	}{
+		{"Food", 4000, lastMonthDay},
+		{"Food", 2000, lastMonthDay},
+		{"Transport", 3000, lastMonthDay},
+		{"Health", 1000, lastMonthDay},
+		{"Shopping", 50000, time.Now()},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id) VALUES ($1, $2, $3, $4, $5)",
+			"Leaderboard", e.amount, e.category, e.date, accountID)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	get := func(query string) ([]CategoryTotal, int) {
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/top-categories?account_id=%d&%s", accountID, query), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+
+		var totals []CategoryTotal
+		if rr.Code == http.StatusOK {
+			assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &totals))
+		}
+		return totals, rr.Code
+	}
+
+	totals, code := get("period=last_month&limit=2")
+	assert.Equal(t, http.StatusOK, code)
+	if assert.Len(t, totals, 2, "Should honour the limit") {
+		assert.Equal(t, CategoryTotal{Category: "Food", Total: 6000, Count: 2, Share: 60.00}, totals[0])
+		assert.Equal(t, CategoryTotal{Category: "Transport", Total: 3000, Count: 1, Share: 30.00}, totals[1])
+	}
+
+	// Fewer categories than the limit is fine
+	totals, code = get("period=last_month&limit=10")
+	assert.Equal(t, http.StatusOK, code)
+	assert.Len(t, totals, 3)
+
+	_, code = get("limit=0")
+	assert.Equal(t, http.StatusBadRequest, code, "Should reject a zero limit")
+}
+
+func TestCreateExpenseCurrency(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	create := func(body string) *httptest.ResponseRecorder {
+		req, _ := http.NewRequest("POST", "/api/expenses?force=true", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	// Codes are case-insensitive on the way in
+	rr := create(`{"description": "Croissant", "amount": 2.40, "category": "Food", "date": "2024-01-02T15:04:05Z", "currency": "eur"}`)
+	var created Expense
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	assert.Equal(t, "EUR", created.Currency)
+
+	// Leaving the currency out defaults to USD
+	rr = create(`{"description": "Bagel", "amount": 3.10, "category": "Food", "date": "2024-01-02T15:04:05Z"}`)
+	json.Unmarshal(rr.Body.Bytes(), &created)
+	assert.Equal(t, "USD", created.Currency)
+
+	rr = create(`{"description": "Gold", "amount": 1, "category": "Food", "date": "2024-01-02T15:04:05Z", "currency": "ABC"}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should reject an unknown currency code")
+	assert.Contains(t, rr.Body.String(), "ISO 4217")
+}
+
+func TestExpenseSummaryPerCurrency(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+	for _, e := range []struct {
+		amount   Cents
+		currency string
+	}{
+		{1000, "USD"},
+		{525, "USD"},
+		{2000, "EUR"},
+		{150000, "KES"},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id, currency) VALUES ($1, $2, $3, $4, $5, $6)",
+			"Travel", e.amount, "Transport", time.Now().Add(-time.Hour), accountID, e.currency)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/summary?account_id=%d", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var summary ExpenseSummary
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &summary))
+	assert.Equal(t, []CurrencyTotal{
+		{Currency: "EUR", Total: 2000, Net: -2000, Count: 1},
+		{Currency: "KES", Total: 150000, Net: -150000, Count: 1},
+		{Currency: "USD", Total: 1525, Net: -1525, Count: 2},
+	}, summary.Totals, "Should total each currency separately")
+}
+
+func TestExpenseSummaryIncome(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+	for _, e := range []struct {
+		amount Cents
+		kind   string
+	}{
+		{250000, "income"},
+		{10000, "income"},
+		{80000, "expense"},
+		{4550, "expense"},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id, type) VALUES ($1, $2, $3, $4, $5, $6)",
+			"Monthly", e.amount, "Housing", time.Now().Add(-time.Hour), accountID, e.kind)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	// Create request
+	req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/summary?account_id=%d", accountID), nil)
+	rr := httptest.NewRecorder()
+
+	// Serve request
+	router.ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var summary ExpenseSummary
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &summary))
+	assert.Equal(t, []CurrencyTotal{
+		{Currency: "USD", Total: 84550, Income: 260000, Net: 175450, Count: 2},
+	}, summary.Totals, "Should report income and spending separately and net them")
+
+	// Spending reports leave the income out
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/analytics/by-category?account_id=%d", accountID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var spend []CategorySpend
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &spend))
+	if assert.Len(t, spend, 1) {
+		assert.Equal(t, Cents(84550), spend[0].Total)
+	}
+}
+
+// stubRates is a RateProvider with fixed rates into a single currency,
+// keyed by the source currency. A missing source is an error.
+type stubRates map[string]float64
+
+func (s stubRates) Rate(ctx context.Context, from, to string) (float64, error) {
+	if from == to {
+		return 1, nil
+	}
+	rate, ok := s[from]
+	if !ok {
+		return 0, fmt.Errorf("no rate for %s", from)
+	}
+	return rate, nil
+}
+
+func TestExpenseSummaryConvertTo(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx := context.Background()
+	accountID := createTestAccount(t, app)
+	for _, e := range []struct {
+		amount   Cents
+		currency string
+	}{
+		{1000, "USD"},
+		{2000, "EUR"},
+	} {
+		_, err := app.DBClient.Exec(ctx,
+			"INSERT INTO expenses (description, amount, category, date, account_id, currency) VALUES ($1, $2, $3, $4, $5, $6)",
+			"Travel", e.amount, "Transport", time.Now().Add(-time.Hour), accountID, e.currency)
+		assert.NoError(t, err, "Should insert test expense")
+	}
+
+	get := func(rates RateProvider) *httptest.ResponseRecorder {
+		app.Rates = rates
+		req, _ := http.NewRequest("GET", fmt.Sprintf("/api/expenses/summary?account_id=%d&convert_to=eur", accountID), nil)
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		return rr
+	}
+
+	rr := get(stubRates{"USD": 0.9})
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var summary ExpenseSummary
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &summary))
+	assert.Equal(t, "EUR", summary.ConvertTo)
+	if assert.NotNil(t, summary.ConvertedTotal) {
+		assert.Equal(t, Cents(2900), *summary.ConvertedTotal, "Should add 20 EUR to 10 USD at 0.9")
+	}
+	if assert.Len(t, summary.Totals, 2) && assert.NotNil(t, summary.Totals[1].Converted) {
+		assert.Equal(t, "USD", summary.Totals[1].Currency)
+		assert.Equal(t, Cents(900), *summary.Totals[1].Converted)
+	}
+
+	// A provider failure is surfaced rather than hidden
+	rr = get(stubRates{})
+	assert.Equal(t, http.StatusBadGateway, rr.Code, "Should return 502 when rates are unavailable")
+}
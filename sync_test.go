@@ -0,0 +1,81 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func syncRequest(t *testing.T, router http.Handler, since time.Time) syncResponse {
+	t.Helper()
+	target := "/api/expenses/sync"
+	if !since.IsZero() {
+		target += "?since=" + url.QueryEscape(since.Format(time.RFC3339Nano))
+	}
+	req, _ := http.NewRequest("GET", target, nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var resp syncResponse
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &resp))
+	return resp
+}
+
+func expenseIDs(expenses []Expense) []int {
+	ids := []int{}
+	for _, e := range expenses {
+		ids = append(ids, e.ID)
+	}
+	return ids
+}
+
+func TestSyncExpenses(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	date := time.Now().Add(-time.Hour).Round(time.Second)
+	edited := insertTestExpense(t, app, Expense{Description: "Will change", Amount: 1000, Category: "Food", Date: date})
+	removed := insertTestExpense(t, app, Expense{Description: "Will go", Amount: 1000, Category: "Food", Date: date})
+
+	// First sync: everything live, nothing deleted
+	first := syncRequest(t, router, time.Time{})
+	assert.Contains(t, expenseIDs(first.Changed), edited)
+	assert.Contains(t, expenseIDs(first.Changed), removed)
+	assert.Empty(t, first.Deleted)
+	assert.False(t, first.Cursor.IsZero())
+
+	// A create, an update and a delete
+	created := insertTestExpense(t, app, Expense{Description: "New", Amount: 500, Category: "Food", Date: date})
+	rr := patchRequest(router, edited, `{"description": "Changed"}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	req, _ := http.NewRequest("DELETE", fmt.Sprintf("/api/expenses/%d", removed), nil)
+	router.ServeHTTP(httptest.NewRecorder(), req)
+
+	next := syncRequest(t, router, first.Cursor)
+	changed := expenseIDs(next.Changed)
+	assert.Contains(t, changed, created)
+	assert.Contains(t, changed, edited)
+	assert.NotContains(t, changed, removed, "Deleted expenses are only listed by id")
+	assert.Contains(t, next.Deleted, removed)
+	for _, e := range next.Changed {
+		if e.ID == edited {
+			assert.Equal(t, "Changed", e.Description)
+		}
+	}
+}
+
+func TestSyncExpensesInvalidSince(t *testing.T) {
+	router := (&App{}).routes()
+
+	req, _ := http.NewRequest("GET", "/api/expenses/sync?since=yesterday", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+}
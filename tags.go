@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// maxTagLength caps the length of a single tag name.
+const maxTagLength = 50
+
+// normalizeTags trims tag names and drops repeats, comparing without case
+// and keeping the first spelling seen.
+func normalizeTags(names []string) []string {
+	seen := map[string]bool{}
+	out := []string{}
+	for _, name := range names {
+		name = strings.TrimSpace(name)
+		key := strings.ToLower(name)
+		if seen[key] {
+			continue
+		}
+		seen[key] = true
+		out = append(out, name)
+	}
+	return out
+}
+
+// setExpenseTags replaces the tags on an expense with names, creating any
+// tag that doesn't exist yet, and returns the tags as stored. An existing
+// tag keeps its original spelling.
+func setExpenseTags(ctx context.Context, tx pgx.Tx, expenseID int, names []string) ([]string, error) {
+	names = normalizeTags(names)
+
+	if _, err := tx.Exec(ctx, "DELETE FROM expense_tags WHERE expense_id = $1", expenseID); err != nil {
+		return nil, err
+	}
+
+	if len(names) > 0 {
+		if _, err := tx.Exec(ctx,
+			"INSERT INTO tags (name) SELECT unnest($1::text[]) ON CONFLICT (lower(name)) DO NOTHING",
+			names); err != nil {
+			return nil, err
+		}
+
+		lowered := make([]string, len(names))
+		for i, name := range names {
+			lowered[i] = strings.ToLower(name)
+		}
+		if _, err := tx.Exec(ctx,
+			"INSERT INTO expense_tags (expense_id, tag_id) SELECT $1, id FROM tags WHERE lower(name) = ANY($2)",
+			expenseID, lowered); err != nil {
+			return nil, err
+		}
+	}
+
+	var stored []string
+	err := tx.QueryRow(ctx, `
+		SELECT COALESCE(array_agg(t.name ORDER BY lower(t.name)), '{}')
+		FROM expense_tags et JOIN tags t ON t.id = et.tag_id
+		WHERE et.expense_id = $1`, expenseID).Scan(&stored)
+	return stored, err
+}
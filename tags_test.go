@@ -0,0 +1,74 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormalizeTags(t *testing.T) {
+	assert.Equal(t, []string{"Vacation", "reimbursable"}, normalizeTags([]string{" Vacation", "reimbursable", "vacation "}))
+	assert.Equal(t, []string{}, normalizeTags(nil))
+}
+
+func TestExpenseTags(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	tag := fmt.Sprintf("trip-%d", time.Now().UnixNano())
+
+	// Attach tags on create; repeats are dropped
+	body := fmt.Sprintf(`{"description": "Hotel", "amount": 120.00, "category": "Housing",
+		"date": "2024-07-01T12:00:00Z", "tags": [%q, "Reimbursable", %q]}`, tag, tag)
+	req, _ := http.NewRequest("POST", "/api/expenses?force=true", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var created Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+	assert.ElementsMatch(t, []string{tag, "Reimbursable"}, created.Tags)
+
+	// An untagged expense should not show up when filtering
+	insertTestExpense(t, app, Expense{
+		Description: "Untagged",
+		Amount:      500,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	})
+
+	req, _ = http.NewRequest("GET", "/api/expenses?tag="+url.QueryEscape(tag), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var expenses []Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	if assert.Len(t, expenses, 1, "Should return only the tagged expense") {
+		assert.Equal(t, created.ID, expenses[0].ID)
+	}
+
+	// PATCH replaces the tag set
+	rr = patchRequest(router, created.ID, `{"tags": ["reimbursable"]}`)
+	assert.Equal(t, http.StatusOK, rr.Code)
+	var patched Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &patched))
+	assert.Equal(t, []string{"Reimbursable"}, patched.Tags, "Should keep the stored spelling")
+
+	req, _ = http.NewRequest("GET", "/api/expenses?tag="+url.QueryEscape(tag), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expenses))
+	assert.Empty(t, expenses, "Removed tag should no longer match")
+}
+
+func TestExpenseTagsValidation(t *testing.T) {
+	e := Expense{Description: "Coffee", Amount: 350, Category: "Food", Date: time.Now(), Tags: []string{" "}}
+	assert.Equal(t, []FieldError{{"tags", "tags must be between 1 and 50 characters"}}, e.Validate())
+}
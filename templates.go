@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jackc/pgx/v5"
+)
+
+// Template is a reusable partial expense for something bought often.
+// Expenses made from it copy these fields and are dated when created.
+type Template struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	Amount      Cents  `json:"amount"`
+	Currency    string `json:"currency"`
+	Category    string `json:"category"`
+}
+
+// Validate checks the template against the rules for the expenses it makes.
+func (t Template) Validate() []FieldError {
+	// The date is only set when the template is used, so any will do.
+	e := Expense{Description: t.Description, Amount: t.Amount, Category: t.Category, Currency: t.Currency, Date: time.Unix(0, 0)}
+	return e.Validate()
+}
+
+func (app *App) getTemplates(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DBClient.Query(r.Context(),
+		"SELECT id, description, amount, currency, category FROM templates ORDER BY lower(description), id")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	templates := []Template{}
+	for rows.Next() {
+		var t Template
+		if err := rows.Scan(&t.ID, &t.Description, &t.Amount, &t.Currency, &t.Category); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		templates = append(templates, t)
+	}
+
+	writeJSON(w, http.StatusOK, templates)
+}
+
+func (app *App) createTemplate(w http.ResponseWriter, r *http.Request) {
+	var t Template
+	if err := json.NewDecoder(r.Body).Decode(&t); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	t.Currency = normalizeCurrency(t.Currency)
+
+	if errs := t.Validate(); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	category, err := app.resolveCategory(r.Context(), t.Category)
+	if errors.Is(err, errUnknownCategory) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	t.Category = category
+	if t.Currency == "" {
+		t.Currency = defaultCurrency
+	}
+
+	err = app.DBClient.QueryRow(r.Context(),
+		"INSERT INTO templates (description, amount, currency, category) VALUES ($1, $2, $3, $4) RETURNING id",
+		t.Description, t.Amount, t.Currency, t.Category).Scan(&t.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, t)
+}
+
+func (app *App) deleteTemplate(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	tag, err := app.DBClient.Exec(r.Context(), "DELETE FROM templates WHERE id=$1", id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		writeJSONError(w, http.StatusNotFound, "template not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// createExpenseFromTemplate creates an expense from a template, dated now.
+// The body is optional; any expense fields it has override the template's,
+// so the usual price can be corrected or an older purchase backdated.
+func (app *App) createExpenseFromTemplate(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var t Template
+	err := app.DBClient.QueryRow(r.Context(),
+		"SELECT id, description, amount, currency, category FROM templates WHERE id=$1", id).
+		Scan(&t.ID, &t.Description, &t.Amount, &t.Currency, &t.Category)
+	if errors.Is(err, pgx.ErrNoRows) {
+		writeJSONError(w, http.StatusNotFound, "template not found")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	expense := Expense{Description: t.Description, Amount: t.Amount, Category: t.Category, Currency: t.Currency, Date: app.now()}
+	if r.ContentLength != 0 {
+		if err := decodeStrict(r, &expense); err != nil {
+			writeDecodeError(w, err)
+			return
+		}
+	}
+	expense.Currency = normalizeCurrency(expense.Currency)
+
+	if errs := app.validateExpense(expense); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	// The category may have been renamed or overridden since the template
+	// was saved.
+	category, err := app.resolveCategory(r.Context(), expense.Category)
+	if errors.Is(err, errUnknownCategory) {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	expense.Category = category
+
+	if expense.Currency == "" {
+		expense.Currency = defaultCurrency
+	}
+	if expense.Type == "" {
+		expense.Type = expenseTypeExpense
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	tags := expense.Tags
+	err = scanExpense(tx.QueryRow(r.Context(),
+		`INSERT INTO expenses (description, amount, category, date, account_id, currency, type, notes)
+		 VALUES ($1, $2, $3, $4, COALESCE(NULLIF($5, 0), default_account_id()), $6, $7, NULLIF($8, ''))
+		 RETURNING `+expenseColumns,
+		expense.Description, expense.Amount, expense.Category, expense.Date, expense.AccountID, expense.Currency, expense.Type, expense.Notes),
+		&expense)
+	if isPgError(err, pgForeignKeyViolation) {
+		writeJSONError(w, http.StatusBadRequest, "account does not exist")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if expense.Tags, err = setExpenseTags(r.Context(), tx, expense.ID, tags); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	app.publishWebhookEvent(r.Context(), eventExpenseCreated, expense)
+	app.queueBudgetAlerts(r.Context(), expense)
+
+	writeJSON(w, http.StatusCreated, expense)
+}
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func fromTemplate(router http.Handler, id int, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", fmt.Sprintf("/api/expenses/from-template/%d", id), bytes.NewBufferString(body))
+	if body != "" {
+		req.Header.Set("Content-Type", "application/json")
+	}
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestExpenseFromTemplate(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	now := time.Date(2024, 5, 20, 8, 30, 0, 0, time.UTC)
+	app.Clock = fixedClock(now)
+
+	// Create the template
+	req, _ := http.NewRequest("POST", "/api/templates",
+		bytes.NewBufferString(`{"description": "Flat white", "amount": "3.80", "category": "food"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var tmpl Template
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tmpl))
+	assert.NotZero(t, tmpl.ID)
+	assert.Equal(t, "Food", tmpl.Category, "Should store the canonical category")
+
+	// Without a body the expense copies the template and is dated now
+	rr = fromTemplate(router, tmpl.ID, "")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var expense Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expense))
+	assert.Equal(t, "Flat white", expense.Description)
+	assert.Equal(t, Cents(380), expense.Amount)
+	assert.Equal(t, "Food", expense.Category)
+	assert.True(t, now.Equal(expense.Date), "Should be dated now")
+	assert.Equal(t, defaultCurrency, expense.Currency)
+
+	// Fields in the body override the template's
+	rr = fromTemplate(router, tmpl.ID, `{"amount": "4.20", "tags": ["oat milk"]}`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var overridden Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &overridden))
+	assert.Equal(t, "Flat white", overridden.Description)
+	assert.Equal(t, Cents(420), overridden.Amount)
+	assert.Equal(t, []string{"oat milk"}, overridden.Tags)
+	assert.NotEqual(t, expense.ID, overridden.ID)
+
+	// Overrides are validated like any new expense
+	rr = fromTemplate(router, tmpl.ID, `{"amount": 0}`)
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code)
+	rr = fromTemplate(router, tmpl.ID, `{"ammount": "4.20"}`)
+	assert.Equal(t, http.StatusBadRequest, rr.Code)
+
+	// Deleted templates can no longer be used
+	req, _ = http.NewRequest("DELETE", fmt.Sprintf("/api/templates/%d", tmpl.ID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusNoContent, rr.Code)
+
+	rr = fromTemplate(router, tmpl.ID, "")
+	assert.Equal(t, http.StatusNotFound, rr.Code)
+}
+
+func TestTemplateValidate(t *testing.T) {
+	assert.Empty(t, Template{Description: "Bus fare", Amount: 250, Category: "Transport"}.Validate())
+
+	errs := Template{Amount: -1}.Validate()
+	assert.ElementsMatch(t, []string{"description", "amount", "category"}, fieldNames(errs))
+
+	errs = Template{Description: "Bus fare", Amount: 250, Category: "Transport", Currency: "XYZ"}.Validate()
+	assert.Equal(t, []string{"currency"}, fieldNames(errs))
+}
+
+func TestExpenseFromTemplateCurrency(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	req, _ := http.NewRequest("POST", "/api/templates",
+		bytes.NewBufferString(`{"description": "Metro ticket", "amount": "2.15", "category": "Transport", "currency": "eur"}`))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var tmpl Template
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &tmpl))
+	assert.Equal(t, "EUR", tmpl.Currency)
+	defer app.DBClient.Exec(context.Background(), "DELETE FROM templates WHERE id=$1", tmpl.ID)
+
+	rr = fromTemplate(router, tmpl.ID, "")
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var expense Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &expense))
+	assert.Equal(t, "EUR", expense.Currency, "Should take the template's currency")
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// timeoutWriter lets a handler running in its own goroutine write the
+// response until the deadline passes, and discards everything after. The
+// handler gets its own header map so it never races the timeout response.
+type timeoutWriter struct {
+	w   http.ResponseWriter
+	h   http.Header
+	ctx context.Context
+
+	mu          sync.Mutex
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header { return tw.h }
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	tw.writeHeaderLocked(code)
+}
+
+// expiredLocked reports whether the deadline has passed, even if the
+// middleware hasn't noticed yet: a handler woken by the same cancellation
+// must not win the race to write.
+func (tw *timeoutWriter) expiredLocked() bool {
+	return tw.timedOut || tw.ctx.Err() != nil
+}
+
+func (tw *timeoutWriter) writeHeaderLocked(code int) {
+	if tw.expiredLocked() || tw.wroteHeader {
+		return
+	}
+	dst := tw.w.Header()
+	for k, v := range tw.h {
+		dst[k] = v
+	}
+	tw.w.WriteHeader(code)
+	tw.wroteHeader = true
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expiredLocked() {
+		return 0, http.ErrHandlerTimeout
+	}
+	tw.writeHeaderLocked(http.StatusOK)
+	return tw.w.Write(b)
+}
+
+// Flush passes through to the underlying writer so streamed responses still
+// reach the client before the handler returns.
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.expiredLocked() {
+		return
+	}
+	http.NewResponseController(tw.w).Flush()
+}
+
+// timeoutMiddleware gives every request a deadline d from now. The request
+// context is cancelled when it passes, which aborts any database query in
+// flight, and if nothing has been written yet the client gets 503 Service
+// Unavailable. Once a response has started it can only be cut short.
+func timeoutMiddleware(d time.Duration) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			ctx, cancel := context.WithTimeout(r.Context(), d)
+			defer cancel()
+
+			tw := &timeoutWriter{w: w, h: http.Header{}, ctx: ctx}
+			done := make(chan struct{})
+			panicked := make(chan any, 1)
+			go func() {
+				defer func() {
+					if p := recover(); p != nil {
+						panicked <- p
+					}
+				}()
+				next.ServeHTTP(tw, r.WithContext(ctx))
+				close(done)
+			}()
+
+			select {
+			case <-done:
+			case p := <-panicked:
+				// Re-raise on the server's goroutine so net/http handles it.
+				panic(p)
+			case <-ctx.Done():
+			}
+
+			// The handler may have returned, or still be running, after
+			// its writes were refused; either way the client is owed a 503.
+			tw.mu.Lock()
+			defer tw.mu.Unlock()
+			if !tw.wroteHeader && errors.Is(ctx.Err(), context.DeadlineExceeded) {
+				writeJSONError(w, http.StatusServiceUnavailable, "request timed out")
+			}
+			tw.timedOut = true
+		})
+	}
+}
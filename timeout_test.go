@@ -0,0 +1,53 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTimeoutMiddlewareFires(t *testing.T) {
+	cancelled := make(chan struct{})
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Stands in for a stuck query that honours its context
+		select {
+		case <-r.Context().Done():
+			close(cancelled)
+		case <-time.After(5 * time.Second):
+		}
+		w.Write([]byte("too late"))
+	})
+
+	req, _ := http.NewRequest("GET", "/api/expenses", nil)
+	rr := httptest.NewRecorder()
+	timeoutMiddleware(20*time.Millisecond)(slow).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusServiceUnavailable, rr.Code, "Should return 503 when the deadline passes")
+	assert.Contains(t, rr.Body.String(), "request timed out")
+
+	select {
+	case <-cancelled:
+	case <-time.After(time.Second):
+		t.Fatal("Handler context was not cancelled")
+	}
+	assert.NotContains(t, rr.Body.String(), "too late", "Late writes should be discarded")
+}
+
+func TestTimeoutMiddlewarePassesFastResponses(t *testing.T) {
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(`{"id":1}`))
+	})
+
+	req, _ := http.NewRequest("POST", "/api/expenses", nil)
+	rr := httptest.NewRecorder()
+	timeoutMiddleware(time.Second)(fast).ServeHTTP(rr, req)
+
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	assert.Equal(t, "application/json", rr.Header().Get("Content-Type"))
+	assert.Equal(t, `{"id":1}`, rr.Body.String())
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// transferRequest is the body of a transfer. Only the accounts and amount
+// are required; the currency defaults to USD and the date to now.
+type transferRequest struct {
+	FromAccountID int       `json:"from_account_id"`
+	ToAccountID   int       `json:"to_account_id"`
+	Amount        Cents     `json:"amount"`
+	Currency      string    `json:"currency"`
+	Description   string    `json:"description"`
+	Date          time.Time `json:"date"`
+}
+
+// Validate checks the request and returns every field that failed, like
+// Expense.Validate.
+func (t transferRequest) Validate() []FieldError {
+	var errs []FieldError
+
+	if t.FromAccountID <= 0 {
+		errs = append(errs, FieldError{"from_account_id", "from_account_id is required"})
+	}
+	if t.ToAccountID <= 0 {
+		errs = append(errs, FieldError{"to_account_id", "to_account_id is required"})
+	}
+	if t.FromAccountID > 0 && t.FromAccountID == t.ToAccountID {
+		errs = append(errs, FieldError{"to_account_id", "from_account_id and to_account_id must differ"})
+	}
+
+	switch {
+	case t.Amount <= 0:
+		errs = append(errs, FieldError{"amount", "amount must be greater than zero"})
+	case t.Amount > maxAmountCents:
+		errs = append(errs, FieldError{"amount", fmt.Sprintf("amount must not exceed %s", maxAmountCents)})
+	}
+
+	if t.Currency != "" && !currencies[t.Currency] {
+		errs = append(errs, FieldError{"currency", fmt.Sprintf("currency %q is not a supported ISO 4217 code", t.Currency)})
+	}
+
+	return errs
+}
+
+// TransferLeg is one side of a transfer. Amount is negative on the account
+// the money left and positive on the account it went to.
+type TransferLeg struct {
+	ID        int   `json:"id"`
+	AccountID int   `json:"account_id"`
+	Amount    Cents `json:"amount"`
+}
+
+// Transfer is money moved between two of the user's accounts.
+type Transfer struct {
+	ID          int           `json:"id"`
+	Description string        `json:"description"`
+	Currency    string        `json:"currency"`
+	Date        time.Time     `json:"date"`
+	Legs        []TransferLeg `json:"legs"`
+}
+
+// insertTransferLeg records one leg of transfer t inside tx.
+func insertTransferLeg(ctx context.Context, tx pgx.Tx, t *Transfer, accountID int, amount Cents) error {
+	leg := TransferLeg{AccountID: accountID, Amount: amount}
+	err := tx.QueryRow(ctx,
+		"INSERT INTO transfer_legs (transfer_id, account_id, amount) VALUES ($1, $2, $3) RETURNING id",
+		t.ID, accountID, amount).Scan(&leg.ID)
+	if err != nil {
+		return err
+	}
+	t.Legs = append(t.Legs, leg)
+	return nil
+}
+
+// createTransfer moves money from one account to another. The debit and the
+// credit are written in one transaction, so either both legs are recorded
+// or neither is.
+func (app *App) createTransfer(w http.ResponseWriter, r *http.Request) {
+	var req transferRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+	req.Currency = normalizeCurrency(req.Currency)
+
+	if errs := req.Validate(); len(errs) > 0 {
+		writeValidationErrors(w, errs)
+		return
+	}
+
+	transfer := Transfer{
+		Description: strings.TrimSpace(req.Description),
+		Currency:    req.Currency,
+		Date:        req.Date,
+	}
+	if transfer.Description == "" {
+		transfer.Description = "Transfer"
+	}
+	if transfer.Currency == "" {
+		transfer.Currency = defaultCurrency
+	}
+	if transfer.Date.IsZero() {
+		transfer.Date = app.now()
+	}
+
+	tx, err := app.DBClient.Begin(r.Context())
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer tx.Rollback(r.Context())
+
+	err = tx.QueryRow(r.Context(),
+		"INSERT INTO transfers (description, currency, date) VALUES ($1, $2, $3) RETURNING id",
+		transfer.Description, transfer.Currency, transfer.Date).Scan(&transfer.ID)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	// Debit first, then credit. A failure on either leg rolls back both.
+	err = insertTransferLeg(r.Context(), tx, &transfer, req.FromAccountID, -req.Amount)
+	if err == nil {
+		err = insertTransferLeg(r.Context(), tx, &transfer, req.ToAccountID, req.Amount)
+	}
+	if isPgError(err, pgForeignKeyViolation) {
+		writeJSONError(w, http.StatusBadRequest, "account does not exist")
+		return
+	}
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	if err := tx.Commit(r.Context()); err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, transfer)
+}
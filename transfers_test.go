@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func transferRequestTo(router http.Handler, body string) *httptest.ResponseRecorder {
+	req, _ := http.NewRequest("POST", "/api/transfers", bytes.NewBufferString(body))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	return rr
+}
+
+func TestCreateTransfer(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	from := createTestAccount(t, app)
+	to := createTestAccount(t, app)
+
+	rr := transferRequestTo(router, fmt.Sprintf(
+		`{"from_account_id": %d, "to_account_id": %d, "amount": 150.25}`, from, to))
+	assert.Equal(t, http.StatusCreated, rr.Code, "Should return 201 Created")
+
+	var transfer Transfer
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &transfer))
+	assert.NotZero(t, transfer.ID)
+	assert.Equal(t, "USD", transfer.Currency)
+	if assert.Len(t, transfer.Legs, 2, "Should return the debit and the credit") {
+		assert.Equal(t, TransferLeg{ID: transfer.Legs[0].ID, AccountID: from, Amount: -15025}, transfer.Legs[0])
+		assert.Equal(t, TransferLeg{ID: transfer.Legs[1].ID, AccountID: to, Amount: 15025}, transfer.Legs[1])
+	}
+
+	// Both legs were committed
+	var legs int
+	var sum float64
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*), SUM(amount) FROM transfer_legs WHERE transfer_id=$1", transfer.ID).Scan(&legs, &sum)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, legs)
+	assert.Zero(t, sum, "Legs should cancel out")
+
+	// Moving money to the same account is rejected
+	rr = transferRequestTo(router, fmt.Sprintf(
+		`{"from_account_id": %d, "to_account_id": %d, "amount": 5}`, from, from))
+	assert.Equal(t, http.StatusUnprocessableEntity, rr.Code, "Should reject a transfer to the same account")
+}
+
+func TestCreateTransferRollsBack(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	from := createTestAccount(t, app)
+	description := fmt.Sprintf("Doomed transfer %d", time.Now().UnixNano())
+
+	// The debit is written before the missing destination fails the credit
+	rr := transferRequestTo(router, fmt.Sprintf(
+		`{"from_account_id": %d, "to_account_id": 999999, "amount": 20, "description": %q}`, from, description))
+	assert.Equal(t, http.StatusBadRequest, rr.Code, "Should reject an unknown account")
+
+	// Neither the transfer nor its debit survived
+	var transfers, legs int
+	err := app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM transfers WHERE description=$1", description).Scan(&transfers)
+	assert.NoError(t, err)
+	assert.Zero(t, transfers)
+
+	err = app.DBClient.QueryRow(context.Background(),
+		"SELECT COUNT(*) FROM transfer_legs WHERE account_id=$1", from).Scan(&legs)
+	assert.NoError(t, err)
+	assert.Zero(t, legs, "Should roll back the debit")
+}
+
+func TestTransferRequestValidate(t *testing.T) {
+	assert.Empty(t, transferRequest{FromAccountID: 1, ToAccountID: 2, Amount: 500}.Validate())
+
+	errs := transferRequest{FromAccountID: 3, ToAccountID: 3, Currency: "XYZ"}.Validate()
+	assert.ElementsMatch(t, []string{"to_account_id", "amount", "currency"}, fieldNames(errs))
+
+	errs = transferRequest{Amount: maxAmountCents + 1}.Validate()
+	assert.ElementsMatch(t, []string{"from_account_id", "to_account_id", "amount"}, fieldNames(errs))
+}
@@ -0,0 +1,24 @@
+package main
+
+import "net/http"
+
+// Build information, set at link time with e.g.
+//
+//	go build -ldflags "-X main.version=1.4.0 -X main.commit=$(git rev-parse --short HEAD) -X main.buildTime=$(date -u +%Y-%m-%dT%H:%M:%SZ)"
+var (
+	version   = "dev"
+	commit    = "unknown"
+	buildTime = "unknown"
+)
+
+// BuildInfo identifies the running build.
+type BuildInfo struct {
+	Version   string `json:"version"`
+	Commit    string `json:"commit"`
+	BuildTime string `json:"build_time"`
+}
+
+// getVersion reports which build is deployed.
+func getVersion(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, BuildInfo{Version: version, Commit: commit, BuildTime: buildTime})
+}
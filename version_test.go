@@ -0,0 +1,32 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestGetVersion(t *testing.T) {
+	router := (&App{}).routes()
+
+	req, _ := http.NewRequest("GET", "/version", nil)
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var info BuildInfo
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+	assert.Equal(t, BuildInfo{Version: "dev", Commit: "unknown", BuildTime: "unknown"}, info, "Should fall back when not injected")
+
+	// Values injected at link time are reported as they are
+	defer func(v, c, b string) { version, commit, buildTime = v, c, b }(version, commit, buildTime)
+	version, commit, buildTime = "1.4.0", "abc1234", "2024-06-01T12:00:00Z"
+
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &info))
+	assert.Equal(t, BuildInfo{Version: "1.4.0", Commit: "abc1234", BuildTime: "2024-06-01T12:00:00Z"}, info)
+}
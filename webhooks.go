@@ -0,0 +1,430 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/netip"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+// Webhook delivery settings. Deliveries that still fail after
+// webhookAttempts tries are dropped; the delivery log keeps the errors.
+const (
+	webhookQueueSize  = 100
+	webhookWorkers    = 2
+	webhookAttempts   = 3
+	webhookRetryDelay = time.Second
+	webhookTimeout    = 10 * time.Second
+)
+
+// Headers sent with every webhook delivery.
+const (
+	webhookEventHeader     = "X-Webhook-Event"
+	webhookSignatureHeader = "X-Webhook-Signature"
+)
+
+// eventExpenseCreated is sent after an expense is created.
+const eventExpenseCreated = "expense.created"
+
+// Webhook is a URL notified of expense events. The secret signs each
+// payload; it is only returned when the webhook is created.
+type Webhook struct {
+	ID        int       `json:"id"`
+	URL       string    `json:"url"`
+	Secret    string    `json:"secret,omitempty"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// WebhookDelivery is one logged attempt to deliver an event. StatusCode is
+// null when the endpoint could not be reached.
+type WebhookDelivery struct {
+	ID         int       `json:"id"`
+	WebhookID  int       `json:"webhook_id"`
+	Event      string    `json:"event"`
+	Attempt    int       `json:"attempt"`
+	StatusCode *int      `json:"status_code"`
+	Error      *string   `json:"error"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// webhookEvent is the JSON body POSTed to webhook URLs.
+type webhookEvent struct {
+	Event     string    `json:"event"`
+	CreatedAt time.Time `json:"created_at"`
+	Data      any       `json:"data"`
+}
+
+// webhookJob is one event on its way to one webhook.
+type webhookJob struct {
+	webhook Webhook
+	event   string
+	payload []byte
+}
+
+// WebhookDispatcher delivers events from a bounded queue on background
+// workers, so a slow endpoint never holds up a request. When the queue is
+// full new events are dropped rather than blocking the caller.
+type WebhookDispatcher struct {
+	queue      chan webhookJob
+	client     *http.Client
+	attempts   int
+	retryDelay time.Duration
+
+	// record, if set, is called after every delivery attempt. status is
+	// zero when no response was received.
+	record func(ctx context.Context, job webhookJob, attempt, status int, err error)
+}
+
+// NewWebhookDispatcher returns a dispatcher holding up to queueSize
+// pending deliveries. Call Run to start delivering them.
+func NewWebhookDispatcher(queueSize int) *WebhookDispatcher {
+	return &WebhookDispatcher{
+		queue:      make(chan webhookJob, queueSize),
+		client:     newWebhookClient(refuseNonPublicAddress),
+		attempts:   webhookAttempts,
+		retryDelay: webhookRetryDelay,
+	}
+}
+
+// errWebhookAddress is returned when a webhook URL resolves to an address
+// deliveries must not reach.
+var errWebhookAddress = errors.New("webhook address is not public")
+
+// nonPublicPrefixes are ranges outside the checks netip.Addr offers that a
+// webhook must not reach either: "this network" and carrier-grade NAT,
+// where some clouds serve instance metadata.
+var nonPublicPrefixes = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+}
+
+// newWebhookClient returns the client deliveries go through. control runs
+// on every connection after DNS resolution, so it sees the address actually
+// dialled; nil allows any. Proxies are not used, since they would hide that
+// address, and redirects are not followed: the 3xx is the delivery result.
+func newWebhookClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: webhookTimeout, Control: control}
+	transport := http.DefaultTransport.(*http.Transport).Clone()
+	transport.Proxy = nil
+	transport.DialContext = dialer.DialContext
+
+	return &http.Client{
+		Timeout:   webhookTimeout,
+		Transport: transport,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
+
+// refuseNonPublicAddress is a net.Dialer Control hook that refuses loopback,
+// private, link-local, multicast and unspecified addresses, so a webhook
+// cannot be used to probe hosts behind the server. Checking at dial time
+// rather than at registration also covers DNS that later changes.
+func refuseNonPublicAddress(network, address string, c syscall.RawConn) error {
+	addrPort, err := netip.ParseAddrPort(address)
+	if err != nil {
+		return fmt.Errorf("%w: %s", errWebhookAddress, address)
+	}
+	addr := addrPort.Addr().Unmap()
+	if addr.IsLoopback() || addr.IsPrivate() || addr.IsLinkLocalUnicast() ||
+		addr.IsLinkLocalMulticast() || addr.IsInterfaceLocalMulticast() ||
+		addr.IsMulticast() || addr.IsUnspecified() {
+		return fmt.Errorf("%w: %s", errWebhookAddress, addr)
+	}
+	for _, prefix := range nonPublicPrefixes {
+		if prefix.Contains(addr) {
+			return fmt.Errorf("%w: %s", errWebhookAddress, addr)
+		}
+	}
+	return nil
+}
+
+// Enqueue schedules a delivery and reports whether there was room for it.
+func (d *WebhookDispatcher) Enqueue(job webhookJob) bool {
+	select {
+	case d.queue <- job:
+		return true
+	default:
+		slog.Warn("Webhook queue full, dropping event", "webhook_id", job.webhook.ID, "event", job.event)
+		return false
+	}
+}
+
+// Run delivers queued events on the given number of workers until ctx is
+// cancelled.
+func (d *WebhookDispatcher) Run(ctx context.Context, workers int) {
+	done := make(chan struct{})
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer func() { done <- struct{}{} }()
+			for {
+				select {
+				case <-ctx.Done():
+					return
+				case job := <-d.queue:
+					d.deliver(ctx, job)
+				}
+			}
+		}()
+	}
+	for i := 0; i < workers; i++ {
+		<-done
+	}
+	slog.Info("Webhook dispatcher stopped")
+}
+
+// deliver POSTs job, retrying failures with exponential backoff. Any 2xx
+// response counts as delivered.
+func (d *WebhookDispatcher) deliver(ctx context.Context, job webhookJob) {
+	delay := d.retryDelay
+	for attempt := 1; attempt <= d.attempts; attempt++ {
+		status, err := d.post(ctx, job)
+		if d.record != nil {
+			d.record(ctx, job, attempt, status, err)
+		}
+		if err == nil {
+			return
+		}
+		slog.Warn("Webhook delivery failed",
+			"webhook_id", job.webhook.ID, "event", job.event, "attempt", attempt, "error", err)
+		if attempt == d.attempts {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (d *WebhookDispatcher) post(ctx context.Context, job webhookJob) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, job.webhook.URL, bytes.NewReader(job.payload))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(webhookEventHeader, job.event)
+	req.Header.Set(webhookSignatureHeader, signPayload(job.webhook.Secret, job.payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, resp.Body)
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("webhook returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// signPayload returns the signature header value for payload: the hex
+// HMAC-SHA256 of the body under the webhook's secret, prefixed "sha256=".
+func signPayload(secret string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(payload)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// newWebhookSecret returns a random signing secret.
+func newWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// validateWebhookURL accepts absolute http and https URLs. Where they may
+// point is checked when delivering, by refuseNonPublicAddress.
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("invalid webhook: url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// publishWebhookEvent queues event for every registered webhook. Failures
+// are logged rather than returned: the change that triggered the event has
+// already been committed.
+func (app *App) publishWebhookEvent(ctx context.Context, event string, data any) {
+	if app.Webhooks == nil {
+		return
+	}
+
+	payload, err := json.Marshal(webhookEvent{Event: event, CreatedAt: app.now(), Data: data})
+	if err != nil {
+		slog.ErrorContext(ctx, "Error encoding webhook event", "event", event, "error", err)
+		return
+	}
+
+	rows, err := app.DBClient.Query(ctx, "SELECT id, url, secret, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		slog.ErrorContext(ctx, "Error loading webhooks", "event", event, "error", err)
+		return
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var hook Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.Secret, &hook.CreatedAt); err != nil {
+			slog.ErrorContext(ctx, "Error loading webhooks", "event", event, "error", err)
+			return
+		}
+		app.Webhooks.Enqueue(webhookJob{webhook: hook, event: event, payload: payload})
+	}
+	if err := rows.Err(); err != nil {
+		slog.ErrorContext(ctx, "Error loading webhooks", "event", event, "error", err)
+	}
+}
+
+// recordWebhookDelivery adds a delivery attempt to the log.
+func (app *App) recordWebhookDelivery(ctx context.Context, job webhookJob, attempt, status int, deliveryErr error) {
+	var statusCode *int
+	if status != 0 {
+		statusCode = &status
+	}
+	var message *string
+	if deliveryErr != nil {
+		s := deliveryErr.Error()
+		message = &s
+	}
+
+	_, err := app.DBClient.Exec(ctx,
+		`INSERT INTO webhook_deliveries (webhook_id, event, attempt, status_code, error)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		job.webhook.ID, job.event, attempt, statusCode, message)
+	// The webhook may have been deleted while the event was queued.
+	if err != nil && !isPgError(err, pgForeignKeyViolation) {
+		slog.Error("Error recording webhook delivery", "webhook_id", job.webhook.ID, "error", err)
+	}
+}
+
+func (app *App) getWebhooks(w http.ResponseWriter, r *http.Request) {
+	rows, err := app.DBClient.Query(r.Context(), "SELECT id, url, created_at FROM webhooks ORDER BY id")
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var hook Webhook
+		if err := rows.Scan(&hook.ID, &hook.URL, &hook.CreatedAt); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		webhooks = append(webhooks, hook)
+	}
+
+	writeJSON(w, http.StatusOK, webhooks)
+}
+
+func (app *App) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var hook Webhook
+	if err := json.NewDecoder(r.Body).Decode(&hook); err != nil {
+		writeDecodeError(w, err)
+		return
+	}
+
+	hook.URL = strings.TrimSpace(hook.URL)
+	if err := validateWebhookURL(hook.URL); err != nil {
+		writeJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if hook.Secret == "" {
+		secret, err := newWebhookSecret()
+		if err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		hook.Secret = secret
+	}
+
+	err := app.DBClient.QueryRow(r.Context(),
+		"INSERT INTO webhooks (url, secret) VALUES ($1, $2) RETURNING id, created_at",
+		hook.URL, hook.Secret).Scan(&hook.ID, &hook.CreatedAt)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+func (app *App) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	tag, err := app.DBClient.Exec(r.Context(), "DELETE FROM webhooks WHERE id=$1", id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if tag.RowsAffected() == 0 {
+		writeJSONError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// getWebhookDeliveries lists the delivery log of a webhook, newest first.
+func (app *App) getWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	var exists bool
+	err := app.DBClient.QueryRow(r.Context(),
+		"SELECT EXISTS (SELECT 1 FROM webhooks WHERE id=$1)", id).Scan(&exists)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	if !exists {
+		writeJSONError(w, http.StatusNotFound, "webhook not found")
+		return
+	}
+
+	rows, err := app.DBClient.Query(r.Context(),
+		`SELECT id, webhook_id, event, attempt, status_code, error, created_at
+		 FROM webhook_deliveries WHERE webhook_id=$1 ORDER BY id DESC LIMIT 100`, id)
+	if err != nil {
+		writeJSONError(w, http.StatusInternalServerError, err.Error())
+		return
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Attempt, &d.StatusCode, &d.Error, &d.CreatedAt); err != nil {
+			writeJSONError(w, http.StatusInternalServerError, err.Error())
+			return
+		}
+		deliveries = append(deliveries, d)
+	}
+
+	writeJSON(w, http.StatusOK, deliveries)
+}
@@ -0,0 +1,348 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// delivery is a webhook request as seen by the receiving server.
+type delivery struct {
+	header http.Header
+	body   []byte
+}
+
+// webhookReceiver starts a server that answers with the given statuses in
+// turn (200 once they run out) and reports each request it gets.
+func webhookReceiver(t *testing.T, statuses ...int) (*httptest.Server, <-chan delivery) {
+	received := make(chan delivery, 10)
+	var mu sync.Mutex
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		received <- delivery{header: r.Header, body: body}
+
+		mu.Lock()
+		status := http.StatusOK
+		if len(statuses) > 0 {
+			status, statuses = statuses[0], statuses[1:]
+		}
+		mu.Unlock()
+		w.WriteHeader(status)
+	}))
+	t.Cleanup(srv.Close)
+	return srv, received
+}
+
+func awaitDelivery(t *testing.T, received <-chan delivery) delivery {
+	t.Helper()
+	select {
+	case d := <-received:
+		return d
+	case <-time.After(5 * time.Second):
+		t.Fatal("Webhook was not delivered")
+		return delivery{}
+	}
+}
+
+func TestWebhookDispatcherDeliversSignedPayload(t *testing.T) {
+	srv, received := webhookReceiver(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewWebhookDispatcher(1)
+	d.client = newWebhookClient(nil) // the receiver is on loopback
+	go d.Run(ctx, 1)
+
+	payload := []byte(`{"event":"expense.created","data":{"id":1}}`)
+	assert.True(t, d.Enqueue(webhookJob{
+		webhook: Webhook{ID: 1, URL: srv.URL, Secret: "s3cret"},
+		event:   eventExpenseCreated,
+		payload: payload,
+	}))
+
+	got := awaitDelivery(t, received)
+	assert.Equal(t, payload, got.body)
+	assert.Equal(t, "application/json", got.header.Get("Content-Type"))
+	assert.Equal(t, eventExpenseCreated, got.header.Get(webhookEventHeader))
+	assert.Equal(t, signPayload("s3cret", payload), got.header.Get(webhookSignatureHeader))
+	assert.NotEqual(t, signPayload("other", payload), got.header.Get(webhookSignatureHeader))
+}
+
+func TestWebhookDispatcherRetries(t *testing.T) {
+	srv, received := webhookReceiver(t, http.StatusInternalServerError, http.StatusBadGateway)
+
+	type attempt struct{ n, status int }
+	attempts := make(chan attempt, 10)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewWebhookDispatcher(1)
+	d.client = newWebhookClient(nil) // the receiver is on loopback
+	d.retryDelay = time.Millisecond
+	d.record = func(ctx context.Context, job webhookJob, n, status int, err error) {
+		attempts <- attempt{n, status}
+	}
+	go d.Run(ctx, 1)
+
+	d.Enqueue(webhookJob{webhook: Webhook{ID: 1, URL: srv.URL}, event: eventExpenseCreated, payload: []byte(`{}`)})
+
+	for range 3 {
+		awaitDelivery(t, received)
+	}
+	var got []attempt
+	for range 3 {
+		got = append(got, <-attempts)
+	}
+	assert.Equal(t, []attempt{{1, 500}, {2, 502}, {3, 200}}, got, "Should retry until the endpoint succeeds")
+}
+
+func TestWebhookDispatcherRefusesPrivateAddress(t *testing.T) {
+	srv, received := webhookReceiver(t)
+
+	type attempt struct {
+		status int
+		err    error
+	}
+	attempts := make(chan attempt, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewWebhookDispatcher(1)
+	d.attempts = 1
+	d.record = func(ctx context.Context, job webhookJob, n, status int, err error) {
+		attempts <- attempt{status, err}
+	}
+	go d.Run(ctx, 1)
+
+	d.Enqueue(webhookJob{webhook: Webhook{ID: 1, URL: srv.URL}, event: eventExpenseCreated, payload: []byte(`{}`)})
+
+	got := <-attempts
+	assert.Zero(t, got.status, "Should not get a response")
+	assert.ErrorIs(t, got.err, errWebhookAddress)
+	select {
+	case <-received:
+		t.Error("Should not reach a loopback server")
+	default:
+	}
+}
+
+func TestWebhookDispatcherDoesNotFollowRedirects(t *testing.T) {
+	target, received := webhookReceiver(t)
+	redirect := httptest.NewServer(http.RedirectHandler(target.URL, http.StatusFound))
+	t.Cleanup(redirect.Close)
+
+	statuses := make(chan int, 1)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	d := NewWebhookDispatcher(1)
+	d.client = newWebhookClient(nil) // the servers are on loopback
+	d.attempts = 1
+	d.record = func(ctx context.Context, job webhookJob, n, status int, err error) {
+		statuses <- status
+	}
+	go d.Run(ctx, 1)
+
+	d.Enqueue(webhookJob{webhook: Webhook{ID: 1, URL: redirect.URL}, event: eventExpenseCreated, payload: []byte(`{}`)})
+
+	assert.Equal(t, http.StatusFound, <-statuses, "Should report the redirect as the result")
+	select {
+	case <-received:
+		t.Error("Should not follow the redirect")
+	default:
+	}
+}
+
+func TestRefuseNonPublicAddress(t *testing.T) {
+	refused := []string{
+		"127.0.0.1:80",
+		"[::1]:80",
+		"10.1.2.3:443",
+		"172.16.0.1:443",
+		"192.168.1.1:80",
+		"169.254.169.254:80",
+		"[fe80::1]:80",
+		"[fd00::1]:80",
+		"0.0.0.0:80",
+		"100.100.100.200:80",
+		"224.0.0.1:80",
+		"[::ffff:127.0.0.1]:80",
+	}
+	for _, address := range refused {
+		assert.ErrorIs(t, refuseNonPublicAddress("tcp", address, nil), errWebhookAddress, address)
+	}
+
+	for _, address := range []string{"93.184.216.34:443", "[2606:4700:4700::1111]:443"} {
+		assert.NoError(t, refuseNonPublicAddress("tcp", address, nil), address)
+	}
+}
+
+func TestWebhookDispatcherDropsWhenFull(t *testing.T) {
+	// Nothing is running, so the queue never drains
+	d := NewWebhookDispatcher(1)
+	job := webhookJob{webhook: Webhook{ID: 1, URL: "http://example.invalid"}, event: eventExpenseCreated}
+
+	assert.True(t, d.Enqueue(job))
+	assert.False(t, d.Enqueue(job), "Should drop rather than block when the queue is full")
+}
+
+func TestCreateWebhookRejectsInvalidURL(t *testing.T) {
+	router := (&App{}).routes()
+
+	for _, body := range []string{`{"url": ""}`, `{"url": "ftp://example.com/hook"}`, `{"url": "/hooks"}`} {
+		req, _ := http.NewRequest("POST", "/api/webhooks", bytes.NewBufferString(body))
+		req.Header.Set("Content-Type", "application/json")
+		rr := httptest.NewRecorder()
+		router.ServeHTTP(rr, req)
+		assert.Equal(t, http.StatusBadRequest, rr.Code, body)
+	}
+}
+
+func TestExpenseCreatedWebhook(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	app.Webhooks = NewWebhookDispatcher(webhookQueueSize)
+	app.Webhooks.client = newWebhookClient(nil) // the receiver is on loopback
+	recorded := make(chan struct{}, 1)
+	app.Webhooks.record = func(ctx context.Context, job webhookJob, attempt, status int, err error) {
+		app.recordWebhookDelivery(ctx, job, attempt, status, err)
+		recorded <- struct{}{}
+	}
+	go app.Webhooks.Run(ctx, 1)
+
+	srv, received := webhookReceiver(t)
+
+	// Register the webhook
+	req, _ := http.NewRequest("POST", "/api/webhooks", bytes.NewBufferString(fmt.Sprintf(`{"url": %q}`, srv.URL)))
+	req.Header.Set("Content-Type", "application/json")
+	rr := httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+
+	var hook Webhook
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &hook))
+	assert.NotEmpty(t, hook.Secret, "Should generate a secret")
+	defer app.DBClient.Exec(context.Background(), "DELETE FROM webhooks WHERE id=$1", hook.ID)
+
+	// Create an expense
+	expenseJSON, _ := json.Marshal(Expense{
+		Description: fmt.Sprintf("Webhook %d", time.Now().UnixNano()),
+		Amount:      725,
+		Category:    "Food",
+		Date:        time.Now().Round(time.Second),
+	})
+	req, _ = http.NewRequest("POST", "/api/expenses", bytes.NewBuffer(expenseJSON))
+	req.Header.Set("Content-Type", "application/json")
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+
+	var created Expense
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &created))
+
+	got := awaitDelivery(t, received)
+	assert.Equal(t, signPayload(hook.Secret, got.body), got.header.Get(webhookSignatureHeader))
+
+	var event struct {
+		Event string  `json:"event"`
+		Data  Expense `json:"data"`
+	}
+	assert.NoError(t, json.Unmarshal(got.body, &event))
+	assert.Equal(t, eventExpenseCreated, event.Event)
+	assert.Equal(t, created.ID, event.Data.ID)
+	assert.Equal(t, created.Description, event.Data.Description)
+
+	// The attempt is logged
+	<-recorded
+	req, _ = http.NewRequest("GET", fmt.Sprintf("/api/webhooks/%d/deliveries", hook.ID), nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.Equal(t, http.StatusOK, rr.Code)
+
+	var deliveries []WebhookDelivery
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &deliveries))
+	if assert.Len(t, deliveries, 1) {
+		assert.Equal(t, 1, deliveries[0].Attempt)
+		if assert.NotNil(t, deliveries[0].StatusCode) {
+			assert.Equal(t, http.StatusOK, *deliveries[0].StatusCode)
+		}
+		assert.Nil(t, deliveries[0].Error)
+	}
+
+	// The secret is never listed
+	req, _ = http.NewRequest("GET", "/api/webhooks", nil)
+	rr = httptest.NewRecorder()
+	router.ServeHTTP(rr, req)
+	assert.NotContains(t, rr.Body.String(), hook.Secret)
+}
+
+func TestBulkAndRecurringExpensesPublishWebhooks(t *testing.T) {
+	app, router := setupTestApp()
+	defer app.DBClient.Close()
+
+	// Nothing runs the dispatcher, so queued jobs stay put to be inspected
+	app.Webhooks = NewWebhookDispatcher(webhookQueueSize)
+
+	ctx := context.Background()
+	var hookID int
+	err := app.DBClient.QueryRow(ctx,
+		"INSERT INTO webhooks (url, secret) VALUES ($1, $2) RETURNING id", "http://example.invalid/hook", "s3cret").Scan(&hookID)
+	assert.NoError(t, err, "Should insert webhook")
+	defer app.DBClient.Exec(ctx, "DELETE FROM webhooks WHERE id=$1", hookID)
+
+	// published drains the queue and returns the expenses created events
+	// were queued for on our webhook.
+	published := func() []int {
+		var ids []int
+		for {
+			select {
+			case job := <-app.Webhooks.queue:
+				if job.webhook.ID != hookID || job.event != eventExpenseCreated {
+					continue
+				}
+				var event struct {
+					Data Expense `json:"data"`
+				}
+				assert.NoError(t, json.Unmarshal(job.payload, &event))
+				ids = append(ids, event.Data.ID)
+			default:
+				return ids
+			}
+		}
+	}
+
+	rr := bulkRequest(router, `[
+		{"description": "Hook bulk one", "amount": 1.00, "category": "Food", "date": "2024-02-01T08:00:00Z"},
+		{"description": "Hook bulk two", "amount": 2.00, "category": "Food", "date": "2024-02-01T09:00:00Z"}
+	]`)
+	assert.Equal(t, http.StatusCreated, rr.Code)
+	var result bulkResult
+	assert.NoError(t, json.Unmarshal(rr.Body.Bytes(), &result))
+	var bulkIDs []int
+	for _, e := range result.Expenses {
+		bulkIDs = append(bulkIDs, e.ID)
+	}
+	assert.ElementsMatch(t, bulkIDs, published(), "Should publish every bulk-created expense")
+
+	now := time.Date(2024, 6, 10, 12, 0, 0, 0, time.UTC)
+	_, err = app.DBClient.Exec(ctx,
+		`INSERT INTO recurring_expenses (description, amount, category, interval, next_run)
+		 VALUES ($1, $2, $3, $4, $5)`,
+		fmt.Sprintf("Hook recurring %d", time.Now().UnixNano()), Cents(900), "Food", "daily", now.AddDate(0, 0, -1))
+	assert.NoError(t, err, "Should insert recurring expense")
+
+	created, err := app.generateDueRecurring(ctx, now)
+	assert.NoError(t, err)
+	assert.Len(t, published(), created, "Should publish every generated expense")
+}